@@ -0,0 +1,234 @@
+package gosn
+
+import (
+	"encoding/json"
+)
+
+// OrgStandardNotesSNDetail holds the attributes of an item written by the official apps
+// Attributes not modelled are held in Other and written back as is
+type OrgStandardNotesSNDetail struct {
+	ClientUpdatedAt    string `json:"client_updated_at"`
+	Pinned             bool   `json:"pinned,omitempty"`
+	Archived           bool   `json:"archived,omitempty"`
+	Locked             bool   `json:"locked,omitempty"`
+	Trashed            bool   `json:"trashed,omitempty"`
+	PrefersPlainEditor bool   `json:"prefersPlainEditor,omitempty"`
+
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON returns the modelled attributes along with any others retained when unmarshalled
+func (d OrgStandardNotesSNDetail) MarshalJSON() ([]byte, error) {
+	type detail OrgStandardNotesSNDetail
+
+	return marshalWithOther(detail(d), d.Other)
+}
+
+// UnmarshalJSON populates the modelled attributes and retains any others
+func (d *OrgStandardNotesSNDetail) UnmarshalJSON(b []byte) (err error) {
+	type detail OrgStandardNotesSNDetail
+
+	var dd detail
+
+	dd.Other, err = unmarshalWithOther(b, &dd)
+	if err != nil {
+		return
+	}
+
+	*d = OrgStandardNotesSNDetail(dd)
+
+	return
+}
+
+// AppDataContent holds data that apps store alongside an item's content, keyed by domain
+// Domains other than the official apps', such as the data held for components, are held in Other
+// and written back as is
+type AppDataContent struct {
+	OrgStandardNotesSN OrgStandardNotesSNDetail `json:"org.standardnotes.sn"`
+
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON returns the official apps' domain along with any others retained when unmarshalled
+func (a AppDataContent) MarshalJSON() ([]byte, error) {
+	type appData AppDataContent
+
+	return marshalWithOther(appData(a), a.Other)
+}
+
+// UnmarshalJSON populates the official apps' domain and retains any others
+func (a *AppDataContent) UnmarshalJSON(b []byte) (err error) {
+	type appData AppDataContent
+
+	var ad appData
+
+	ad.Other, err = unmarshalWithOther(b, &ad)
+	if err != nil {
+		return
+	}
+
+	*a = AppDataContent(ad)
+
+	return
+}
+
+// copy returns a copy of the appdata, including the attributes not modelled
+func (a AppDataContent) copy() AppDataContent {
+	res := a
+	res.Other = copyOther(a.Other)
+	res.OrgStandardNotesSN.Other = copyOther(a.OrgStandardNotesSN.Other)
+
+	return res
+}
+
+// AppDataClientStructure defines behaviour of the flags the official apps hold in an item's appdata
+// It is implemented by the content of notes, tags and components, so assert it from an item's content
+type AppDataClientStructure interface {
+	// return pinned status
+	IsPinned() bool
+	// set pinned status
+	SetPinned(pinned bool)
+	// return archived status
+	IsArchived() bool
+	// set archived status
+	SetArchived(archived bool)
+	// return locked status, which prevents editing
+	IsLocked() bool
+	// set locked status
+	SetLocked(locked bool)
+	// return trashed status
+	IsTrashed() bool
+	// set trashed status
+	SetTrashed(trashed bool)
+	// return whether the plain editor is preferred
+	PrefersPlainEditor() bool
+	// set whether the plain editor is preferred
+	SetPrefersPlainEditor(prefers bool)
+}
+
+// isTrashed returns whether the content is flagged as trashed, which content without the flags never is
+func isTrashed(content ClientStructure) bool {
+	flags, ok := content.(AppDataClientStructure)
+
+	return ok && flags.IsTrashed()
+}
+
+func (noteContent *NoteContent) IsPinned() bool {
+	return noteContent.AppData.OrgStandardNotesSN.Pinned
+}
+
+func (noteContent *NoteContent) SetPinned(pinned bool) {
+	noteContent.AppData.OrgStandardNotesSN.Pinned = pinned
+}
+
+func (noteContent *NoteContent) IsArchived() bool {
+	return noteContent.AppData.OrgStandardNotesSN.Archived
+}
+
+func (noteContent *NoteContent) SetArchived(archived bool) {
+	noteContent.AppData.OrgStandardNotesSN.Archived = archived
+}
+
+func (noteContent *NoteContent) IsLocked() bool {
+	return noteContent.AppData.OrgStandardNotesSN.Locked
+}
+
+func (noteContent *NoteContent) SetLocked(locked bool) {
+	noteContent.AppData.OrgStandardNotesSN.Locked = locked
+}
+
+func (noteContent *NoteContent) IsTrashed() bool {
+	return noteContent.AppData.OrgStandardNotesSN.Trashed
+}
+
+func (noteContent *NoteContent) SetTrashed(trashed bool) {
+	noteContent.AppData.OrgStandardNotesSN.Trashed = trashed
+}
+
+func (noteContent *NoteContent) PrefersPlainEditor() bool {
+	return noteContent.AppData.OrgStandardNotesSN.PrefersPlainEditor
+}
+
+func (noteContent *NoteContent) SetPrefersPlainEditor(prefers bool) {
+	noteContent.AppData.OrgStandardNotesSN.PrefersPlainEditor = prefers
+}
+
+func (tagContent *TagContent) IsPinned() bool {
+	return tagContent.AppData.OrgStandardNotesSN.Pinned
+}
+
+func (tagContent *TagContent) SetPinned(pinned bool) {
+	tagContent.AppData.OrgStandardNotesSN.Pinned = pinned
+}
+
+func (tagContent *TagContent) IsArchived() bool {
+	return tagContent.AppData.OrgStandardNotesSN.Archived
+}
+
+func (tagContent *TagContent) SetArchived(archived bool) {
+	tagContent.AppData.OrgStandardNotesSN.Archived = archived
+}
+
+func (tagContent *TagContent) IsLocked() bool {
+	return tagContent.AppData.OrgStandardNotesSN.Locked
+}
+
+func (tagContent *TagContent) SetLocked(locked bool) {
+	tagContent.AppData.OrgStandardNotesSN.Locked = locked
+}
+
+func (tagContent *TagContent) IsTrashed() bool {
+	return tagContent.AppData.OrgStandardNotesSN.Trashed
+}
+
+func (tagContent *TagContent) SetTrashed(trashed bool) {
+	tagContent.AppData.OrgStandardNotesSN.Trashed = trashed
+}
+
+func (tagContent *TagContent) PrefersPlainEditor() bool {
+	return tagContent.AppData.OrgStandardNotesSN.PrefersPlainEditor
+}
+
+func (tagContent *TagContent) SetPrefersPlainEditor(prefers bool) {
+	tagContent.AppData.OrgStandardNotesSN.PrefersPlainEditor = prefers
+}
+
+func (cc *ComponentContent) IsPinned() bool {
+	return cc.AppData.OrgStandardNotesSN.Pinned
+}
+
+func (cc *ComponentContent) SetPinned(pinned bool) {
+	cc.AppData.OrgStandardNotesSN.Pinned = pinned
+}
+
+func (cc *ComponentContent) IsArchived() bool {
+	return cc.AppData.OrgStandardNotesSN.Archived
+}
+
+func (cc *ComponentContent) SetArchived(archived bool) {
+	cc.AppData.OrgStandardNotesSN.Archived = archived
+}
+
+func (cc *ComponentContent) IsLocked() bool {
+	return cc.AppData.OrgStandardNotesSN.Locked
+}
+
+func (cc *ComponentContent) SetLocked(locked bool) {
+	cc.AppData.OrgStandardNotesSN.Locked = locked
+}
+
+func (cc *ComponentContent) IsTrashed() bool {
+	return cc.AppData.OrgStandardNotesSN.Trashed
+}
+
+func (cc *ComponentContent) SetTrashed(trashed bool) {
+	cc.AppData.OrgStandardNotesSN.Trashed = trashed
+}
+
+func (cc *ComponentContent) PrefersPlainEditor() bool {
+	return cc.AppData.OrgStandardNotesSN.PrefersPlainEditor
+}
+
+func (cc *ComponentContent) SetPrefersPlainEditor(prefers bool) {
+	cc.AppData.OrgStandardNotesSN.PrefersPlainEditor = prefers
+}
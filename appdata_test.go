@@ -0,0 +1,103 @@
+package gosn
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNoteContentWithAppData = `{
+  "title": "title",
+  "text": "text",
+  "references": [],
+  "appData": {
+    "org.standardnotes.sn": {
+      "client_updated_at": "2020-01-01T10:00:00.000Z",
+      "pinned": true,
+      "locked": true,
+      "prefersPlainEditor": true,
+      "unknownFlag": "kept"
+    },
+    "org.standardnotes.sn.components": {
+      "component-uuid": {"height": 200}
+    }
+  }
+}`
+
+func TestAppDataRoundTrip(t *testing.T) {
+	content, err := processContentModel("Note", testNoteContentWithAppData)
+	assert.NoError(t, err)
+
+	flags, ok := content.(AppDataClientStructure)
+	assert.True(t, ok)
+
+	assert.True(t, flags.IsPinned())
+	assert.False(t, flags.IsArchived())
+	assert.True(t, flags.IsLocked())
+	assert.False(t, flags.IsTrashed())
+	assert.True(t, flags.PrefersPlainEditor())
+
+	b, err := json.Marshal(content)
+	assert.NoError(t, err)
+	assert.JSONEq(t, testNoteContentWithAppData, string(b))
+
+	flags.SetPinned(false)
+	flags.SetArchived(true)
+	flags.SetTrashed(true)
+
+	b, err = json.Marshal(content)
+	assert.NoError(t, err)
+
+	var appData struct {
+		AppData map[string]map[string]interface{} `json:"appData"`
+	}
+
+	assert.NoError(t, json.Unmarshal(b, &appData))
+
+	sn := appData.AppData["org.standardnotes.sn"]
+	assert.NotContains(t, sn, "pinned")
+	assert.Equal(t, true, sn["archived"])
+	assert.Equal(t, true, sn["trashed"])
+	assert.Equal(t, "kept", sn["unknownFlag"])
+	assert.Contains(t, appData.AppData, "org.standardnotes.sn.components")
+}
+
+func TestAppDataSurvivesEncryption(t *testing.T) {
+	content, err := processContentModel("Note", testNoteContentWithAppData)
+	assert.NoError(t, err)
+
+	note := NewNote()
+	note.Content = content
+
+	items := Items{*note}
+	eItems, err := items.Encrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+
+	dItems, err := eItems.DecryptAndParse(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+	assert.Len(t, dItems, 1)
+	assert.True(t, dItems[0].Content.(AppDataClientStructure).IsPinned())
+
+	b, err := json.Marshal(dItems[0].Content)
+	assert.NoError(t, err)
+	assert.JSONEq(t, testNoteContentWithAppData, string(b))
+}
+
+func TestAppDataFlagsOnTags(t *testing.T) {
+	tag := createTag("tag", "")
+	flags := tag.Content.(AppDataClientStructure)
+	flags.SetPinned(true)
+	flags.SetLocked(true)
+	flags.SetPrefersPlainEditor(true)
+
+	assert.True(t, flags.IsPinned())
+	assert.True(t, flags.IsLocked())
+	assert.True(t, flags.PrefersPlainEditor())
+
+	var emptyAppData AppDataContent
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"org.standardnotes.sn":{"client_updated_at":""}}`), &emptyAppData))
+	assert.Nil(t, emptyAppData.Other)
+	assert.Nil(t, emptyAppData.OrgStandardNotesSN.Other)
+}
@@ -2,7 +2,11 @@ package gosn
 
 import (
 	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	mathrand "math/rand"
@@ -31,16 +35,21 @@ type authParamsInput struct {
 	debug         bool
 }
 
-type authParamsOutput struct {
+// KeyParams are the parameters used to derive an account's keys from its password
+type KeyParams struct {
 	Identifier    string `json:"identifier"`
-	PasswordSalt  string `json:"pw_salt"`
-	PasswordCost  int64  `json:"pw_cost"`
-	PasswordNonce string `json:"pw_nonce"`
+	PasswordSalt  string `json:"pw_salt,omitempty"`
+	PasswordCost  int64  `json:"pw_cost,omitempty"`
+	PasswordNonce string `json:"pw_nonce,omitempty"`
 	Version       string `json:"version"`
-	TokenName     string
 }
 
-func requestToken(client *http.Client, input signInInput) (signInSuccess signInResponse, signInFailure errorResponse, err error) {
+type authParamsOutput struct {
+	KeyParams
+	TokenName string
+}
+
+func (c *Client) requestToken(ctx context.Context, input signInInput) (signInSuccess signInResponse, err error) {
 	var reqBodyBytes []byte
 
 	var reqBody string
@@ -55,7 +64,7 @@ func requestToken(client *http.Client, input signInInput) (signInSuccess signInR
 
 	var signInURLReq *http.Request
 
-	signInURLReq, err = http.NewRequest(http.MethodPost, input.signInURL, bytes.NewBuffer(reqBodyBytes))
+	signInURLReq, err = c.newRequest(ctx, http.MethodPost, input.signInURL, bytes.NewBuffer(reqBodyBytes))
 	if err != nil {
 		return
 	}
@@ -66,13 +75,13 @@ func requestToken(client *http.Client, input signInInput) (signInSuccess signInR
 	var signInResp *http.Response
 
 	start := time.Now()
-	signInResp, err = httpClient.Do(signInURLReq)
+	signInResp, err = c.httpClient.Do(signInURLReq)
 	elapsed := time.Since(start)
 
-	debugPrint(input.debug, fmt.Sprintf("requestToken | request took: %+v", elapsed))
+	c.debugPrint(input.debug, fmt.Sprintf("requestToken | request took: %+v", elapsed))
 
 	if err != nil {
-		return signInSuccess, signInFailure, err
+		return signInSuccess, err
 	}
 
 	defer func() {
@@ -85,24 +94,22 @@ func requestToken(client *http.Client, input signInInput) (signInSuccess signInR
 
 	readStart := time.Now()
 	signInRespBody, err = ioutil.ReadAll(signInResp.Body)
-	debugPrint(input.debug, fmt.Sprintf("requestToken | response read took %+v", time.Since(readStart)))
-
+	c.debugPrint(input.debug, fmt.Sprintf("requestToken | response read took %+v", time.Since(readStart)))
 
 	if err != nil {
 		return
 	}
-	// unmarshal success
-	err = json.Unmarshal(signInRespBody, &signInSuccess)
-	if err != nil {
+
+	if signInResp.StatusCode != http.StatusOK {
+		err = newAPIError(signInResp.StatusCode, signInRespBody)
 		return
 	}
-	// unmarshal failure
-	err = json.Unmarshal(signInRespBody, &signInFailure)
+	// unmarshal success
+	err = json.Unmarshal(signInRespBody, &signInSuccess)
 	if err != nil {
 		return
 	}
-
-	return signInSuccess, signInFailure, err
+	return signInSuccess, err
 }
 
 func processDoAuthRequestResponse(response *http.Response, debug bool) (output doAuthRequestOutput, errResp errorResponse, err error) {
@@ -125,7 +132,7 @@ func processDoAuthRequestResponse(response *http.Response, debug bool) (output d
 			return
 		}
 	default:
-		err = fmt.Errorf("unhandled: %+v", response)
+		err = newAPIError(response.StatusCode, body)
 		return
 	}
 
@@ -143,7 +150,7 @@ type errorResponse struct {
 }
 
 // HTTP request bit
-func doAuthParamsRequest(input authParamsInput) (output doAuthRequestOutput, err error) {
+func (c *Client) doAuthParamsRequest(ctx context.Context, input authParamsInput) (output doAuthRequestOutput, err error) {
 	// make initial params request without mfa token
 	var reqURL string
 
@@ -157,14 +164,14 @@ func doAuthParamsRequest(input authParamsInput) (output doAuthRequestOutput, err
 
 	var req *http.Request
 
-	req, err = http.NewRequest(http.MethodGet, reqURL, nil)
+	req, err = c.newRequest(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
 		return
 	}
 
 	var response *http.Response
 
-	response, err = httpClient.Do(req)
+	response, err = c.httpClient.Do(req)
 	if err != nil {
 		return
 	}
@@ -194,10 +201,10 @@ func doAuthParamsRequest(input authParamsInput) (output doAuthRequestOutput, err
 	return output, err
 }
 
-func getAuthParams(input authParamsInput) (output authParamsOutput, err error) {
+func (c *Client) getAuthParams(ctx context.Context, input authParamsInput) (output authParamsOutput, err error) {
 	var authRequestOutput doAuthRequestOutput
 	// if token name not provided, then make request without
-	authRequestOutput, err = doAuthParamsRequest(input)
+	authRequestOutput, err = c.doAuthParamsRequest(ctx, input)
 	if err != nil {
 		return
 	}
@@ -245,10 +252,15 @@ type registerResponse struct {
 // Session holds authentication and encryption parameters required
 // to communicate with the API and process transferred data
 type Session struct {
-	Token  string
-	Mk     string
-	Ak     string
-	Server string
+	Token     string
+	Mk        string
+	Ak        string
+	Server    string
+	Version   string    // protocol version of the account's keys
+	UserUUID  string    // UUID of the account, if returned by the server
+	KeyParams KeyParams // parameters used to derive the account's keys
+	CreatedAt time.Time // time the session was created by signing in
+	ItemsKeys ItemsKeys // decrypted items keys used to encrypt item keys
 }
 
 type SignInInput struct {
@@ -257,7 +269,10 @@ type SignInInput struct {
 	TokenVal  string
 	Password  string
 	APIServer string
-	Debug     bool
+	// retrieve the account's items keys into the session, creating a default items key if it has none
+	// retrieving them requires all of the account's items to be downloaded
+	EnsureItemsKey bool
+	Debug          bool
 }
 
 type SignInOutput struct {
@@ -265,35 +280,59 @@ type SignInOutput struct {
 	TokenName string
 }
 
-func processConnectionFailure(i error, reqURL string) error {
+// processConnectionFailure returns a ConnectionError describing a failure to reach the server
+func (c *Client) processConnectionFailure(i error, reqURL string) error {
+	var msg string
+
 	switch {
 	case strings.Contains(i.Error(), "no such host"):
 		urlBits, pErr := url.Parse(reqURL)
 		if pErr != nil {
-			break
+			return i
 		}
 
-		return fmt.Errorf("failed to connect to %s as %s cannot be resolved", reqURL, urlBits.Hostname())
+		msg = fmt.Sprintf("failed to connect to %s as %s cannot be resolved", reqURL, urlBits.Hostname())
 	case strings.Contains(i.Error(), "unsupported protocol scheme"):
 		if len(reqURL) > 0 {
-			return fmt.Errorf("protocol is missing from API server URL: %s", reqURL)
+			msg = fmt.Sprintf("protocol is missing from API server URL: %s", reqURL)
+			break
 		}
 
-		return fmt.Errorf("API Server URL is undefined")
+		msg = "API Server URL is undefined"
 	case strings.Contains(i.Error(), "i/o timeout"):
-		return fmt.Errorf("failed to connect to %s within %d seconds", reqURL, connectionTimeout)
+		msg = fmt.Sprintf("failed to connect to %s within %d seconds", reqURL, int(c.connectTimeout/time.Second))
 	case strings.Contains(i.Error(), "permission denied"):
-		return fmt.Errorf("failed to connect to %s", reqURL)
+		msg = fmt.Sprintf("failed to connect to %s", reqURL)
+	default:
+		return i
 	}
 
-	return i
+	return &ConnectionError{URL: reqURL, Message: msg, Err: i}
 }
 
 // SignIn authenticates with the server using credentials and optional MFA
 // in order to obtain the data required to interact with Standard Notes
+// If MFA is required, then a *MFARequiredError holding the token name is returned, along with the
+// output's TokenName, and the token value must be provided to sign in again
 func SignIn(input SignInInput) (output SignInOutput, err error) {
+	return defaultClient.SignIn(input)
+}
+
+// SignInWithContext is SignIn with a context that can cancel the requests made
+func SignInWithContext(ctx context.Context, input SignInInput) (output SignInOutput, err error) {
+	return defaultClient.SignInWithContext(ctx, input)
+}
+
+// SignIn authenticates with the server using credentials and optional MFA
+// in order to obtain the data required to interact with Standard Notes
+func (c *Client) SignIn(input SignInInput) (output SignInOutput, err error) {
+	return c.SignInWithContext(context.Background(), input)
+}
+
+// SignInWithContext is SignIn with a context that can cancel the requests made
+func (c *Client) SignInWithContext(ctx context.Context, input SignInInput) (output SignInOutput, err error) {
 	if input.APIServer == "" {
-		input.APIServer = apiServer
+		input.APIServer = c.server
 	}
 
 	getAuthParamsInput := authParamsInput{
@@ -307,14 +346,16 @@ func SignIn(input SignInInput) (output SignInOutput, err error) {
 	// request authentication parameters
 	var getAuthParamsOutput authParamsOutput
 
-	getAuthParamsOutput, err = getAuthParams(getAuthParamsInput)
+	getAuthParamsOutput, err = c.getAuthParams(ctx, getAuthParamsInput)
 	if err != nil {
-		err = processConnectionFailure(err, getAuthParamsInput.authParamsURL)
+		err = c.processConnectionFailure(err, getAuthParamsInput.authParamsURL)
 		return
 	}
 	// if we received a token name then we need to request token value
 	if getAuthParamsOutput.TokenName != "" {
 		output.TokenName = getAuthParamsOutput.TokenName
+		err = &MFARequiredError{TokenName: output.TokenName}
+
 		return
 	}
 
@@ -341,8 +382,7 @@ func SignIn(input SignInInput) (output SignInOutput, err error) {
 	// request token
 	var tokenResp signInResponse
 
-	var requestTokenFailure errorResponse
-	tokenResp, requestTokenFailure, err = requestToken(httpClient, signInInput{
+	tokenResp, err = c.requestToken(ctx, signInInput{
 		email:       input.Email,
 		encPassword: encPassword,
 		tokenName:   input.TokenName,
@@ -351,11 +391,11 @@ func SignIn(input SignInInput) (output SignInOutput, err error) {
 	})
 
 	if err != nil {
-		return
-	}
+		var mfaErr *MFARequiredError
+		if errors.As(err, &mfaErr) {
+			output.TokenName = mfaErr.TokenName
+		}
 
-	if requestTokenFailure.Error.Message != "" {
-		err = fmt.Errorf(strings.ToLower(requestTokenFailure.Error.Message))
 		return
 	}
 
@@ -363,6 +403,15 @@ func SignIn(input SignInInput) (output SignInOutput, err error) {
 	output.Session.Ak = ak
 	output.Session.Token = tokenResp.Token
 	output.Session.Server = input.APIServer
+	output.Session.Version = getAuthParamsOutput.Version
+	output.Session.UserUUID = tokenResp.User.UUID
+	output.Session.KeyParams = getAuthParamsOutput.KeyParams
+	output.Session.CreatedAt = time.Now().UTC()
+
+	// items are encrypted with the default items key, so create one if requested and the account has none
+	if input.EnsureItemsKey {
+		err = c.ensureDefaultItemsKey(ctx, &output.Session, input.Debug)
+	}
 
 	return output, err
 }
@@ -422,15 +471,37 @@ func processDoRegisterRequestResponse(response *http.Response, debug bool) (toke
 // Register creates a new user token
 // Params: email, password, pw_cost, pw_nonce, version
 func (input RegisterInput) Register() (token string, err error) {
-	var pw, pwNonce string
-	pw, pwNonce, err = generateInitialKeysAndAuthParamsForUser(input.Email, input.Password)
+	return defaultClient.Register(input)
+}
+
+// RegisterWithContext is Register with a context that can cancel the request made
+func (input RegisterInput) RegisterWithContext(ctx context.Context) (token string, err error) {
+	return defaultClient.RegisterWithContext(ctx, input)
+}
+
+// Register creates a new user token
+func (c *Client) Register(input RegisterInput) (token string, err error) {
+	return c.RegisterWithContext(context.Background(), input)
+}
+
+// RegisterWithContext is Register with a context that can cancel the request made
+func (c *Client) RegisterWithContext(ctx context.Context, input RegisterInput) (token string, err error) {
+	if input.APIServer == "" {
+		input.APIServer = c.server
+	}
+
+	var pw, mk, ak, pwNonce string
+	pw, mk, ak, pwNonce, err = generateInitialKeysAndAuthParamsForUser(input.Email, input.Password)
+	if err != nil {
+		return
+	}
 
 	var req *http.Request
 
 	reqBody := `{"email":"` + input.Email + `","identifier":"` + input.Email + `","password":"` + pw + `","pw_cost":"` + strconv.Itoa(defaultPasswordCost) + `","pw_nonce":"` + pwNonce + `","version":"` + defaultSNVersion + `"}`
 	reqBodyBytes := []byte(reqBody)
 
-	req, err = http.NewRequest(http.MethodPost, input.APIServer+authRegisterPath, bytes.NewBuffer(reqBodyBytes))
+	req, err = c.newRequest(ctx, http.MethodPost, input.APIServer+authRegisterPath, bytes.NewBuffer(reqBodyBytes))
 	if err != nil {
 		return
 	}
@@ -442,7 +513,7 @@ func (input RegisterInput) Register() (token string, err error) {
 
 	var response *http.Response
 
-	response, err = httpClient.Do(req)
+	response, err = c.httpClient.Do(req)
 	if err != nil {
 		return
 	}
@@ -458,10 +529,19 @@ func (input RegisterInput) Register() (token string, err error) {
 		return
 	}
 
+	// create the account's default items key, used to encrypt its items
+	_, err = c.CreateItemsKeyWithContext(ctx, &Session{
+		Token:   token,
+		Mk:      mk,
+		Ak:      ak,
+		Server:  input.APIServer,
+		Version: defaultSNVersion,
+	}, input.Debug)
+
 	return token, err
 }
 
-func generateInitialKeysAndAuthParamsForUser(email, password string) (pw, pwNonce string, err error) {
+func generateInitialKeysAndAuthParamsForUser(email, password string) (pw, mk, ak, pwNonce string, err error) {
 	var genInput generateEncryptedPasswordInput
 	genInput.userPassword = password
 	genInput.Version = defaultSNVersion
@@ -477,14 +557,22 @@ func generateInitialKeysAndAuthParamsForUser(email, password string) (pw, pwNonc
 
 	genInput.PasswordNonce = string(b)
 	pwNonce = string(b)
-	pw, _, _, err = generateEncryptedPasswordAndKeys(genInput)
+	pw, mk, ak, err = generateEncryptedPasswordAndKeys(genInput)
 
 	return
 }
 
 // CLiSignIn takes the server URL and credentials and sends them to the API to get a response including
 // an authentication token plus the keys required to encrypt and decrypt SN items
-func CliSignIn(email, password, apiServer string) (session Session, err error) {
+// The MFA token, if required, is requested from the prompter
+func CliSignIn(email, password, apiServer string, p Prompter) (session Session, err error) {
+	return defaultClient.CliSignIn(email, password, apiServer, p)
+}
+
+// CliSignIn takes the server URL and credentials and sends them to the API to get a response including
+// an authentication token plus the keys required to encrypt and decrypt SN items
+// The MFA token, if required, is requested from the prompter
+func (c *Client) CliSignIn(email, password, apiServer string, p Prompter) (session Session, err error) {
 	sInput := SignInInput{
 		Email:     email,
 		Password:  password,
@@ -494,31 +582,31 @@ func CliSignIn(email, password, apiServer string) (session Session, err error) {
 	// attempt sign-in without MFA
 	var sioNoMFA SignInOutput
 
-	sioNoMFA, err = SignIn(sInput)
-	if err != nil {
+	sioNoMFA, err = c.SignIn(sInput)
+
+	var mfaErr *MFARequiredError
+	if err != nil && !errors.As(err, &mfaErr) {
 		return
 	}
-	// return session if auth and master key returned
-	if sioNoMFA.Session.Ak != "" && sioNoMFA.Session.Mk != "" {
+	// return session if keys returned
+	if sioNoMFA.Session.Valid() {
 		return sioNoMFA.Session, err
 	}
 
-	if sioNoMFA.TokenName != "" {
+	if mfaErr != nil {
 		// MFA token value required, so request
 		var tokenValue string
 
-		fmt.Print("token: ")
-
-		_, err = fmt.Scanln(&tokenValue)
+		tokenValue, err = prompt(p, PromptMFAToken, false)
 		if err != nil {
 			return
 		}
 		// TODO: handle missing TokenName and Session
 		// add token name and value to sign-in input
-		sInput.TokenName = sioNoMFA.TokenName
+		sInput.TokenName = mfaErr.TokenName
 		sInput.TokenVal = strings.TrimSpace(tokenValue)
 
-		sOutTwo, sErrTwo := SignIn(sInput)
+		sOutTwo, sErrTwo := c.SignIn(sInput)
 		if sErrTwo != nil {
 			return session, sErrTwo
 		}
@@ -531,7 +619,8 @@ func CliSignIn(email, password, apiServer string) (session Session, err error) {
 
 func (s *Session) Valid() bool {
 	switch {
-	case s.Ak == "":
+	case s.Ak == "" && s.Version != "004" && s.Version != "001":
+		// 001 and 004 keys do not include an auth key
 		return false
 	case s.Mk == "":
 		return false
@@ -543,3 +632,418 @@ func (s *Session) Valid() bool {
 
 	return true
 }
+
+// ChangePasswordInput defines the input for changing an account's password
+type ChangePasswordInput struct {
+	Session         Session
+	Email           string
+	CurrentPassword string
+	NewPassword     string
+	TokenName       string
+	TokenVal        string
+	// set to the NewKeyParams returned by an interrupted attempt to resume it
+	NewKeyParams *KeyParams
+	Debug        bool
+}
+
+// ChangePasswordOutput defines the output from changing an account's password
+type ChangePasswordOutput struct {
+	Session Session
+	// returned even if the change fails so that it can be resumed
+	NewKeyParams KeyParams
+	// number of items re-encrypted with the new keys
+	ReEncrypted int
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	KeyParams
+}
+
+// ChangePassword derives new keys from the new password, re-encrypts the item keys of all items
+// (or the items keys) with them, and then changes the password on the server
+// Items already encrypted with the new keys are skipped, so an interrupted change can be
+// resumed by repeating the call with NewKeyParams set to those returned by the failed attempt
+func ChangePassword(input ChangePasswordInput) (output ChangePasswordOutput, err error) {
+	return defaultClient.ChangePassword(input)
+}
+
+// ChangePasswordWithContext is ChangePassword with a context that can cancel the requests made
+func ChangePasswordWithContext(ctx context.Context, input ChangePasswordInput) (output ChangePasswordOutput, err error) {
+	return defaultClient.ChangePasswordWithContext(ctx, input)
+}
+
+// ChangePassword derives new keys from the new password, re-encrypts the item keys of all items
+// (or the items keys) with them, and then changes the password on the server
+func (c *Client) ChangePassword(input ChangePasswordInput) (output ChangePasswordOutput, err error) {
+	return c.ChangePasswordWithContext(context.Background(), input)
+}
+
+// ChangePasswordWithContext is ChangePassword with a context that can cancel the requests made
+func (c *Client) ChangePasswordWithContext(ctx context.Context, input ChangePasswordInput) (output ChangePasswordOutput, err error) {
+	if !input.Session.Valid() {
+		err = ErrSessionInvalid
+		return
+	}
+
+	if input.NewPassword == "" {
+		err = fmt.Errorf("new password not defined")
+		return
+	}
+
+	// get the current key params and derive the current keys
+	var currentParams authParamsOutput
+
+	currentParams, err = c.getAuthParams(ctx, authParamsInput{
+		email:         input.Email,
+		tokenName:     input.TokenName,
+		tokenValue:    input.TokenVal,
+		authParamsURL: input.Session.Server + authParamsPath,
+		debug:         input.Debug,
+	})
+	if err != nil {
+		err = c.processConnectionFailure(err, input.Session.Server+authParamsPath)
+		return
+	}
+
+	if currentParams.TokenName != "" {
+		err = &MFARequiredError{TokenName: currentParams.TokenName}
+		return
+	}
+
+	var currentPw, currentMk, currentAk string
+
+	currentPw, currentMk, currentAk, err = generateEncryptedPasswordAndKeys(generateEncryptedPasswordInput{
+		userPassword:     input.CurrentPassword,
+		authParamsOutput: currentParams,
+	})
+	if err != nil {
+		return
+	}
+
+	if currentMk != input.Session.Mk {
+		err = fmt.Errorf("current password is incorrect")
+		return
+	}
+
+	// generate, or reuse, the new key params and derive the new keys
+	if input.NewKeyParams != nil {
+		output.NewKeyParams = *input.NewKeyParams
+	} else {
+		output.NewKeyParams = newKeyParams(currentParams.KeyParams)
+	}
+
+	if isLegacyVersion(output.NewKeyParams.Version) {
+		err = fmt.Errorf("unable to change the password to protocol version %s", output.NewKeyParams.Version)
+		return
+	}
+
+	var newPw, newMk, newAk string
+
+	newPw, newMk, newAk, err = generateEncryptedPasswordAndKeys(generateEncryptedPasswordInput{
+		userPassword:     input.NewPassword,
+		authParamsOutput: authParamsOutput{KeyParams: output.NewKeyParams},
+	})
+	if err != nil {
+		return
+	}
+
+	// re-encrypt any item keys not already encrypted with the new keys
+	var gio GetItemsOutput
+
+	gio, err = c.GetItemsWithContext(ctx, GetItemsInput{
+		Session: input.Session,
+		Debug:   input.Debug,
+	})
+	if err != nil {
+		return
+	}
+
+	var reEncrypted EncryptedItems
+
+	reEncrypted, err = reEncryptItemKeys(gio.Items, currentMk, currentAk, newMk, newAk,
+		output.NewKeyParams, input.Debug)
+	if err != nil {
+		return
+	}
+
+	// the re-encrypted items are put with the new keys, as they're no longer encrypted with the current ones
+	newSession := input.Session
+	newSession.Mk = newMk
+	newSession.Ak = newAk
+	newSession.Version = output.NewKeyParams.Version
+	newSession.KeyParams = output.NewKeyParams
+
+	if len(reEncrypted) > 0 {
+		_, err = c.PutItemsWithContext(ctx, PutItemsInput{
+			Items:   reEncrypted,
+			Session: newSession,
+			Debug:   input.Debug,
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	output.ReEncrypted = len(reEncrypted)
+
+	// finally, change the password on the server
+	var token string
+
+	token, err = c.doChangePasswordRequest(ctx, input.Session, changePasswordRequest{
+		CurrentPassword: currentPw,
+		NewPassword:     newPw,
+		KeyParams:       output.NewKeyParams,
+	}, input.Debug)
+	if err != nil {
+		return
+	}
+
+	output.Session = newSession
+
+	if token != "" {
+		output.Session.Token = token
+	}
+
+	return output, err
+}
+
+// newKeyParams returns key params with a new nonce, using the current version
+// unless it's a legacy version, in which case the default is used
+func newKeyParams(current KeyParams) KeyParams {
+	nonceBytes := make([]byte, 32)
+
+	_, err := crand.Read(nonceBytes)
+	if err != nil {
+		panic(err)
+	}
+
+	kp := KeyParams{
+		Identifier:    current.Identifier,
+		PasswordNonce: hex.EncodeToString(nonceBytes),
+		Version:       current.Version,
+	}
+
+	if kp.Version != "004" {
+		kp.Version = defaultSNVersion
+		kp.PasswordCost = defaultPasswordCost
+	}
+
+	return kp
+}
+
+// reEncryptItemKeys returns the items whose item keys are encrypted with the current root keys, with the item keys
+// re-encrypted using the new root keys derived with the new key params. Items using an items key are unaffected.
+// Legacy items are fully re-encrypted as their item keys cannot be re-encrypted independently of their content,
+// as are 004 items keys, whose content is bound to the key params.
+func reEncryptItemKeys(ei EncryptedItems, currentMk, currentAk, newMk, newAk string, newKeyParams KeyParams,
+	debug bool) (o EncryptedItems, err error) {
+	for _, eItem := range ei {
+		if eItem.Deleted || eItem.EncItemKey == "" || eItem.ItemsKeyID != "" {
+			continue
+		}
+
+		// skip items already re-encrypted by an earlier attempt
+		if _, dErr := decryptString(eItem.EncItemKey, newMk, newAk, eItem.UUID); dErr == nil {
+			continue
+		}
+
+		reItem := eItem
+
+		switch {
+		case isLegacyVersion(eItem.Version()):
+			var di DecryptedItem
+
+			di, err = decryptItem(eItem, currentMk, currentAk)
+			if err != nil {
+				return
+			}
+
+			reItem.AuthHash = ""
+
+			reItem.Content, reItem.EncItemKey, err = encryptContent(di.Content, newKeyParams.Version, newMk, newAk, eItem.UUID)
+			if err != nil {
+				return
+			}
+		case newKeyParams.Version == "004" && eItem.ContentType == itemsKeyContentType:
+			// the root key's params are bound to both the content and item key of items keys, so both are re-encrypted
+			var di DecryptedItem
+
+			di, err = decryptItem(eItem, currentMk, currentAk)
+			if err != nil {
+				return
+			}
+
+			reItem.Content, reItem.EncItemKey, err = encryptContent004(di.Content, newMk, eItem.UUID, &newKeyParams)
+			if err != nil {
+				return
+			}
+		default:
+			var itemKey string
+
+			itemKey, err = decryptString(eItem.EncItemKey, currentMk, currentAk, eItem.UUID)
+			if err != nil {
+				return
+			}
+
+			if newKeyParams.Version == "004" {
+				reItem.EncItemKey, err = encryptString004(itemKey, newMk, eItem.UUID, nil, nil)
+			} else {
+				reItem.EncItemKey, err = encryptString(itemKey, newMk, newAk, eItem.UUID, nil)
+			}
+
+			if err != nil {
+				return
+			}
+		}
+
+		debugPrint(debug, fmt.Sprintf("reEncryptItemKeys | re-encrypted key for item: %s", eItem.UUID))
+
+		o = append(o, reItem)
+	}
+
+	return o, err
+}
+
+func (c *Client) doChangePasswordRequest(ctx context.Context, session Session, input changePasswordRequest, debug bool) (token string, err error) {
+	var reqBody []byte
+
+	reqBody, err = json.Marshal(input)
+	if err != nil {
+		return
+	}
+
+	var req *http.Request
+
+	req, err = c.newRequest(ctx, http.MethodPost, session.Server+changePasswordPath, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+
+	var response *http.Response
+
+	response, err = c.httpClient.Do(req)
+	if err != nil {
+		err = c.processConnectionFailure(err, session.Server+changePasswordPath)
+		return
+	}
+
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			fmt.Println("failed to close response:", err)
+		}
+	}()
+
+	var body []byte
+
+	body, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+
+	c.debugPrint(debug, fmt.Sprintf("doChangePasswordRequest | response: %s", response.Status))
+
+	if response.StatusCode != http.StatusOK {
+		err = newAPIError(response.StatusCode, body)
+		return
+	}
+
+	var resp signInResponse
+
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return
+	}
+
+	return resp.Token, err
+}
+
+// SignOutInput defines the session to sign out of and, optionally, the store holding it
+type SignOutInput struct {
+	Session Session
+	Store   SessionStore // store to remove the session from, if any
+	Profile string       // profile of the stored session, defaulting to the active profile
+	Debug   bool
+}
+
+// SignOut revokes the session's token on the server and then removes the session from the store, if specified
+// Both steps are attempted and a SignOutError is returned reporting any that failed
+func SignOut(input SignOutInput) error {
+	return defaultClient.SignOut(input)
+}
+
+// SignOutWithContext is SignOut with a context that can cancel the request made
+func SignOutWithContext(ctx context.Context, input SignOutInput) error {
+	return defaultClient.SignOutWithContext(ctx, input)
+}
+
+// SignOut revokes the session's token on the server and then removes the session from the store, if specified
+// Both steps are attempted and a SignOutError is returned reporting any that failed
+func (c *Client) SignOut(input SignOutInput) error {
+	return c.SignOutWithContext(context.Background(), input)
+}
+
+// SignOutWithContext is SignOut with a context that can cancel the request made
+func (c *Client) SignOutWithContext(ctx context.Context, input SignOutInput) error {
+	var soErr SignOutError
+
+	soErr.RevokeErr = c.doSignOutRequest(ctx, input.Session, input.Debug)
+	// a token the server no longer accepts has already been revoked
+	if errors.Is(soErr.RevokeErr, ErrUnauthorized) || errors.Is(soErr.RevokeErr, ErrSessionExpired) {
+		soErr.RevokeErr = nil
+	}
+
+	if input.Store != nil {
+		soErr.RemoveErr = RemoveProfile(input.Store, input.Profile)
+		if errors.Is(soErr.RemoveErr, ErrSessionNotFound) {
+			soErr.RemoveErr = nil
+		}
+	}
+
+	if soErr.RevokeErr != nil || soErr.RemoveErr != nil {
+		return &soErr
+	}
+
+	return nil
+}
+
+func (c *Client) doSignOutRequest(ctx context.Context, session Session, debug bool) (err error) {
+	if session.Token == "" || session.Server == "" {
+		return ErrSessionInvalid
+	}
+
+	var req *http.Request
+
+	req, err = c.newRequest(ctx, http.MethodPost, session.Server+signOutPath, nil)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+
+	var response *http.Response
+
+	response, err = c.httpClient.Do(req)
+	if err != nil {
+		return c.processConnectionFailure(err, session.Server+signOutPath)
+	}
+
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			fmt.Println("failed to close response:", err)
+		}
+	}()
+
+	c.debugPrint(debug, fmt.Sprintf("doSignOutRequest | response: %s", response.Status))
+
+	if response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(response.Body)
+		err = newAPIError(response.StatusCode, body)
+	}
+
+	return err
+}
@@ -1,11 +1,18 @@
 package gosn
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jonhadfield/gosn/gosntest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,6 +43,143 @@ func TestGenerateEncryptedPasswordWithInvalidPasswordCostForVersion003(t *testin
 	assert.Error(t, err)
 }
 
+func TestGenerateEncryptedPasswordAndKeysForVersion004(t *testing.T) {
+	var testInput generateEncryptedPasswordInput
+	testInput.userPassword = "oWB7c&77Zahw8XK$AUy#"
+	testInput.Identifier = "soba@lessknown.co.uk"
+	testInput.PasswordNonce = "9e88fc67fb8b1efe92deeb98b5b6a801c78bdfae08eecb315f843f6badf60aef"
+	testInput.Version = "004"
+	pw, mk, ak, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.NoError(t, err)
+	assert.Len(t, pw, 64)
+	assert.Len(t, mk, 64)
+	assert.Empty(t, ak)
+
+	// derivation must be deterministic for the same params
+	pwTwo, mkTwo, _, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.NoError(t, err)
+	assert.Equal(t, pw, pwTwo)
+	assert.Equal(t, mk, mkTwo)
+
+	// and differ when the nonce changes
+	testInput.PasswordNonce = "8e88fc67fb8b1efe92deeb98b5b6a801c78bdfae08eecb315f843f6badf60aef"
+	pwThree, _, _, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.NoError(t, err)
+	assert.NotEqual(t, pw, pwThree)
+}
+
+func TestGenerateEncryptedPasswordAndKeysForVersion004WithoutNonce(t *testing.T) {
+	var testInput generateEncryptedPasswordInput
+	testInput.userPassword = "oWB7c&77Zahw8XK$AUy#"
+	testInput.Identifier = "soba@lessknown.co.uk"
+	testInput.Version = "004"
+	_, _, _, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.Error(t, err)
+}
+
+func TestGenerateEncryptedPasswordAndKeysForLegacyVersions(t *testing.T) {
+	var testInput generateEncryptedPasswordInput
+	testInput.userPassword = "oWB7c&77Zahw8XK$AUy#"
+	testInput.Identifier = "soba@lessknown.co.uk"
+	testInput.PasswordSalt = "2bb6b1c1d7e9cf4f1b6e3f5e8ec2ec0a86fdaf5c"
+	testInput.PasswordCost = 5000
+	testInput.Version = "002"
+	pw, mk, ak, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.NoError(t, err)
+	assert.Len(t, pw, 64)
+	assert.Len(t, mk, 64)
+	assert.Len(t, ak, 64)
+
+	// 001 uses the same derivation, but without an auth key
+	testInput.Version = "001"
+	pwOne, mkOne, akOne, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.NoError(t, err)
+	assert.Equal(t, pw, pwOne)
+	assert.Equal(t, mk, mkOne)
+	assert.Empty(t, akOne)
+
+	testInput.PasswordSalt = ""
+	_, _, _, err = generateEncryptedPasswordAndKeys(testInput)
+	assert.Error(t, err)
+}
+
+func TestReEncryptItemKeys(t *testing.T) {
+	currentMk := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	currentAk := "aca431d6fc360e46e853e19d70afec26e4825e2609c2e6df9f4431cbd344e1bc"
+	newMk := "32bf6c2eceb0a875a17390f34feba0386c641c74d35fb29112a7be4a21cbf974"
+	newAk := "530fb9cae9586177d4a00c32332dc151f87a97c9d04cdda6c28e70c2ef747a3f"
+
+	noteContent := NewNoteContent()
+	noteContent.Title = "Title"
+	noteContent.Text = "Text"
+	noteOne := NewNote()
+	noteOne.Content = noteContent
+	noteTwo := noteOne.Copy()
+	noteTwo.UUID = GenUUID()
+
+	currentItems := Items{*noteOne}
+	current, err := currentItems.Encrypt(currentMk, currentAk, false)
+	assert.NoError(t, err)
+	// simulate an item re-encrypted by an interrupted attempt
+	doneItems := Items{*noteTwo}
+	alreadyDone, err := doneItems.Encrypt(newMk, newAk, false)
+	assert.NoError(t, err)
+
+	reEncrypted, err := reEncryptItemKeys(append(current, alreadyDone...), currentMk, currentAk, newMk, newAk,
+		KeyParams{Version: "003"}, false)
+	assert.NoError(t, err)
+	assert.Len(t, reEncrypted, 1)
+	assert.Equal(t, noteOne.UUID, reEncrypted[0].UUID)
+	// content is unchanged as only the item key is re-encrypted
+	assert.Equal(t, current[0].Content, reEncrypted[0].Content)
+
+	items, err := append(reEncrypted, alreadyDone...).DecryptAndParse(newMk, newAk, false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Text", items[0].Content.GetText())
+}
+
+func TestReEncryptItemKeysRebinds004ItemsKeys(t *testing.T) {
+	currentMk := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	newMk := "32bf6c2eceb0a875a17390f34feba0386c641c74d35fb29112a7be4a21cbf974"
+	currentKp := KeyParams{Identifier: "me@example.com", PasswordNonce: "current", Version: "004"}
+	newKp := KeyParams{Identifier: "me@example.com", PasswordNonce: "new", Version: "004"}
+
+	ik := NewItemsKey()
+	eik, err := ik.Encrypt(currentMk, "", currentKp)
+	assert.NoError(t, err)
+
+	reEncrypted, err := reEncryptItemKeys(EncryptedItems{eik}, currentMk, "", newMk, "", newKp, false)
+	assert.NoError(t, err)
+	assert.Len(t, reEncrypted, 1)
+
+	// both the content and item key are bound to the new key params
+	assert.Equal(t, eik.UUID, reEncrypted[0].UUID)
+	assert.Equal(t, reEncrypted[0].Content[strings.LastIndex(reEncrypted[0].Content, ":"):],
+		reEncrypted[0].EncItemKey[strings.LastIndex(reEncrypted[0].EncItemKey, ":"):])
+
+	ad, err := base64.StdEncoding.DecodeString(reEncrypted[0].Content[strings.LastIndex(reEncrypted[0].Content, ":")+1:])
+	assert.NoError(t, err)
+	assert.Contains(t, string(ad), `"pw_nonce":"new"`)
+
+	iks, err := reEncrypted.DecryptItemsKeys(newMk, "")
+	assert.NoError(t, err)
+	assert.Equal(t, ItemsKeys{ik}, iks)
+}
+
+func TestNewKeyParams(t *testing.T) {
+	kp := newKeyParams(KeyParams{Identifier: "me@example.com", Version: "002", PasswordSalt: "salt", PasswordCost: 5000})
+	assert.Equal(t, "me@example.com", kp.Identifier)
+	assert.Equal(t, "003", kp.Version)
+	assert.Equal(t, int64(defaultPasswordCost), kp.PasswordCost)
+	assert.Len(t, kp.PasswordNonce, 64)
+	assert.Empty(t, kp.PasswordSalt)
+
+	kp = newKeyParams(KeyParams{Identifier: "me@example.com", Version: "004"})
+	assert.Equal(t, "004", kp.Version)
+	assert.Zero(t, kp.PasswordCost)
+}
+
 // server required for following tests
 func TestSignIn(t *testing.T) {
 	sOutput, err := SignIn(sInput)
@@ -100,6 +244,7 @@ func TestSignInWithBadPassword(t *testing.T) {
 	_, err := SignIn(sInput)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid email or password")
+	assert.True(t, errors.Is(err, ErrUnauthorized))
 }
 
 func TestSignInWithUnresolvableHost(t *testing.T) {
@@ -112,6 +257,11 @@ func TestSignInWithUnresolvableHost(t *testing.T) {
 	_, err := SignIn(sInput)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "standardnotes.example.com cannot be resolved")
+
+	var connErr *ConnectionError
+
+	assert.True(t, errors.As(err, &connErr))
+	assert.Equal(t, "https://standardnotes.example.com:443/auth/params", connErr.URL)
 }
 
 func TestSignInWithInvalidURL(t *testing.T) {
@@ -126,6 +276,23 @@ func TestSignInWithInvalidURL(t *testing.T) {
 	assert.Contains(t, err.Error(), "protocol is missing from API server URL: standardnotes.example.com")
 }
 
+func TestSignInWithContextDeadlineExceeded(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := SignInWithContext(ctx, SignInInput{
+		Email:     "sn@lessknown.co.uk",
+		Password:  "invalid",
+		APIServer: ts.URL,
+	})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
 //func TestSignInWithServerActivelyRefusing(t *testing.T) {
 //	password := "invalid"
 //	sInput := SignInInput{
@@ -150,3 +317,206 @@ func TestSignInWithUnavailableServer(t *testing.T) {
 	assert.Equal(t, err.Error(), fmt.Sprintf("failed to connect to %s within %d seconds",
 		"https://10.10.10.10:6000/auth/params", connectionTimeout))
 }
+
+func TestSignInWithMFA(t *testing.T) {
+	email, _ := signInNewTestUser(t, "secret")
+	assert.NoError(t, testServer.EnableMFA(email, "mfa_test", "123456"))
+
+	input := SignInInput{
+		Email:     email,
+		Password:  "secret",
+		APIServer: testServer.URL,
+	}
+
+	out, err := SignIn(input)
+	assert.True(t, errors.Is(err, ErrMFARequired))
+
+	var mfaErr *MFARequiredError
+
+	assert.True(t, errors.As(err, &mfaErr))
+	assert.Equal(t, "mfa_test", mfaErr.TokenName)
+	assert.Equal(t, "mfa_test", out.TokenName)
+	assert.False(t, out.Session.Valid())
+
+	input.TokenName = out.TokenName
+	input.TokenVal = "123456"
+
+	out, err = SignIn(input)
+	assert.NoError(t, err)
+	assert.True(t, out.Session.Valid())
+}
+
+func TestChangePassword(t *testing.T) {
+	email, session := signInNewTestUser(t, "secret")
+
+	notes := Items{*createNote("one", "one", ""), *createNote("two", "two", "")}
+	eNotes, err := notes.Encrypt(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eNotes})
+	assert.NoError(t, err)
+
+	_, err = ChangePassword(ChangePasswordInput{
+		Session:         session,
+		Email:           email,
+		CurrentPassword: "wrong",
+		NewPassword:     "new-secret",
+	})
+	assert.EqualError(t, err, "current password is incorrect")
+
+	out, err := ChangePassword(ChangePasswordInput{
+		Session:         session,
+		Email:           email,
+		CurrentPassword: "secret",
+		NewPassword:     "new-secret",
+	})
+	assert.NoError(t, err)
+	// the notes and the default items key created on sign-in
+	assert.Equal(t, 3, out.ReEncrypted)
+
+	sOut, err := SignIn(SignInInput{Email: email, Password: "new-secret", APIServer: testServer.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, out.Session.Mk, sOut.Session.Mk)
+
+	gio, err := GetItems(GetItemsInput{Session: sOut.Session})
+	assert.NoError(t, err)
+
+	items, err := gio.Items.DecryptAndParse(sOut.Session.Mk, sOut.Session.Ak, false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+}
+
+func TestChangePasswordResumesUpgradeOf001Account(t *testing.T) {
+	if testServer == nil {
+		t.Skip("requires the in-memory server")
+	}
+
+	email := fmt.Sprintf("%s@example.com", GenUUID())
+	kp := KeyParams{Identifier: email, PasswordSalt: "2bb6b1c1d7e9cf4f1b6e3f5e8ec2ec0a86fdaf5c", PasswordCost: 3000, Version: "001"}
+
+	pw, mk, _, err := generateEncryptedPasswordAndKeys(generateEncryptedPasswordInput{
+		userPassword:     "secret",
+		authParamsOutput: authParamsOutput{KeyParams: kp},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, testServer.AddUser(email, pw, gosntest.KeyParams{
+		PasswordSalt: kp.PasswordSalt,
+		PasswordCost: kp.PasswordCost,
+		Version:      kp.Version,
+	}))
+
+	legacy := encryptItem001(t, GenUUID(), `{"title":"Legacy note","text":"Written in 2016","references":[]}`, mk)
+	_, err = testServer.UpsertItem(email, gosntest.Item{
+		UUID:        legacy.UUID,
+		Content:     legacy.Content,
+		ContentType: legacy.ContentType,
+		EncItemKey:  legacy.EncItemKey,
+		AuthHash:    legacy.AuthHash,
+		CreatedAt:   legacy.CreatedAt,
+		UpdatedAt:   legacy.UpdatedAt,
+	})
+	assert.NoError(t, err)
+
+	sOut, err := SignIn(SignInInput{Email: email, Password: "secret", APIServer: testServer.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, "001", sOut.Session.Version)
+
+	// interrupt the change after the items are re-encrypted, but before the password is changed
+	interrupted := NewClient(ClientConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == changePasswordPath {
+				return nil, errors.New("connection reset")
+			}
+
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	})
+
+	input := ChangePasswordInput{
+		Session:         sOut.Session,
+		Email:           email,
+		CurrentPassword: "secret",
+		NewPassword:     "new-secret",
+	}
+
+	out, err := interrupted.ChangePassword(input)
+	assert.Error(t, err)
+	assert.Equal(t, 1, out.ReEncrypted)
+	assert.Equal(t, "003", out.NewKeyParams.Version)
+
+	stored := testServer.Items(email)
+	assert.Len(t, stored, 1)
+	assert.Equal(t, "003", EncryptedItem{Content: stored[0].Content}.Version())
+
+	// resuming with the same key params completes the change without re-encrypting the item again
+	input.NewKeyParams = &out.NewKeyParams
+
+	out, err = ChangePassword(input)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, out.ReEncrypted)
+	assert.Equal(t, "003", out.Session.Version)
+
+	sOut, err = SignIn(SignInInput{Email: email, Password: "new-secret", APIServer: testServer.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, out.Session.Mk, sOut.Session.Mk)
+
+	gio, err := GetItems(GetItemsInput{Session: sOut.Session})
+	assert.NoError(t, err)
+
+	items, err := gio.Items.DecryptAndParse(sOut.Session.Mk, sOut.Session.Ak, false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Written in 2016", items[0].Content.GetText())
+}
+
+func TestSignOut(t *testing.T) {
+	email, session := signInNewTestUser(t, "secret")
+
+	store := NewMemorySessionStore()
+	assert.NoError(t, writeProfileSession(store, "test", makeSessionString(email, session)))
+
+	assert.NoError(t, SignOut(SignOutInput{Session: session, Store: store, Profile: "test"}))
+	assert.True(t, errors.Is(ValidateSession(session), ErrUnauthorized))
+
+	profiles, _, err := ListProfiles(store)
+	assert.NoError(t, err)
+	assert.Empty(t, profiles)
+
+	// signing out of a revoked session succeeds
+	assert.NoError(t, SignOut(SignOutInput{Session: session}))
+}
+
+func TestSignOutPartialFailure(t *testing.T) {
+	c := NewClient(ClientConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(req, http.StatusInternalServerError, nil), nil
+		}),
+	})
+
+	assert.NoError(t, os.Setenv("GOSN_TEST_SESSION", testSession))
+
+	defer os.Unsetenv("GOSN_TEST_SESSION")
+
+	err := c.SignOut(SignOutInput{
+		Session: Session{Token: "token", Server: "https://sn.example.com"},
+		Store:   EnvSessionStore{Prefix: "GOSN_TEST"},
+	})
+
+	var soErr *SignOutError
+
+	assert.True(t, errors.As(err, &soErr))
+	assert.Error(t, soErr.RevokeErr)
+	assert.Error(t, soErr.RemoveErr)
+	assert.Contains(t, err.Error(), "failed to revoke session token")
+	assert.Contains(t, err.Error(), "failed to remove stored session")
+
+	// only the failed step is reported
+	store := NewMemorySessionStore()
+	assert.NoError(t, writeProfileSession(store, DefaultProfile, testSession))
+
+	err = c.SignOut(SignOutInput{Session: Session{Token: "token", Server: "https://sn.example.com"}, Store: store})
+	assert.True(t, errors.As(err, &soErr))
+	assert.Error(t, soErr.RevokeErr)
+	assert.NoError(t, soErr.RemoveErr)
+	assert.Error(t, SessionExists(store))
+}
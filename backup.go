@@ -0,0 +1,388 @@
+package gosn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// EncryptedBackup is the encrypted backup format exported and imported by the official apps
+// Backups of 004 accounts hold the key params as keyParams, and earlier versions as auth_params
+type EncryptedBackup struct {
+	Version    string         `json:"version,omitempty"`
+	Items      EncryptedItems `json:"items"`
+	KeyParams  *KeyParams     `json:"keyParams,omitempty"`
+	AuthParams *KeyParams     `json:"auth_params,omitempty"`
+}
+
+// keyParams returns the key params held in the backup, in either form
+func (eb EncryptedBackup) keyParams() (kp KeyParams, err error) {
+	switch {
+	case eb.KeyParams != nil:
+		kp = *eb.KeyParams
+	case eb.AuthParams != nil:
+		kp = *eb.AuthParams
+	default:
+		return kp, errors.New("backup does not include key params")
+	}
+
+	if kp.Version == "" {
+		kp.Version = eb.Version
+	}
+
+	return kp, err
+}
+
+// ExportEncryptedBackup writes the items, excluding any deleted, and the key params required to
+// derive the keys that decrypt them, in the encrypted backup format
+func ExportEncryptedBackup(w io.Writer, items EncryptedItems, keyParams KeyParams) (err error) {
+	backup := EncryptedBackup{
+		Version: keyParams.Version,
+		Items:   EncryptedItems{},
+	}
+
+	for _, item := range items {
+		if !item.Deleted {
+			backup.Items = append(backup.Items, item)
+		}
+	}
+
+	if keyParams.Version == "004" {
+		backup.KeyParams = &keyParams
+	} else {
+		backup.AuthParams = &keyParams
+	}
+
+	var b []byte
+
+	b, err = json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
+
+// ExportBackup retrieves all of the session's items and writes them in the encrypted backup format
+// The session must hold the key params returned when signing in
+func ExportBackup(session Session, w io.Writer, debug bool) error {
+	return defaultClient.ExportBackup(session, w, debug)
+}
+
+// ExportBackupWithContext is ExportBackup with a context that can cancel the requests made
+func ExportBackupWithContext(ctx context.Context, session Session, w io.Writer, debug bool) error {
+	return defaultClient.ExportBackupWithContext(ctx, session, w, debug)
+}
+
+// ExportBackup retrieves all of the session's items and writes them in the encrypted backup format
+// The session must hold the key params returned when signing in
+func (c *Client) ExportBackup(session Session, w io.Writer, debug bool) error {
+	return c.ExportBackupWithContext(context.Background(), session, w, debug)
+}
+
+// ExportBackupWithContext is ExportBackup with a context that can cancel the requests made
+func (c *Client) ExportBackupWithContext(ctx context.Context, session Session, w io.Writer, debug bool) (err error) {
+	if session.KeyParams.Version == "" {
+		return errors.New("session does not include key params, so sign in again to export a backup")
+	}
+
+	var output GetItemsOutput
+
+	output, err = c.GetItemsWithContext(ctx, GetItemsInput{
+		Session: session,
+		Debug:   debug,
+	})
+	if err != nil {
+		return
+	}
+
+	c.debugPrint(debug, fmt.Sprintf("ExportBackup | exporting %d items", len(output.Items)))
+
+	return ExportEncryptedBackup(w, output.Items, session.KeyParams)
+}
+
+// ReadEncryptedBackup reads a backup in the encrypted backup format
+func ReadEncryptedBackup(r io.Reader) (backup EncryptedBackup, err error) {
+	var b []byte
+
+	b, err = ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(b, &backup); err != nil {
+		err = fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	return
+}
+
+// ImportEncryptedBackup reads a backup in the encrypted backup format and decrypts its items with keys
+// derived from the password, returning the items, excluding items keys, ready to be encrypted and put
+func ImportEncryptedBackup(r io.Reader, password string, debug bool) (items Items, err error) {
+	return defaultClient.ImportEncryptedBackup(r, password, debug)
+}
+
+// ImportEncryptedBackup reads a backup in the encrypted backup format and decrypts its items with keys
+// derived from the password, returning the items, excluding items keys, ready to be encrypted and put
+func (c *Client) ImportEncryptedBackup(r io.Reader, password string, debug bool) (items Items, err error) {
+	var backup EncryptedBackup
+
+	backup, err = ReadEncryptedBackup(r)
+	if err != nil {
+		return
+	}
+
+	var kp KeyParams
+
+	kp, err = backup.keyParams()
+	if err != nil {
+		return
+	}
+
+	var mk, ak string
+
+	_, mk, ak, err = generateEncryptedPasswordAndKeys(generateEncryptedPasswordInput{
+		userPassword:     password,
+		authParamsOutput: authParamsOutput{KeyParams: kp},
+	})
+	if err != nil {
+		return
+	}
+
+	backup.Items.RemoveDeleted()
+
+	c.debugPrint(debug, fmt.Sprintf("ImportEncryptedBackup | decrypting %d items", len(backup.Items)))
+
+	var di DecryptedItems
+
+	di, err = backup.Items.Decrypt(mk, ak, debug)
+	if err != nil {
+		if errors.Is(err, ErrIntegrity) {
+			err = fmt.Errorf("failed to decrypt backup, the password may be incorrect: %w", err)
+		}
+
+		return
+	}
+
+	return di.Parse()
+}
+
+// decryptedBackupItem is an item in the decrypted backup format, where content is held as a JSON object
+type decryptedBackupItem struct {
+	UUID        string          `json:"uuid"`
+	ContentType string          `json:"content_type"`
+	Content     json.RawMessage `json:"content"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+// decryptedBackup is the decrypted backup format exported and imported by the official apps
+type decryptedBackup struct {
+	Items []decryptedBackupItem `json:"items"`
+}
+
+// ExportDecryptedBackup writes the items, excluding any deleted and items keys, in the decrypted backup format
+// Content of every type is written as is, so items of types without a content model are preserved
+func ExportDecryptedBackup(w io.Writer, items DecryptedItems) (err error) {
+	backup := decryptedBackup{
+		Items: []decryptedBackupItem{},
+	}
+
+	for _, item := range items {
+		if item.Deleted || item.ContentType == itemsKeyContentType {
+			continue
+		}
+
+		if !json.Valid([]byte(item.Content)) {
+			return fmt.Errorf("item %s of type %s does not have valid JSON content", item.UUID, item.ContentType)
+		}
+
+		backup.Items = append(backup.Items, decryptedBackupItem{
+			UUID:        item.UUID,
+			ContentType: item.ContentType,
+			Content:     json.RawMessage(item.Content),
+			CreatedAt:   item.CreatedAt,
+			UpdatedAt:   item.UpdatedAt,
+		})
+	}
+
+	var b []byte
+
+	b, err = json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
+
+// ImportDecryptedBackup reads a backup in the decrypted backup format, returning its items with their
+// UUIDs, references and timestamps intact
+// If regenerateUUIDs is true, then each item is given a new UUID and references to it are updated, so
+// the items can be imported into an account that already holds them
+func ImportDecryptedBackup(r io.Reader, regenerateUUIDs bool) (items DecryptedItems, err error) {
+	var b []byte
+
+	b, err = ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	var backup decryptedBackup
+
+	if err = json.Unmarshal(b, &backup); err != nil {
+		err = fmt.Errorf("failed to read backup: %w", err)
+		return
+	}
+
+	for _, bi := range backup.Items {
+		if bi.ContentType == itemsKeyContentType {
+			continue
+		}
+
+		content := string(bi.Content)
+
+		// content may also be held as a string containing the JSON
+		var s string
+		if json.Unmarshal(bi.Content, &s) == nil {
+			content = s
+		}
+
+		items = append(items, DecryptedItem{
+			UUID:        bi.UUID,
+			ContentType: bi.ContentType,
+			Content:     content,
+			CreatedAt:   bi.CreatedAt,
+			UpdatedAt:   bi.UpdatedAt,
+		})
+	}
+
+	if regenerateUUIDs {
+		err = items.regenerateUUIDs()
+	}
+
+	return items, err
+}
+
+// regenerateUUIDs gives each item a new UUID and rewrites the references between the items to match
+func (di DecryptedItems) regenerateUUIDs() (err error) {
+	uuids := make(map[string]string, len(di))
+
+	for _, item := range di {
+		uuids[item.UUID] = GenUUID()
+	}
+
+	for x := range di {
+		di[x].Content, err = rewriteContentUUIDs(di[x].Content, uuids)
+		if err != nil {
+			return fmt.Errorf("item %s: %w", di[x].UUID, err)
+		}
+
+		di[x].UUID = uuids[di[x].UUID]
+	}
+
+	return
+}
+
+// rewriteContentUUIDs replaces the UUIDs in the content's references, and component item associations,
+// with those they are mapped to
+// Other attributes of the content are retained as is
+func rewriteContentUUIDs(content string, uuids map[string]string) (string, error) {
+	var attrs map[string]json.RawMessage
+
+	if err := json.Unmarshal([]byte(content), &attrs); err != nil {
+		return content, fmt.Errorf("failed to read content: %w", err)
+	}
+
+	if raw, ok := attrs["references"]; ok {
+		var refs []map[string]json.RawMessage
+
+		if err := json.Unmarshal(raw, &refs); err != nil {
+			return content, fmt.Errorf("failed to read references: %w", err)
+		}
+
+		for _, ref := range refs {
+			var uuid string
+
+			if err := json.Unmarshal(ref["uuid"], &uuid); err != nil {
+				continue
+			}
+
+			if newUUID, ok := uuids[uuid]; ok {
+				ref["uuid"], _ = json.Marshal(newUUID)
+			}
+		}
+
+		attrs["references"], _ = json.Marshal(refs)
+	}
+
+	for _, name := range []string{"associatedItemIds", "disassociatedItemIds"} {
+		raw, ok := attrs[name]
+		if !ok {
+			continue
+		}
+
+		var ids []string
+
+		if err := json.Unmarshal(raw, &ids); err != nil {
+			return content, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		for x, id := range ids {
+			if newUUID, ok := uuids[id]; ok {
+				ids[x] = newUUID
+			}
+		}
+
+		attrs[name], _ = json.Marshal(ids)
+	}
+
+	b, err := json.Marshal(attrs)
+
+	return string(b), err
+}
+
+// Encrypt encrypts the items with the items key they specify, or the default, falling back to the
+// root keys, which must be 003 keys, if the account has none
+// Unlike Items, content of every type is encrypted as is
+func (di DecryptedItems) Encrypt(mk, ak string, iks ItemsKeys) (e EncryptedItems, err error) {
+	for _, item := range di {
+		if item.ContentType == itemsKeyContentType {
+			return nil, fmt.Errorf("items key \"%s\" must be encrypted with ItemsKey.Encrypt", item.UUID)
+		}
+
+		var key, authKey, keyVersion, itemsKeyID string
+
+		key, authKey, keyVersion, itemsKeyID, err = iks.keysForItem(Item{UUID: item.UUID, ItemsKeyID: item.ItemsKeyID},
+			mk, ak, defaultSNVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		ei := EncryptedItem{
+			UUID:        item.UUID,
+			ContentType: item.ContentType,
+			ItemsKeyID:  itemsKeyID,
+			Deleted:     item.Deleted,
+			CreatedAt:   item.CreatedAt,
+			UpdatedAt:   item.UpdatedAt,
+		}
+
+		ei.Content, ei.EncItemKey, err = encryptContent(item.Content, keyVersion, key, authKey, item.UUID)
+		if err != nil {
+			return
+		}
+
+		e = append(e, ei)
+	}
+
+	return
+}
@@ -0,0 +1,203 @@
+package gosn
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportEncryptedBackup(t *testing.T) {
+	_, session := signInNewTestUser(t, "secret")
+
+	// sign-in creates the default items key
+	_, ok := session.ItemsKeys.Default()
+	assert.True(t, ok)
+
+	notes := Items{*createNote("one", "one", ""), *createNote("two", "two", "")}
+	eNotes, err := notes.EncryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eNotes})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	assert.NoError(t, ExportBackup(session, &buf, false))
+
+	backup, err := ReadEncryptedBackup(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, session.KeyParams.Version, backup.Version)
+	// the items key is exported along with the notes
+	assert.Len(t, backup.Items, 3)
+
+	items, err := ImportEncryptedBackup(bytes.NewReader(buf.Bytes()), "secret", false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	for _, item := range items {
+		assert.Equal(t, "Note", item.ContentType)
+		assert.Contains(t, []string{"one", "two"}, item.Content.GetTitle())
+	}
+
+	logger := &testLogger{}
+	_, err = NewClient(ClientConfig{Logger: logger}).ImportEncryptedBackup(bytes.NewReader(buf.Bytes()), "secret", true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, logger.lines)
+
+	_, err = ImportEncryptedBackup(bytes.NewReader(buf.Bytes()), "wrong", false)
+	assert.True(t, errors.Is(err, ErrIntegrity))
+	assert.Contains(t, err.Error(), "password may be incorrect")
+}
+
+func TestExportEncryptedBackupFormat(t *testing.T) {
+	note := createEncryptedTestNote(t, "one", "one", "")
+	deleted := createEncryptedTestNote(t, "two", "two", "")
+	deleted.Deleted = true
+
+	var buf bytes.Buffer
+
+	assert.NoError(t, ExportEncryptedBackup(&buf, EncryptedItems{note, deleted},
+		KeyParams{Identifier: "me@example.com", PasswordNonce: "nonce", PasswordCost: 110000, Version: "003"}))
+	assert.Contains(t, buf.String(), `"auth_params": {`)
+	assert.NotContains(t, buf.String(), `"keyParams"`)
+
+	backup, err := ReadEncryptedBackup(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptedItems{note}, backup.Items)
+
+	buf.Reset()
+	assert.NoError(t, ExportEncryptedBackup(&buf, nil, KeyParams{Identifier: "me@example.com", Version: "004"}))
+	assert.Contains(t, buf.String(), `"keyParams": {`)
+	assert.Contains(t, buf.String(), `"items": []`)
+}
+
+func TestImportEncryptedBackupWithoutKeyParams(t *testing.T) {
+	_, err := ImportEncryptedBackup(strings.NewReader(`{"items":[]}`), "secret", false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not include key params")
+
+	_, err = ImportEncryptedBackup(strings.NewReader(`not json`), "secret", false)
+	assert.Error(t, err)
+}
+
+const testDecryptedBackup = `{
+  "items": [
+    {
+      "uuid": "note-uuid",
+      "content_type": "Note",
+      "content": {"title": "one", "text": "one", "references": [], "appData": {"org.standardnotes.sn": {"pinned": true}}},
+      "created_at": "2020-01-01T10:00:00.000Z",
+      "updated_at": "2020-01-02T10:00:00.000Z"
+    },
+    {
+      "uuid": "tag-uuid",
+      "content_type": "Tag",
+      "content": {"title": "tag", "references": [{"uuid": "note-uuid", "content_type": "Note"}, {"uuid": "elsewhere", "content_type": "Note"}]},
+      "created_at": "2020-01-01T10:00:00.000Z",
+      "updated_at": "2020-01-03T10:00:00.000Z"
+    },
+    {
+      "uuid": "component-uuid",
+      "content_type": "SN|Component",
+      "content": {"name": "editor", "associatedItemIds": ["note-uuid"], "references": []},
+      "created_at": "2020-01-01T10:00:00.000Z",
+      "updated_at": "2020-01-01T10:00:00.000Z"
+    },
+    {
+      "uuid": "unknown-uuid",
+      "content_type": "SN|Unknown",
+      "content": "{\"value\":42,\"nested\":{\"a\":[1,2]}}",
+      "created_at": "2020-01-01T10:00:00.000Z",
+      "updated_at": "2020-01-01T10:00:00.000Z"
+    }
+  ]
+}`
+
+func TestExportImportDecryptedBackup(t *testing.T) {
+	items, err := ImportDecryptedBackup(strings.NewReader(testDecryptedBackup), false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 4)
+	assert.Equal(t, "note-uuid", items[0].UUID)
+	assert.Equal(t, "2020-01-01T10:00:00.000Z", items[0].CreatedAt)
+	assert.Equal(t, "2020-01-02T10:00:00.000Z", items[0].UpdatedAt)
+	assert.JSONEq(t, `{"value":42,"nested":{"a":[1,2]}}`, items[3].Content)
+
+	deleted := DecryptedItem{UUID: "deleted", ContentType: "Note", Content: "{}", Deleted: true}
+	ik := DecryptedItem{UUID: "ik", ContentType: itemsKeyContentType, Content: "{}"}
+
+	var buf bytes.Buffer
+
+	assert.NoError(t, ExportDecryptedBackup(&buf, append(items, deleted, ik)))
+	assert.NotContains(t, buf.String(), `"deleted"`)
+	assert.NotContains(t, buf.String(), `"ik"`)
+
+	reimported, err := ImportDecryptedBackup(&buf, false)
+	assert.NoError(t, err)
+	assert.Len(t, reimported, len(items))
+
+	for x := range items {
+		assert.Equal(t, items[x].UUID, reimported[x].UUID)
+		assert.Equal(t, items[x].ContentType, reimported[x].ContentType)
+		assert.Equal(t, items[x].CreatedAt, reimported[x].CreatedAt)
+		assert.Equal(t, items[x].UpdatedAt, reimported[x].UpdatedAt)
+		assert.JSONEq(t, items[x].Content, reimported[x].Content)
+	}
+
+	assert.Error(t, ExportDecryptedBackup(&buf, DecryptedItems{{UUID: "bad", ContentType: "Note", Content: "{"}}))
+}
+
+func TestImportDecryptedBackupRegeneratesUUIDs(t *testing.T) {
+	items, err := ImportDecryptedBackup(strings.NewReader(testDecryptedBackup), true)
+	assert.NoError(t, err)
+	assert.Len(t, items, 4)
+
+	note, tag, component, unknown := items[0], items[1], items[2], items[3]
+	for _, item := range items {
+		assert.NotContains(t, []string{"note-uuid", "tag-uuid", "component-uuid", "unknown-uuid"}, item.UUID)
+	}
+
+	di := DecryptedItems{note, tag, component}
+
+	parsed, err := di.Parse()
+	assert.NoError(t, err)
+
+	refs := parsed[1].Content.References()
+	assert.Len(t, refs, 2)
+	assert.Equal(t, note.UUID, refs[0].UUID)
+	// references to items outside the backup are left as they are
+	assert.Equal(t, "elsewhere", refs[1].UUID)
+	assert.Equal(t, []string{note.UUID}, parsed[2].Content.GetItemAssociations())
+
+	assert.Contains(t, note.Content, `"pinned":true`)
+	assert.Equal(t, "2020-01-02T10:00:00.000Z", note.UpdatedAt)
+	assert.JSONEq(t, `{"value":42,"nested":{"a":[1,2]}}`, unknown.Content)
+}
+
+func TestDecryptedItemsEncrypt(t *testing.T) {
+	items, err := ImportDecryptedBackup(strings.NewReader(testDecryptedBackup), false)
+	assert.NoError(t, err)
+
+	ik := NewItemsKey()
+
+	for _, iks := range []ItemsKeys{nil, {ik}} {
+		eItems, err := items.Encrypt(testSyncMk, testSyncAk, iks)
+		assert.NoError(t, err)
+		assert.Len(t, eItems, len(items))
+
+		decrypted, err := eItems.DecryptWithItemsKeys(testSyncMk, testSyncAk, iks, false)
+		assert.NoError(t, err)
+
+		for x := range items {
+			assert.Equal(t, items[x].UUID, decrypted[x].UUID)
+			assert.Equal(t, items[x].ContentType, decrypted[x].ContentType)
+			assert.Equal(t, items[x].UpdatedAt, decrypted[x].UpdatedAt)
+			assert.Equal(t, items[x].Content, decrypted[x].Content)
+		}
+	}
+
+	_, err = DecryptedItems{{UUID: "ik", ContentType: itemsKeyContentType}}.Encrypt(testSyncMk, testSyncAk, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+package gosn
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Logger receives a client's debug output
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// RetryPolicy defines how many attempts are made to complete a request rejected as too large
+// Each subsequent attempt requests or sends fewer items
+type RetryPolicy struct {
+	GetAttempts int // attempts to retrieve items
+	PutAttempts int // attempts to put each chunk of items
+}
+
+// ClientConfig defines the settings of a new Client
+// Any settings not specified are given the default values
+type ClientConfig struct {
+	HTTPClient     *http.Client      // used to make requests, in place of one created using the settings below
+	Transport      http.RoundTripper // used by the created HTTP client, in place of the default transport
+	ConnectTimeout time.Duration     // time allowed to establish a connection
+	KeepAlive      time.Duration     // interval between keep-alive probes
+	RequestTimeout time.Duration     // time allowed for each request to complete
+	Server         string            // API server used when one is not specified with the input
+	UserAgent      string            // sent with each request, if specified
+	Logger         Logger            // receives debug output, defaults to the standard logger
+	Retry          RetryPolicy
+}
+
+// Client makes requests to the API using its own HTTP client and settings
+// Clients are safe for concurrent use, so one should be created for each set of settings and reused
+type Client struct {
+	httpClient     *http.Client
+	connectTimeout time.Duration
+	server         string
+	userAgent      string
+	logger         Logger
+	retry          RetryPolicy
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Println(v ...interface{}) {
+	log.Println(v...)
+}
+
+// defaultClient is used by the package level functions
+var defaultClient = NewClient(ClientConfig{})
+
+// NewClient returns a Client with the specified settings
+func NewClient(config ClientConfig) *Client {
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = connectionTimeout * time.Second
+	}
+
+	if config.KeepAlive == 0 {
+		config.KeepAlive = keepAliveTimeout * time.Second
+	}
+
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = requestTimeout * time.Second
+	}
+
+	if config.Server == "" {
+		config.Server = apiServer
+	}
+
+	if config.Logger == nil {
+		config.Logger = stdLogger{}
+	}
+
+	if config.Retry.GetAttempts <= 0 {
+		config.Retry.GetAttempts = defaultGetAttempts
+	}
+
+	if config.Retry.PutAttempts <= 0 {
+		config.Retry.PutAttempts = defaultPutAttempts
+	}
+
+	if config.Retry.GetAttempts > maxRetryAttempts {
+		config.Retry.GetAttempts = maxRetryAttempts
+	}
+
+	if config.Retry.PutAttempts > maxRetryAttempts {
+		config.Retry.PutAttempts = maxRetryAttempts
+	}
+
+	c := &Client{
+		httpClient:     config.HTTPClient,
+		connectTimeout: config.ConnectTimeout,
+		server:         config.Server,
+		userAgent:      config.UserAgent,
+		logger:         config.Logger,
+		retry:          config.Retry,
+	}
+
+	if c.httpClient == nil {
+		c.httpClient = createHTTPClient(config)
+	}
+
+	return c
+}
+
+// createHTTPClient for connection re-use
+func createHTTPClient(config ClientConfig) *http.Client {
+	transport := config.Transport
+	if transport == nil {
+		transport = &http.Transport{
+			MaxIdleConnsPerHost: maxIdleConnections,
+			DisableKeepAlives:   false,
+			DisableCompression:  false,
+			DialContext: (&net.Dialer{
+				Timeout:   config.ConnectTimeout,
+				KeepAlive: config.KeepAlive,
+			}).DialContext,
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   config.RequestTimeout,
+	}
+}
+
+// newRequest returns a request with the client's headers set
+func (c *Client) newRequest(ctx context.Context, method, url string, body io.Reader) (req *http.Request, err error) {
+	req, err = http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return
+	}
+
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	return req, err
+}
+
+func (c *Client) debugPrint(show bool, msg string) {
+	if show {
+		if len(msg) > maxDebugChars {
+			msg = msg[:maxDebugChars] + "..."
+		}
+
+		c.logger.Println(libName, "|", msg)
+	}
+}
+
+// retry calls fn, with the number of the attempt, until it succeeds or returns false to stop retrying
+// The number of attempts is limited by fn, using the client's retry policy
+func retry(fn func(attempt int) (retry bool, err error)) (err error) {
+	for attempt := 1; ; attempt++ {
+		var again bool
+
+		again, err = fn(attempt)
+		if err == nil || !again {
+			return err
+		}
+	}
+}
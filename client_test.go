@@ -0,0 +1,112 @@
+package gosn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Println(v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintln(v...))
+}
+
+func jsonResponse(req *http.Request, statusCode int, body interface{}) *http.Response {
+	b, _ := json.Marshal(body)
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		Header:     make(http.Header),
+		Request:    req,
+	}
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	c := NewClient(ClientConfig{})
+	assert.Equal(t, apiServer, c.server)
+	assert.Equal(t, connectionTimeout*time.Second, c.connectTimeout)
+	assert.Equal(t, requestTimeout*time.Second, c.httpClient.Timeout)
+	assert.Equal(t, RetryPolicy{GetAttempts: defaultGetAttempts, PutAttempts: defaultPutAttempts}, c.retry)
+
+	c = NewClient(ClientConfig{Retry: RetryPolicy{GetAttempts: maxRetryAttempts + 1, PutAttempts: 2}})
+	assert.Equal(t, RetryPolicy{GetAttempts: maxRetryAttempts, PutAttempts: 2}, c.retry)
+}
+
+func TestClientGetItemsUsesTransportAndSettings(t *testing.T) {
+	note := createEncryptedTestNote(t, "one", "one", "")
+
+	var userAgents []string
+
+	logger := &testLogger{}
+	c := NewClient(ClientConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			userAgents = append(userAgents, req.Header.Get("User-Agent"))
+			return jsonResponse(req, http.StatusOK, syncResponse{Items: EncryptedItems{note}, SyncToken: "token-1"}), nil
+		}),
+		UserAgent: "gosn-test",
+		Logger:    logger,
+	})
+
+	out, err := c.GetItems(GetItemsInput{
+		Session: Session{Mk: testSyncMk, Ak: testSyncAk, Token: "token", Server: "https://sn.example.com"},
+		Debug:   true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptedItems{note}, out.Items)
+	assert.Equal(t, []string{"gosn-test"}, userAgents)
+	assert.NotEmpty(t, logger.lines)
+}
+
+func TestClientGetItemsRetryPolicy(t *testing.T) {
+	var requests int
+
+	c := NewClient(ClientConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			requests++
+			return jsonResponse(req, http.StatusRequestEntityTooLarge, nil), nil
+		}),
+		Retry: RetryPolicy{GetAttempts: 2},
+	})
+
+	_, err := c.GetItems(GetItemsInput{
+		Session: Session{Mk: testSyncMk, Ak: testSyncAk, Token: "token", Server: "https://sn.example.com"},
+	})
+	assert.True(t, errors.Is(err, ErrPayloadTooLarge))
+	assert.Equal(t, 2, requests)
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+
+	err := retry(func(attempt int) (bool, error) {
+		attempts = attempt
+		return attempt < defaultPutAttempts, errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, defaultPutAttempts, attempts)
+
+	err = retry(func(attempt int) (bool, error) {
+		attempts = attempt
+		return true, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+}
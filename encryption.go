@@ -15,18 +15,54 @@ import (
 	"strconv"
 	"strings"
 
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/pbkdf2"
 )
 
-func unPad(cipherText []byte) []byte {
+func unPad(cipherText []byte) ([]byte, error) {
+	if len(cipherText) == 0 {
+		return nil, fmt.Errorf("invalid padding: empty plaintext")
+	}
+
 	c := cipherText[len(cipherText)-1]
 	n := int(c)
 
-	return cipherText[:len(cipherText)-n]
+	if n == 0 || n > aes.BlockSize || n > len(cipherText) {
+		return nil, fmt.Errorf("invalid padding: possibly incorrect key")
+	}
+
+	return cipherText[:len(cipherText)-n], nil
 }
 
+// decryptString decrypts a protocol string using the scheme identified by its version prefix
 func decryptString(stringToDecrypt, encryptionKey, authKey, uuid string) (output string, err error) {
+	switch getVersion(stringToDecrypt) {
+	case "004":
+		return decryptString004(stringToDecrypt, encryptionKey, uuid)
+	case "003", "002":
+		return decryptString003(stringToDecrypt, encryptionKey, authKey, uuid)
+	}
+
+	return output, fmt.Errorf("unsupported protocol version: \"%s\"", getVersion(stringToDecrypt))
+}
+
+func getVersion(encrypted string) string {
+	if len(encrypted) < 3 {
+		return ""
+	}
+
+	return encrypted[:3]
+}
+
+// decryptString003 decrypts 003 strings and, as they share the same format, 002 strings
+func decryptString003(stringToDecrypt, encryptionKey, authKey, uuid string) (output string, err error) {
 	components := strings.Split(stringToDecrypt, ":")
+	if len(components) != 5 {
+		err = fmt.Errorf("expected 5 components in %s string but found %d", getVersion(stringToDecrypt),
+			len(components))
+		return
+	}
 
 	version := components[0]
 	authHash := components[1]
@@ -35,8 +71,8 @@ func decryptString(stringToDecrypt, encryptionKey, authKey, uuid string) (output
 	cipherText := components[4]
 
 	if components[2] != uuid {
-		err = fmt.Errorf("aborting as uuid in string to decrypt: \"%s\" is not equal to passed uuid: \"%s\"",
-			localUUID, uuid)
+		err = &IntegrityError{UUID: uuid, Reason: fmt.Sprintf(
+			"aborting as uuid in string to decrypt: \"%s\" is not equal to passed uuid: \"%s\"", localUUID, uuid)}
 		return
 	}
 
@@ -59,7 +95,7 @@ func decryptString(stringToDecrypt, encryptionKey, authKey, uuid string) (output
 	localAuthHash := hex.EncodeToString(localAuthHasher.Sum(nil))
 
 	if localAuthHash != authHash {
-		err = fmt.Errorf("auth hash does not match. possible tampering or server issue")
+		err = &IntegrityError{UUID: uuid, Reason: "auth hash does not match. possible tampering or server issue"}
 		return
 	}
 
@@ -89,13 +125,92 @@ func decryptString(stringToDecrypt, encryptionKey, authKey, uuid string) (output
 
 	mode.CryptBlocks(b64DecodedCipherText, b64DecodedCipherText)
 
-	b64DecodedCipherText = unPad(b64DecodedCipherText)
+	b64DecodedCipherText, err = unPad(b64DecodedCipherText)
+	if err != nil {
+		return
+	}
 
 	output = string(b64DecodedCipherText)
 
 	return output, err
 }
 
+// decryptString001 decrypts a base64 encoded AES-CBC cipher text, as used by 001, where the IV is zeroed
+func decryptString001(cipherText, encryptionKey string) (output string, err error) {
+	var deHexedEncKey []byte
+
+	deHexedEncKey, err = hex.DecodeString(encryptionKey)
+	if err != nil {
+		return
+	}
+
+	var aesCipher cipher.Block
+
+	aesCipher, err = aes.NewCipher(deHexedEncKey)
+	if err != nil {
+		return
+	}
+
+	var b64DecodedCipherText []byte
+
+	b64DecodedCipherText, err = base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return
+	}
+
+	if len(b64DecodedCipherText) == 0 || len(b64DecodedCipherText)%aes.BlockSize != 0 {
+		err = fmt.Errorf("cipher text is not a multiple of the block size")
+		return
+	}
+
+	mode := cipher.NewCBCDecrypter(aesCipher, make([]byte, aes.BlockSize))
+	mode.CryptBlocks(b64DecodedCipherText, b64DecodedCipherText)
+
+	b64DecodedCipherText, err = unPad(b64DecodedCipherText)
+	if err != nil {
+		return
+	}
+
+	return string(b64DecodedCipherText), err
+}
+
+// decryptItem001 decrypts an item's content where the item key is unprefixed and
+// the content's auth hash is held separately on the item
+func decryptItem001(eItem EncryptedItem, key string) (content string, err error) {
+	var itemKey string
+
+	itemKey, err = decryptString001(eItem.EncItemKey, key)
+	if err != nil {
+		return
+	}
+
+	itemEncryptionKey, itemAuthKey := splitItemKey("001", itemKey)
+
+	if eItem.AuthHash != "" {
+		var deHexedAuthKey []byte
+
+		deHexedAuthKey, err = hex.DecodeString(itemAuthKey)
+		if err != nil {
+			return
+		}
+
+		localAuthHasher := hmac.New(sha256.New, deHexedAuthKey)
+
+		// the auth hash is of the content as stored, including the version prefix
+		_, err = localAuthHasher.Write([]byte(eItem.Content))
+		if err != nil {
+			return
+		}
+
+		if hex.EncodeToString(localAuthHasher.Sum(nil)) != eItem.AuthHash {
+			err = &IntegrityError{UUID: eItem.UUID, Reason: "auth hash does not match. possible tampering or server issue"}
+			return
+		}
+	}
+
+	return decryptString001(eItem.Content[len("001"):], itemEncryptionKey)
+}
+
 func encryptString(stringToEncrypt, encryptionKey, authKey, uuid string, IVOverride []byte) (result string, err error) {
 	bytesToEncrypt := []byte(stringToEncrypt)
 	bytesToEncrypt = padToAESBlockSize(bytesToEncrypt)
@@ -159,12 +274,182 @@ func encryptString(stringToEncrypt, encryptionKey, authKey, uuid string, IVOverr
 	return result, err
 }
 
+// authenticatedData004 is the data bound to each 004 ciphertext
+// Items encrypted with the root key, such as items keys, are also bound to the root key's params
+type authenticatedData004 struct {
+	UUID      string     `json:"u"`
+	Version   string     `json:"v"`
+	KeyParams *KeyParams `json:"kp,omitempty"`
+}
+
+func encryptString004(stringToEncrypt, encryptionKey, uuid string, kp *KeyParams,
+	nonceOverride []byte) (result string, err error) {
+	var deHexedEncKey []byte
+
+	deHexedEncKey, err = hex.DecodeString(encryptionKey)
+	if err != nil {
+		return
+	}
+
+	var aead cipher.AEAD
+
+	aead, err = chacha20poly1305.NewX(deHexedEncKey)
+	if err != nil {
+		return
+	}
+
+	var nonce []byte
+	if nonceOverride != nil {
+		nonce = nonceOverride
+	} else {
+		nonce = make([]byte, chacha20poly1305.NonceSizeX)
+
+		_, err = crand.Read(nonce)
+		if err != nil {
+			return
+		}
+	}
+
+	var ad []byte
+
+	ad, err = json.Marshal(authenticatedData004{
+		UUID:      uuid,
+		Version:   "004",
+		KeyParams: kp,
+	})
+	if err != nil {
+		return
+	}
+
+	b64AD := base64.StdEncoding.EncodeToString(ad)
+
+	cipherText := aead.Seal(nil, nonce, []byte(stringToEncrypt), []byte(b64AD))
+
+	result = fmt.Sprintf("004:%s:%s:%s", hex.EncodeToString(nonce),
+		base64.StdEncoding.EncodeToString(cipherText), b64AD)
+
+	return result, err
+}
+
+func decryptString004(stringToDecrypt, encryptionKey, uuid string) (output string, err error) {
+	components := strings.Split(stringToDecrypt, ":")
+	if len(components) != 4 {
+		err = fmt.Errorf("expected 4 components in 004 string but found %d", len(components))
+		return
+	}
+
+	nonce := components[1]
+	cipherText := components[2]
+	b64AD := components[3]
+
+	var ad []byte
+
+	ad, err = base64.StdEncoding.DecodeString(b64AD)
+	if err != nil {
+		return
+	}
+
+	var authData authenticatedData004
+
+	err = json.Unmarshal(ad, &authData)
+	if err != nil {
+		return
+	}
+
+	if authData.UUID != uuid {
+		err = &IntegrityError{UUID: uuid, Reason: fmt.Sprintf(
+			"aborting as uuid in string to decrypt: \"%s\" is not equal to passed uuid: \"%s\"", authData.UUID, uuid)}
+		return
+	}
+
+	if authData.Version != "004" {
+		err = &IntegrityError{UUID: uuid, Reason: fmt.Sprintf(
+			"authenticated data version \"%s\" does not match string version \"004\"", authData.Version)}
+		return
+	}
+
+	var deHexedEncKey []byte
+
+	deHexedEncKey, err = hex.DecodeString(encryptionKey)
+	if err != nil {
+		return
+	}
+
+	var aead cipher.AEAD
+
+	aead, err = chacha20poly1305.NewX(deHexedEncKey)
+	if err != nil {
+		return
+	}
+
+	var deHexedNonce []byte
+
+	deHexedNonce, err = hex.DecodeString(nonce)
+	if err != nil {
+		return
+	}
+
+	if len(deHexedNonce) != chacha20poly1305.NonceSizeX {
+		err = fmt.Errorf("invalid nonce length: %d", len(deHexedNonce))
+		return
+	}
+
+	var b64DecodedCipherText []byte
+
+	b64DecodedCipherText, err = base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return
+	}
+
+	var plainText []byte
+
+	plainText, err = aead.Open(nil, deHexedNonce, b64DecodedCipherText, []byte(b64AD))
+	if err != nil {
+		err = &IntegrityError{UUID: uuid, Reason: "authentication failed. possible tampering or server issue"}
+		return
+	}
+
+	return string(plainText), err
+}
+
+// generateEncryptedPasswordAndKeys004 derives the server password and master key from the user's password
+// using Argon2id, with a salt generated from the identifier and nonce returned in the auth params
+func generateEncryptedPasswordAndKeys004(input generateEncryptedPasswordInput) (pw, mk string, err error) {
+	if input.PasswordNonce == "" {
+		err = fmt.Errorf("password nonce not defined")
+		return
+	}
+
+	preSalt := sha256.Sum256([]byte(input.Identifier + ":" + input.PasswordNonce))
+	// salt is the first 128 bits of the hash
+	salt := preSalt[:argon2SaltLength]
+
+	derivedKey := argon2.IDKey([]byte(input.userPassword), salt, argon2Iterations, argon2Memory, argon2Parallelism,
+		argon2KeyLength)
+	hexedDerivedKey := hex.EncodeToString(derivedKey)
+	splitLength := len(hexedDerivedKey) / 2
+	mk = hexedDerivedKey[:splitLength]
+	pw = hexedDerivedKey[splitLength:]
+
+	return
+}
+
 func generateEncryptedPasswordAndKeys(input generateEncryptedPasswordInput) (pw, mk, ak string, err error) {
+	if input.Version == "004" {
+		pw, mk, err = generateEncryptedPasswordAndKeys004(input)
+		return
+	}
+
 	if input.Version == "003" && input.PasswordCost < 100000 {
 		err = fmt.Errorf("password cost too low")
 		return
 	}
 
+	if input.Version == "001" || input.Version == "002" {
+		pw, mk, ak, err = generateEncryptedPasswordAndKeysLegacy(input)
+		return
+	}
+
 	saltSource := input.Identifier + ":" + "SF" + ":" + input.Version + ":" + strconv.Itoa(int(input.PasswordCost)) + ":" + input.PasswordNonce
 	h := sha256.New()
 	h.Write([]byte(saltSource))
@@ -181,6 +466,44 @@ func generateEncryptedPasswordAndKeys(input generateEncryptedPasswordInput) (pw,
 	return
 }
 
+// generateEncryptedPasswordAndKeysLegacy derives keys for 001 and 002 accounts using the salt and cost
+// returned in the auth params. 001 keys do not include an auth key.
+func generateEncryptedPasswordAndKeysLegacy(input generateEncryptedPasswordInput) (pw, mk, ak string, err error) {
+	if input.PasswordSalt == "" {
+		err = fmt.Errorf("password salt not defined")
+		return
+	}
+
+	if input.PasswordCost < 3000 {
+		err = fmt.Errorf("password cost too low")
+		return
+	}
+
+	keyLength := 96
+	if input.Version == "001" {
+		keyLength = 64
+	}
+
+	hashedPassword := pbkdf2.Key([]byte(input.userPassword), []byte(input.PasswordSalt), int(input.PasswordCost),
+		keyLength, sha512.New)
+	hexedHashedPassword := hex.EncodeToString(hashedPassword)
+
+	if input.Version == "001" {
+		splitLength := len(hexedHashedPassword) / 2
+		pw = hexedHashedPassword[:splitLength]
+		mk = hexedHashedPassword[splitLength:]
+
+		return
+	}
+
+	splitLength := len(hexedHashedPassword) / 3
+	pw = hexedHashedPassword[:splitLength]
+	mk = hexedHashedPassword[splitLength : splitLength*2]
+	ak = hexedHashedPassword[splitLength*2:]
+
+	return
+}
+
 func getBodyContent(input []byte) (output syncResponse, err error) {
 	err = json.Unmarshal(input, &output)
 	if err != nil {
@@ -199,22 +522,99 @@ func padToAESBlockSize(b []byte) []byte {
 	return pb
 }
 
-func encryptItems(decItems *Items, mk, ak string, debug bool) (encryptedItems EncryptedItems, err error) {
+func encryptItems(decItems *Items, mk, ak, version string, iks ItemsKeys, debug bool) (encryptedItems EncryptedItems, err error) {
 	debugPrint(debug, fmt.Sprintf("encryptItems | encrypting %d items", len(*decItems)))
 
 	for _, decItem := range *decItems {
+		if decItem.ContentType == itemsKeyContentType {
+			err = fmt.Errorf("items key \"%s\" must be encrypted with ItemsKey.Encrypt", decItem.UUID)
+			return
+		}
+
+		var key, authKey, keyVersion, itemsKeyID string
+
+		key, authKey, keyVersion, itemsKeyID, err = iks.keysForItem(decItem, mk, ak, version)
+		if err != nil {
+			return
+		}
+
 		var e EncryptedItem
-		e, err = encryptItem(decItem, mk, ak)
+
+		e, err = encryptItem(decItem, keyVersion, key, authKey)
+		if err != nil {
+			return
+		}
+
+		e.ItemsKeyID = itemsKeyID
+
 		encryptedItems = append(encryptedItems, e)
 	}
 
 	return
 }
 
-func encryptItem(item Item, mk, ak string) (encryptedItem EncryptedItem, err error) {
+func encryptItem(item Item, version, mk, ak string) (encryptedItem EncryptedItem, err error) {
 	encryptedItem.UpdatedAt = item.UpdatedAt
 	encryptedItem.CreatedAt = item.CreatedAt
 	encryptedItem.Deleted = item.Deleted
+
+	var mContent []byte
+
+	if item.Content == nil && item.RawContent != nil {
+		mContent = item.RawContent
+	} else {
+		mContent, err = json.Marshal(item.Content)
+		if err != nil {
+			return
+		}
+
+		// unmodified content is encrypted as it was decrypted
+		if item.RawContent != nil && contentUnmodified(item.ContentType, item.RawContent, mContent) {
+			mContent = item.RawContent
+		}
+	}
+
+	encryptedItem.Content, encryptedItem.EncItemKey, err = encryptContent(string(mContent), version, mk, ak, item.UUID)
+	if err != nil {
+		return
+	}
+
+	encryptedItem.UUID = item.UUID
+	encryptedItem.ContentType = item.ContentType
+
+	return encryptedItem, err
+}
+
+// contentUnmodified returns whether the marshalled content matches that of the raw content it was parsed from
+func contentUnmodified(contentType string, raw json.RawMessage, marshalled []byte) bool {
+	original, err := processContentModel(contentType, string(raw))
+	if err != nil || original == nil {
+		return false
+	}
+
+	b, err := json.Marshal(original)
+
+	return err == nil && bytes.Equal(b, marshalled)
+}
+
+// encryptContent encrypts content using the protocol version of the keys provided
+// Content is never encrypted with versions prior to 003, so legacy items are upgraded to 003
+func encryptContent(content, version, mk, ak, uuid string) (encryptedContent, encryptedKey string, err error) {
+	switch version {
+	case "004":
+		return encryptContent004(content, mk, uuid, nil)
+	case "003":
+		if ak == "" {
+			return "", "", fmt.Errorf("unable to encrypt item \"%s\" with 003 keys that lack an auth key", uuid)
+		}
+
+		return encryptContent003(content, mk, ak, uuid)
+	default:
+		return "", "", fmt.Errorf("unable to encrypt item \"%s\" with %s keys: change the password to upgrade them", uuid, version)
+	}
+}
+
+func encryptContent003(content, mk, ak, uuid string) (encryptedContent, encryptedKey string, err error) {
 	// Generate Item Key
 	itemKeyBytes := make([]byte, 64)
 
@@ -229,27 +629,43 @@ func encryptItem(item Item, mk, ak string) (encryptedItem EncryptedItem, err err
 	// get Item Auth Key
 	itemAuthKey := itemKey[len(itemKey)/2:]
 	// encrypt Item Content
-	var encryptedContent string
-
-	mContent, _ := json.Marshal(item.Content)
-
-	encryptedContent, err = encryptString(string(mContent), itemEncryptionKey, itemAuthKey, item.UUID, nil)
+	encryptedContent, err = encryptString(content, itemEncryptionKey, itemAuthKey, uuid, nil)
 	if err != nil {
 		return
 	}
 
-	encryptedItem.Content = encryptedContent
+	encryptedKey, err = encryptString(itemKey, mk, ak, uuid, nil)
+
+	return
+}
+
+// encryptContent004 encrypts content with the 004 protocol, binding the root key's params, if provided
+func encryptContent004(content, mk, uuid string, kp *KeyParams) (encryptedContent, encryptedKey string, err error) {
+	// 004 item keys are a single 256 bit key
+	itemKeyBytes := make([]byte, 32)
+
+	_, err = crand.Read(itemKeyBytes)
+	if err != nil {
+		panic(err)
+	}
 
-	var encryptedKey string
+	itemKey := hex.EncodeToString(itemKeyBytes)
 
-	encryptedKey, err = encryptString(itemKey, mk, ak, item.UUID, nil)
+	encryptedContent, err = encryptString004(content, itemKey, uuid, kp, nil)
 	if err != nil {
 		return
 	}
 
-	encryptedItem.EncItemKey = encryptedKey
-	encryptedItem.UUID = item.UUID
-	encryptedItem.ContentType = item.ContentType
+	encryptedKey, err = encryptString004(itemKey, mk, uuid, kp, nil)
 
-	return encryptedItem, err
+	return
+}
+
+// splitItemKey returns the encryption and authentication keys contained in a decrypted item key
+func splitItemKey(version, itemKey string) (encryptionKey, authKey string) {
+	if version == "004" {
+		return itemKey, ""
+	}
+
+	return itemKey[:len(itemKey)/2], itemKey[len(itemKey)/2:]
 }
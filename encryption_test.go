@@ -1,7 +1,15 @@
 package gosn
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -31,3 +39,202 @@ func TestDecryptString003(t *testing.T) {
 	assert.Nil(t, err, err)
 	assert.Equal(t, result, expectedText, fmt.Sprintf("expected: %s res: %s", expectedText, result))
 }
+
+func TestEncryptDecryptString004(t *testing.T) {
+	stringToEncrypt := `{"title":"tagOne","references":[{"uuid":"a5bd62b0-609c-4152-88f9-9d55f5f490f7","content_type":"Note"}]}`
+	encryptionKey := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	uuid := "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec"
+	nonce := []byte{181, 126, 90, 99, 56, 249, 177, 105, 14, 215, 154, 75, 62, 86, 66, 227, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	result, err := encryptString004(stringToEncrypt, encryptionKey, uuid, nil, nonce)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(result, "004:b57e5a6338f9b1690ed79a4b3e5642e30102030405060708:"))
+	assert.Len(t, strings.Split(result, ":"), 4)
+
+	decrypted, err := decryptString(result, encryptionKey, "", uuid)
+	assert.NoError(t, err)
+	assert.Equal(t, stringToEncrypt, decrypted)
+}
+
+func TestDecryptString004WithIncorrectUUID(t *testing.T) {
+	encryptionKey := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+
+	result, err := encryptString004("some text", encryptionKey, "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec", nil, nil)
+	assert.NoError(t, err)
+
+	_, err = decryptString(result, encryptionKey, "", "277613b2-f1df-4e95-985f-d23a08172e52")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not equal to passed uuid")
+}
+
+func TestDecryptString004WithTamperedCipherText(t *testing.T) {
+	encryptionKey := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	uuid := "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec"
+
+	result, err := encryptString004("some text", encryptionKey, uuid, nil, nil)
+	assert.NoError(t, err)
+
+	components := strings.Split(result, ":")
+	components[2] = base64.StdEncoding.EncodeToString([]byte("some other text and tag"))
+
+	_, err = decryptString(strings.Join(components, ":"), encryptionKey, "", uuid)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "authentication failed")
+
+	var integrityErr *IntegrityError
+
+	assert.True(t, errors.As(err, &integrityErr))
+	assert.Equal(t, uuid, integrityErr.UUID)
+}
+
+func TestDecryptStringWithUnsupportedVersion(t *testing.T) {
+	_, err := decryptString("009:abc", "", "", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported protocol version")
+}
+
+// encryptString001 is the inverse of decryptString001 and is used to create legacy fixtures
+func encryptString001(t *testing.T, stringToEncrypt, encryptionKey string) string {
+	deHexedEncKey, err := hex.DecodeString(encryptionKey)
+	assert.NoError(t, err)
+
+	aesCipher, err := aes.NewCipher(deHexedEncKey)
+	assert.NoError(t, err)
+
+	padded := padToAESBlockSize([]byte(stringToEncrypt))
+	cipher.NewCBCEncrypter(aesCipher, make([]byte, aes.BlockSize)).CryptBlocks(padded, padded)
+
+	return base64.StdEncoding.EncodeToString(padded)
+}
+
+// encryptItem001 returns a 001 item, with an auth hash, encrypted with the master key
+func encryptItem001(t *testing.T, uuid, content, mk string) EncryptedItem {
+	itemKey := "d8b0d0ea5bb0a1f4c7d4cf8e5fd3d0d9a4e1f3e0f5e4c3b2a1908f7e6d5c4b3a" +
+		"0f1e2d3c4b5a69788796a5b4c3d2e1f00112233445566778899aabbccddeeff0"
+	cipherText := encryptString001(t, content, itemKey[:64])
+
+	deHexedAuthKey, err := hex.DecodeString(itemKey[64:])
+	assert.NoError(t, err)
+
+	hasher := hmac.New(sha256.New, deHexedAuthKey)
+	_, err = hasher.Write([]byte("001" + cipherText))
+	assert.NoError(t, err)
+
+	return EncryptedItem{
+		UUID:        uuid,
+		Content:     "001" + cipherText,
+		ContentType: "Note",
+		EncItemKey:  encryptString001(t, itemKey, mk),
+		AuthHash:    hex.EncodeToString(hasher.Sum(nil)),
+		CreatedAt:   "2017-01-02T03:04:05.000Z",
+		UpdatedAt:   "2017-01-02T03:04:05.000Z",
+	}
+}
+
+// encryptString002 returns the 002 equivalent of a 003 string
+func encryptString002(t *testing.T, stringToEncrypt, encryptionKey, authKey, uuid string) string {
+	result, err := encryptString(stringToEncrypt, encryptionKey, authKey, uuid, nil)
+	assert.NoError(t, err)
+
+	components := strings.Split(result, ":")
+	components[0] = "002"
+
+	deHexedAuthKey, err := hex.DecodeString(authKey)
+	assert.NoError(t, err)
+
+	hasher := hmac.New(sha256.New, deHexedAuthKey)
+	_, err = hasher.Write([]byte(strings.Join([]string{"002", components[2], components[3], components[4]}, ":")))
+	assert.NoError(t, err)
+
+	components[1] = hex.EncodeToString(hasher.Sum(nil))
+
+	return strings.Join(components, ":")
+}
+
+func TestDecryptItem001(t *testing.T) {
+	mk := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	content := `{"title":"legacy","text":"from 2016"}`
+	eItem := encryptItem001(t, "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec", content, mk)
+
+	assert.Equal(t, "001", eItem.Version())
+
+	di, err := decryptItem(eItem, mk, "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, di.Content)
+
+	// tampered content must fail auth check
+	eItem.Content = "001" + encryptString001(t, `{"title":"tampered"}`, mk)
+	_, err = decryptItem(eItem, mk, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "auth hash does not match")
+}
+
+func TestDecryptItem001Fixture(t *testing.T) {
+	// encrypted independently of this package, using OpenSSL, as legacy clients did: the content and
+	// item key are AES-256-CBC encrypted with a zero IV, and the auth hash is of the full content
+	mk := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	eItem := EncryptedItem{
+		UUID: "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec",
+		Content: "001UxFFTbf84f6Kl61Zv/owhoE5KV5+Uz8TbyTtR2zj08ck7rPy8CKu6PakaHp5GUS4dtGYjCgt6fpI+9RlK6GAIRvCjFGS" +
+			"2DoegU8OEyaJDK8=",
+		ContentType: "Note",
+		EncItemKey: "J8Gey6APK9HCSlwOV33tDVrFB9SDz05fO35vxWgrt8xyTopIrPmygwupVK/t/GTLt01fzTJkvjQ1YDengZlagaQ2mtz2" +
+			"EannrgOYwpjXkhtWR9+tjvdHqH4ygDdIi97bs/P8hfqbDxzJ2NWWBISRW8EZ3o4lZ31SXEjPuTE673aT+5njDIiTCro6kuFl4RwU",
+		AuthHash: "c2144066a6ecead0597f7b95796255de038f955cf59b0d59d92f2b786e31b2f4",
+	}
+
+	di, err := decryptItem(eItem, mk, "")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title":"Legacy note","text":"Written in 2016","references":[]}`, di.Content)
+
+	eItem.AuthHash = "00" + eItem.AuthHash[2:]
+	_, err = decryptItem(eItem, mk, "")
+	assert.True(t, errors.Is(err, ErrIntegrity))
+}
+
+func TestDecryptString002(t *testing.T) {
+	encryptionKey := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	authKey := "aca431d6fc360e46e853e19d70afec26e4825e2609c2e6df9f4431cbd344e1bc"
+	uuid := "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec"
+
+	result, err := decryptString(encryptString002(t, "legacy text", encryptionKey, authKey, uuid),
+		encryptionKey, authKey, uuid)
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy text", result)
+}
+
+func TestDecryptStringWithMissingComponents(t *testing.T) {
+	_, err := decryptString("003:abc:def", "", "", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected 5 components")
+
+	_, err = decryptString("002", "", "", "")
+	assert.Error(t, err)
+}
+
+func TestEncryptContentUsesKeyVersion(t *testing.T) {
+	uuid := GenUUID()
+	mk := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	ak := "aca431d6fc360e46e853e19d70afec26e4825e2609c2e6df9f4431cbd344e1bc"
+
+	content, itemKey, err := encryptContent(`{"text":"003"}`, "003", mk, ak, uuid)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(content, "003:"))
+	assert.True(t, strings.HasPrefix(itemKey, "003:"))
+
+	// the auth key doesn't determine the version
+	content, itemKey, err = encryptContent(`{"text":"004"}`, "004", mk, ak, uuid)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(content, "004:"))
+	assert.True(t, strings.HasPrefix(itemKey, "004:"))
+
+	_, _, err = encryptContent(`{"text":"003"}`, "003", mk, "", uuid)
+	assert.Error(t, err)
+
+	// legacy versions are never written
+	for _, version := range []string{"001", "002"} {
+		_, _, err = encryptContent(`{"text":"legacy"}`, version, mk, ak, uuid)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "change the password to upgrade them")
+	}
+}
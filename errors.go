@@ -0,0 +1,178 @@
+package gosn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrPayloadTooLarge is returned when the server rejects a request as too large
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrUnauthorized is returned when the server rejects the credentials or session token
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrSessionExpired is returned when the server reports the session's token has expired
+	ErrSessionExpired = errors.New("session has expired")
+	// ErrMFARequired is returned when a multi-factor authentication token is required to sign in
+	ErrMFARequired = errors.New("mfa token required")
+	// ErrIntegrity is returned when encrypted content fails verification
+	ErrIntegrity = errors.New("integrity check failed")
+	// ErrSessionInvalid is returned when a session is missing the values required to make a request
+	ErrSessionInvalid = errors.New("session is invalid")
+	// ErrSessionNotFound is returned when a SessionStore holds no session with the name requested
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionKeyRequired is returned when a session is to be encrypted or decrypted without a key
+	ErrSessionKeyRequired = errors.New("session key required")
+	// ErrWrongSessionKey is returned when an encrypted session cannot be decrypted with the key provided
+	ErrWrongSessionKey = errors.New("wrong session key or session is corrupt")
+	// ErrPromptUnavailable is returned when a Prompter cannot provide the requested field
+	ErrPromptUnavailable = errors.New("no value available")
+	// ErrCredentialsRequired is returned when the credentials required to sign in are not provided
+	ErrCredentialsRequired = errors.New("credentials required")
+)
+
+const (
+	statusExpiredAccessToken = 498                    // status returned by servers when a token has expired
+	expiredAccessTokenTag    = "expired-access-token" // error tag returned when a token has expired
+)
+
+// APIError is returned when the server responds with an error status
+type APIError struct {
+	StatusCode int
+	Tag        string // the server's error tag, if provided
+	Message    string // the server's error message, if provided
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return strings.ToLower(e.Message)
+	}
+
+	return fmt.Sprintf("request failed: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports whether the error's status code matches the target sentinel
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrSessionExpired:
+		return e.StatusCode == statusExpiredAccessToken || e.Tag == expiredAccessTokenTag
+	case ErrPayloadTooLarge:
+		return e.StatusCode == http.StatusRequestEntityTooLarge
+	}
+
+	return false
+}
+
+// MFARequiredError is returned when the named multi-factor authentication token is required to sign in
+type MFARequiredError struct {
+	TokenName string
+}
+
+func (e *MFARequiredError) Error() string {
+	return fmt.Sprintf("mfa token \"%s\" required", e.TokenName)
+}
+
+// Is reports whether the target is ErrMFARequired
+func (e *MFARequiredError) Is(target error) bool {
+	return target == ErrMFARequired
+}
+
+// CredentialsError is returned when the credentials required to sign in cannot be obtained from the prompter
+type CredentialsError struct {
+	Reason string
+}
+
+func (e *CredentialsError) Error() string {
+	return e.Reason
+}
+
+// Is reports whether the target is ErrCredentialsRequired
+func (e *CredentialsError) Is(target error) bool {
+	return target == ErrCredentialsRequired
+}
+
+// IntegrityError is returned when an item's encrypted content fails verification
+type IntegrityError struct {
+	UUID   string // the item being decrypted, if known
+	Reason string
+}
+
+func (e *IntegrityError) Error() string {
+	if e.UUID == "" {
+		return e.Reason
+	}
+
+	return fmt.Sprintf("item %s: %s", e.UUID, e.Reason)
+}
+
+// Is reports whether the target is ErrIntegrity
+func (e *IntegrityError) Is(target error) bool {
+	return target == ErrIntegrity
+}
+
+// ConnectionError is returned when a request cannot be sent to the server
+type ConnectionError struct {
+	URL     string
+	Message string
+	Err     error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// SignOutError is returned when signing out fails to revoke the session's token on the server,
+// to remove the session from the store, or both
+type SignOutError struct {
+	RevokeErr error // error revoking the token on the server
+	RemoveErr error // error removing the session from the store
+}
+
+func (e *SignOutError) Error() string {
+	var msgs []string
+
+	if e.RevokeErr != nil {
+		msgs = append(msgs, fmt.Sprintf("failed to revoke session token: %s", e.RevokeErr))
+	}
+
+	if e.RemoveErr != nil {
+		msgs = append(msgs, fmt.Sprintf("failed to remove stored session: %s", e.RemoveErr))
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the error revoking the token, if any, otherwise the error removing the session
+func (e *SignOutError) Unwrap() error {
+	if e.RevokeErr != nil {
+		return e.RevokeErr
+	}
+
+	return e.RemoveErr
+}
+
+// newAPIError returns the error described by a server's error response
+func newAPIError(statusCode int, body []byte) error {
+	var errResp errorResponse
+
+	_ = json.Unmarshal(body, &errResp)
+
+	if errResp.Error.Payload.MFAKey != "" {
+		return &MFARequiredError{TokenName: errResp.Error.Payload.MFAKey}
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Tag:        errResp.Error.Tag,
+		Message:    errResp.Error.Message,
+	}
+}
@@ -0,0 +1,60 @@
+package gosn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &APIError{StatusCode: http.StatusUnauthorized, Message: "Invalid login credentials."})
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	assert.False(t, errors.Is(err, ErrPayloadTooLarge))
+	assert.Contains(t, err.Error(), "invalid login credentials.")
+
+	err = &APIError{StatusCode: http.StatusRequestEntityTooLarge}
+	assert.True(t, errors.Is(err, ErrPayloadTooLarge))
+	assert.Equal(t, "request failed: 413 Request Entity Too Large", err.Error())
+}
+
+func TestNewAPIErrorWithMFAPayload(t *testing.T) {
+	err := newAPIError(http.StatusUnauthorized,
+		[]byte(`{"error":{"tag":"mfa-required","message":"Please enter your two-factor authentication code.","payload":{"mfa_key":"mfa_1"}}}`))
+	assert.True(t, errors.Is(err, ErrMFARequired))
+	assert.False(t, errors.Is(err, ErrUnauthorized))
+
+	var mfaErr *MFARequiredError
+
+	assert.True(t, errors.As(err, &mfaErr))
+	assert.Equal(t, "mfa_1", mfaErr.TokenName)
+}
+
+func TestMakeSyncRequestReturnsAPIError(t *testing.T) {
+	c := NewClient(ClientConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(req, http.StatusUnauthorized, map[string]interface{}{
+				"error": map[string]string{"tag": "invalid-auth", "message": "Invalid login credentials."},
+			}), nil
+		}),
+	})
+
+	_, err := c.GetItems(GetItemsInput{
+		Session: Session{Mk: testSyncMk, Ak: testSyncAk, Token: "token", Server: "https://sn.example.com"},
+	})
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	var apiErr *APIError
+
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "invalid-auth", apiErr.Tag)
+	assert.Equal(t, "Invalid login credentials.", apiErr.Message)
+}
+
+func TestGetItemsWithInvalidSession(t *testing.T) {
+	_, err := GetItems(GetItemsInput{})
+	assert.True(t, errors.Is(err, ErrSessionInvalid))
+}
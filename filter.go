@@ -16,6 +16,8 @@ type Filter struct {
 	Key        string
 	Comparison string
 	Value      string
+	// match notes tagged with any descendant of the tags matched by a TagTitle filter
+	IncludeSubTags bool
 }
 
 func (i *Items) Filter(f ItemFilters) {
@@ -29,10 +31,12 @@ func (i *Items) Filter(f ItemFilters) {
 		}
 	}
 
+	subTagged := subTagNotes(f, tags)
+
 	for _, item := range *i {
 		switch item.ContentType {
 		case "Note":
-			if found := applyNoteFilters(item, f, tags); found {
+			if found := matchNoteFilters(item, f, tags, subTagged); found {
 				filtered = append(filtered, item)
 
 			}
@@ -121,6 +125,22 @@ func applyNoteTextFilter(f Filter, i Item, matchAny bool) (result, matchedAll, d
 				}
 				matchedAll = false
 			}
+		case "startswith":
+			if strings.HasPrefix(i.Content.GetText(), f.Value) {
+				if matchAny {
+					result = true
+					done = true
+					return
+				}
+				matchedAll = true
+			} else {
+				if !matchAny {
+					result = false
+					done = true
+					return
+				}
+				matchedAll = false
+			}
 		}
 	}
 
@@ -189,6 +209,101 @@ func applyNoteTagTitleFilter(f Filter, i Item, tags Items, matchAny bool) (resul
 	return result, matchedAll, done
 }
 
+// subTagNotes returns the UUIDs of the notes matched by each filter of tag titles that includes sub tags,
+// keyed by the filter's index, so the tag tree is searched once rather than for every note
+func subTagNotes(f ItemFilters, tags Items) (notes map[int]map[string]bool) {
+	var tt tagTree
+
+	for x, filter := range f.Filters {
+		if filter.Type != "Note" || strings.ToLower(filter.Key) != "tagtitle" || !filter.IncludeSubTags {
+			continue
+		}
+
+		if notes == nil {
+			tt = newTagTree(tags)
+			notes = make(map[int]map[string]bool)
+		}
+
+		notes[x] = tt.notesTagged(filter)
+	}
+
+	return
+}
+
+// notesTagged returns the UUIDs of the items referenced by a tag whose title or path matches, or by any tag below one
+func (tt tagTree) notesTagged(f Filter) map[string]bool {
+	matched := make(map[string]bool)
+
+	switch f.Comparison {
+	case "~":
+		r := regexp.MustCompile(f.Value)
+
+		for uuid, tag := range tt.tags {
+			if r.MatchString(tag.Content.GetTitle()) || r.MatchString(tt.paths[uuid]) {
+				matched[tt.paths[uuid]] = true
+			}
+		}
+	case "==":
+		// paths below the value match even if no tag has the value as its path
+		matched[f.Value] = true
+
+		for uuid, tag := range tt.tags {
+			if tag.Content.GetTitle() == f.Value {
+				matched[tt.paths[uuid]] = true
+			}
+		}
+	}
+
+	notes := make(map[string]bool)
+
+	for uuid, tag := range tt.tags {
+		if !pathWithin(tt.paths[uuid], matched) {
+			continue
+		}
+
+		for _, ref := range tag.Content.References() {
+			notes[ref.UUID] = true
+		}
+	}
+
+	return notes
+}
+
+// pathWithin returns true if the path, or that of one of its ancestors, is one of the paths
+func pathWithin(path string, paths map[string]bool) bool {
+	for {
+		if paths[path] {
+			return true
+		}
+
+		x := strings.LastIndex(path, tagPathSeparator)
+		if x == -1 {
+			return false
+		}
+
+		path = path[:x]
+	}
+}
+
+// applyNoteTagTreeFilter matches notes in the set of those tagged with a matching tag, or any tag below one
+func applyNoteTagTreeFilter(tagged map[string]bool, i Item, matchAny bool) (result, matchedAll, done bool) {
+	if tagged[i.UUID] {
+		if matchAny {
+			return true, true, true
+		}
+
+		matchedAll = true
+	} else {
+		if !matchAny {
+			return false, false, true
+		}
+
+		matchedAll = false
+	}
+
+	return result, matchedAll, done
+}
+
 func applyNoteTagUUIDFilter(f Filter, i Item, tags Items, matchAny bool) (result, matchedAll, done bool) {
 	var matchesTag bool
 
@@ -249,6 +364,12 @@ func applyNoteTagUUIDFilter(f Filter, i Item, tags Items, matchAny bool) (result
 }
 
 func applyNoteFilters(item Item, itemFilters ItemFilters, tags Items) bool {
+	return matchNoteFilters(item, itemFilters, tags, subTagNotes(itemFilters, tags))
+}
+
+// matchNoteFilters applies the filters to the note, using the notes already found to match each filter
+// of tag titles that includes sub tags
+func matchNoteFilters(item Item, itemFilters ItemFilters, tags Items, subTagged map[int]map[string]bool) bool {
 	var matchedAll, result, done bool
 
 	for i, filter := range itemFilters.Filters {
@@ -268,6 +389,15 @@ func applyNoteFilters(item Item, itemFilters ItemFilters, tags Items) bool {
 				return result
 			}
 		case "tagtitle": // Tag Title
+			if filter.IncludeSubTags {
+				result, matchedAll, done = applyNoteTagTreeFilter(subTagged[i], item, itemFilters.MatchAny)
+				if done {
+					return result
+				}
+
+				break
+			}
+
 			result, matchedAll, done = applyNoteTagTitleFilter(filter, item, tags, itemFilters.MatchAny)
 			if done {
 				return result
@@ -303,6 +433,21 @@ func applyNoteFilters(item Item, itemFilters ItemFilters, tags Items) bool {
 					return false
 				}
 
+				matchedAll = false
+			}
+		case "trashed", "pinned", "archived", "locked": // appdata flags
+			want, _ := strconv.ParseBool(filter.Value)
+			if item.Content != nil && noteFlag(item.Content, strings.ToLower(filter.Key)) == want {
+				if itemFilters.MatchAny {
+					return true
+				}
+
+				matchedAll = true
+			} else {
+				if !itemFilters.MatchAny {
+					return false
+				}
+
 				matchedAll = false
 			}
 		default:
@@ -317,6 +462,27 @@ func applyNoteFilters(item Item, itemFilters ItemFilters, tags Items) bool {
 	return matchedAll
 }
 
+// noteFlag returns the value of the named appdata flag
+func noteFlag(content ClientStructure, flag string) bool {
+	flags, ok := content.(AppDataClientStructure)
+	if !ok {
+		return false
+	}
+
+	switch flag {
+	case "trashed":
+		return flags.IsTrashed()
+	case "pinned":
+		return flags.IsPinned()
+	case "archived":
+		return flags.IsArchived()
+	case "locked":
+		return flags.IsLocked()
+	}
+
+	return false
+}
+
 func applyNoteTitleFilter(f Filter, i Item, matchAny bool) (result, matchedAll, done bool) {
 	if i.Content == nil {
 		matchedAll = false
@@ -387,6 +553,22 @@ func applyNoteTitleFilter(f Filter, i Item, matchAny bool) (result, matchedAll,
 				}
 				matchedAll = false
 			}
+		case "startswith":
+			if strings.HasPrefix(i.Content.GetTitle(), f.Value) {
+				if matchAny {
+					result = true
+					done = true
+					return
+				}
+				matchedAll = true
+			} else {
+				if !matchAny {
+					result = false
+					done = true
+					return
+				}
+				matchedAll = false
+			}
 		}
 	}
 
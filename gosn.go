@@ -2,24 +2,39 @@ package gosn
 
 import (
 	"log"
-	"net"
-	"net/http"
-	"time"
 )
 
 const (
 	// API
-	apiServer        = "https://sync.standardnotes.org"
-	authParamsPath   = "/auth/params"  // remote path for getting auth parameters
-	authRegisterPath = "/auth"         // remote path for registering user
-	signInPath       = "/auth/sign_in" // remote path for authenticating
-	syncPath         = "/items/sync"   // remote path for making sync calls
+	apiServer          = "https://sync.standardnotes.org"
+	authParamsPath     = "/auth/params"    // remote path for getting auth parameters
+	authRegisterPath   = "/auth"           // remote path for registering user
+	signInPath         = "/auth/sign_in"   // remote path for authenticating
+	syncPath           = "/items/sync"     // remote path for making sync calls
+	changePasswordPath = "/auth/change_pw" // remote path for changing password
+	signOutPath        = "/auth/sign_out"  // remote path for revoking a session's token
+	syncAPIVersion     = "20190520"        // sync API version that returns conflicts
 	// PageSize is the maximum number of items to return with each call
 	PageSize            = 300
 	timeLayout          = "2006-01-02T15:04:05.000Z"
 	defaultSNVersion    = "003"
 	defaultPasswordCost = 110000
 
+	// 004 root key derivation parameters
+	argon2Iterations  = 5
+	argon2Memory      = 64 * 1024 // KiB
+	argon2Parallelism = 1
+	argon2KeyLength   = 64
+	argon2SaltLength  = 16
+
+	// session encryption key derivation parameters
+	sessionKDFIterations   = 3
+	sessionKDFMemory       = 64 * 1024 // KiB
+	sessionKDFParallelism  = 1
+	sessionKDFSaltLength   = 16
+	sessionFormatVersion   = "v2" // prefix of sessions encrypted with an AEAD cipher
+	sessionDocumentVersion = 1    // version of the JSON document sessions are serialised as
+
 	// LOGGING
 	libName       = "gosn" // name of library used in logging
 	maxDebugChars = 120    // number of characters to display when logging API response body
@@ -29,32 +44,13 @@ const (
 	requestTimeout     = 60  // HTTP transport limit
 	connectionTimeout  = 5   // HTTP transport dialer limit
 	keepAliveTimeout   = 10  // HTTP transport dialer limit
-)
 
-var (
-	httpClient *http.Client
+	// RETRIES
+	defaultGetAttempts = 3   // attempts to retrieve items
+	defaultPutAttempts = 20  // attempts to put each chunk of items
+	maxRetryAttempts   = 100 // limit of attempts for any request
 )
 
-func init() {
-	httpClient = createHTTPClient()
-}
-
-// createHTTPClient for connection re-use
-func createHTTPClient() *http.Client {
-	return &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost: maxIdleConnections,
-			DisableKeepAlives:   false,
-			DisableCompression:  false,
-			DialContext: (&net.Dialer{
-				Timeout:   connectionTimeout * time.Second,
-				KeepAlive: keepAliveTimeout * time.Second,
-			}).DialContext,
-		},
-		Timeout: time.Duration(requestTimeout) * time.Second,
-	}
-}
-
 func debugPrint(show bool, msg string) {
 	if show {
 		if len(msg) > maxDebugChars {
@@ -0,0 +1,74 @@
+package gosn
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jonhadfield/gosn/gosntest"
+	"github.com/stretchr/testify/assert"
+)
+
+// testServer is the in-memory server used when SN_SERVER is not set
+var testServer *gosntest.Server
+
+func TestMain(m *testing.M) {
+	if os.Getenv("SN_SERVER") != "" {
+		os.Exit(m.Run())
+	}
+
+	testServer = gosntest.NewServer()
+
+	// use a new account on the in-memory server for the tests requiring a server
+	sInput = SignInInput{
+		Email:     "gosn-test@example.com",
+		Password:  "secret",
+		APIServer: testServer.URL,
+	}
+
+	_ = os.Setenv("SN_SERVER", sInput.APIServer)
+	_ = os.Setenv("SN_EMAIL", sInput.Email)
+	_ = os.Setenv("SN_PASSWORD", sInput.Password)
+
+	_, err := RegisterInput{
+		Email:     sInput.Email,
+		Password:  sInput.Password,
+		APIServer: sInput.APIServer,
+	}.Register()
+	if err != nil {
+		fmt.Println("failed to register test account:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	testServer.Close()
+	os.Exit(code)
+}
+
+// signInNewTestUser registers a new account on the in-memory server and signs in, creating its default items key
+// Tests using it are skipped when running against a live server
+func signInNewTestUser(t *testing.T, password string) (email string, session Session) {
+	if testServer == nil {
+		t.Skip("requires the in-memory server")
+	}
+
+	email = fmt.Sprintf("%s@example.com", GenUUID())
+
+	_, err := RegisterInput{
+		Email:     email,
+		Password:  password,
+		APIServer: testServer.URL,
+	}.Register()
+	assert.NoError(t, err)
+
+	out, err := SignIn(SignInInput{
+		Email:          email,
+		Password:       password,
+		APIServer:      testServer.URL,
+		EnsureItemsKey: true,
+	})
+	assert.NoError(t, err)
+
+	return email, out.Session
+}
@@ -0,0 +1,696 @@
+// Package gosntest provides an in-memory Standard Notes server for testing clients without a live server
+package gosntest
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	authParamsPath     = "/auth/params"
+	authRegisterPath   = "/auth"
+	signInPath         = "/auth/sign_in"
+	changePasswordPath = "/auth/change_pw"
+	signOutPath        = "/auth/sign_out"
+	syncPath           = "/items/sync"
+
+	syncAPIVersion      = "20190520" // sync API version that returns conflicts
+	syncConflict        = "sync_conflict"
+	uuidConflict        = "uuid_conflict"
+	defaultLimit        = 100000 // items returned by a sync request without a limit
+	timeLayout          = "2006-01-02T15:04:05.000Z"
+	defaultPasswordCost = 110000
+)
+
+// KeyParams are the parameters a client uses to derive an account's keys from its password
+type KeyParams struct {
+	Identifier    string `json:"identifier"`
+	PasswordSalt  string `json:"pw_salt,omitempty"`
+	PasswordCost  int64  `json:"pw_cost,omitempty"`
+	PasswordNonce string `json:"pw_nonce,omitempty"`
+	Version       string `json:"version"`
+}
+
+// Item is an encrypted item as stored by the server
+type Item struct {
+	UUID        string `json:"uuid"`
+	Content     string `json:"content"`
+	ContentType string `json:"content_type"`
+	EncItemKey  string `json:"enc_item_key"`
+	ItemsKeyID  string `json:"items_key_id,omitempty"`
+	AuthHash    string `json:"auth_hash,omitempty"`
+	Deleted     bool   `json:"deleted"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type conflict struct {
+	Type        string `json:"type"`
+	ServerItem  *Item  `json:"server_item,omitempty"`
+	UnsavedItem *Item  `json:"unsaved_item,omitempty"`
+}
+
+type storedItem struct {
+	Item
+	updated time.Time
+}
+
+type user struct {
+	uuid      string
+	email     string
+	password  string // password derived by the client, not the user's password
+	keyParams KeyParams
+	mfaKey    string
+	mfaToken  string
+	items     map[string]*storedItem
+}
+
+// Server is an in-memory Standard Notes server implementing authentication and sync
+// Requests are handled by an httptest.Server listening on URL
+type Server struct {
+	*httptest.Server
+	// sync requests with bodies larger than this are rejected with 413 (payload too large)
+	MaxRequestBytes int
+	// sync requests with limits higher than this are rejected with 413 (payload too large)
+	MaxLimit int
+
+	mu       sync.Mutex
+	users    map[string]*user // keyed by email
+	tokens   map[string]*user // keyed by session token
+	owners   map[string]*user // keyed by item UUID
+	requests map[string]int   // keyed by path
+	clock    time.Time
+}
+
+// NewServer starts and returns a new Server
+// The caller should call Close when finished, to shut it down
+func NewServer() *Server {
+	s := &Server{
+		users:    make(map[string]*user),
+		tokens:   make(map[string]*user),
+		owners:   make(map[string]*user),
+		requests: make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(authParamsPath, s.handleAuthParams)
+	mux.HandleFunc(authRegisterPath, s.handleRegister)
+	mux.HandleFunc(signInPath, s.handleSignIn)
+	mux.HandleFunc(changePasswordPath, s.handleChangePassword)
+	mux.HandleFunc(signOutPath, s.handleSignOut)
+	mux.HandleFunc(syncPath, s.handleSync)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.mu.Unlock()
+
+		mux.ServeHTTP(w, r)
+	}))
+
+	return s
+}
+
+// AddUser adds an account with the password derived by the client and the parameters used to derive it
+func (s *Server) AddUser(email, password string, params KeyParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.addUser(email, password, params)
+
+	return err
+}
+
+func (s *Server) addUser(email, password string, params KeyParams) (u *user, err error) {
+	if _, ok := s.users[email]; ok {
+		return nil, fmt.Errorf("email %s is already registered", email)
+	}
+
+	if params.Identifier == "" {
+		params.Identifier = email
+	}
+
+	u = &user{
+		uuid:      uuid.NewV4().String(),
+		email:     email,
+		password:  password,
+		keyParams: params,
+		items:     make(map[string]*storedItem),
+	}
+
+	s.users[email] = u
+
+	return u, nil
+}
+
+// EnableMFA requires the token to be sent, as the value of the named parameter, when authenticating
+func (s *Server) EnableMFA(email, mfaKey, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[email]
+	if !ok {
+		return fmt.Errorf("user %s not found", email)
+	}
+
+	u.mfaKey = mfaKey
+	u.mfaToken = token
+
+	return nil
+}
+
+// Items returns the user's items, including deleted, in the order they were last updated
+func (s *Server) Items(email string) (items []Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[email]
+	if !ok {
+		return nil
+	}
+
+	for _, si := range u.sortedItems() {
+		items = append(items, si.Item)
+	}
+
+	return items
+}
+
+// UpsertItem saves the item as if sent by another client, returning it with its new update time
+func (s *Server) UpsertItem(email string, item Item) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[email]
+	if !ok {
+		return Item{}, fmt.Errorf("user %s not found", email)
+	}
+
+	return s.save(u, item).Item, nil
+}
+
+// Requests returns the number of requests made to the path
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+func (s *Server) handleAuthParams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := r.URL.Query().Get("email")
+
+	u, ok := s.users[email]
+	if !ok {
+		// return consistent parameters for unknown accounts, so they cannot be discovered
+		writeJSON(w, http.StatusOK, pseudoKeyParams(email))
+		return
+	}
+
+	if !u.mfaSatisfied(r.URL.Query().Get(u.mfaKey)) {
+		writeMFARequired(w, u)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, u.keyParams)
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body map[string]interface{}
+
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	email := stringValue(body["email"])
+	password := stringValue(body["password"])
+
+	if email == "" || password == "" {
+		writeError(w, http.StatusBadRequest, "", "Please provide an email address and password.", nil)
+		return
+	}
+
+	cost, _ := strconv.ParseInt(stringValue(body["pw_cost"]), 10, 64)
+
+	params := KeyParams{
+		Identifier:    stringValue(body["identifier"]),
+		PasswordSalt:  stringValue(body["pw_salt"]),
+		PasswordCost:  cost,
+		PasswordNonce: stringValue(body["pw_nonce"]),
+		Version:       stringValue(body["version"]),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.addUser(email, password, params)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "", "This email is already registered.", nil)
+		return
+	}
+
+	s.writeSession(w, u)
+}
+
+func (s *Server) handleSignIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body map[string]interface{}
+
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[stringValue(body["email"])]
+	if !ok || u.password != stringValue(body["password"]) {
+		writeError(w, http.StatusUnauthorized, "", "Invalid email or password.", nil)
+		return
+	}
+
+	if !u.mfaSatisfied(stringValue(body[u.mfaKey])) {
+		writeMFARequired(w, u)
+		return
+	}
+
+	s.writeSession(w, u)
+}
+
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+		KeyParams
+	}
+
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, token, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if body.CurrentPassword != u.password {
+		writeError(w, http.StatusUnauthorized, "", "The current password you entered is incorrect. Please try again.", nil)
+		return
+	}
+
+	if body.NewPassword == "" {
+		writeError(w, http.StatusBadRequest, "", "Your new password is required to change your password. Please try again.", nil)
+		return
+	}
+
+	if body.Identifier == "" {
+		body.Identifier = u.email
+	}
+
+	u.password = body.NewPassword
+	u.keyParams = body.KeyParams
+
+	delete(s.tokens, token)
+
+	s.writeSession(w, u)
+}
+
+func (s *Server) handleSignOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, token, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	delete(s.tokens, token)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), nil)
+		return
+	}
+
+	if s.MaxRequestBytes > 0 && len(body) > s.MaxRequestBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, "", "payload too large", nil)
+		return
+	}
+
+	var req struct {
+		Items       []Item `json:"items"`
+		SyncToken   string `json:"sync_token"`
+		CursorToken string `json:"cursor_token"`
+		Limit       int    `json:"limit"`
+		API         string `json:"api"`
+	}
+
+	if err = json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), nil)
+		return
+	}
+
+	if s.MaxLimit > 0 && req.Limit > s.MaxLimit {
+		writeError(w, http.StatusRequestEntityTooLarge, "", "payload too large", nil)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, _, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	syncTime, err := parseToken(req.SyncToken)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "", "invalid sync token", nil)
+		return
+	}
+
+	cursorTime, err := parseToken(req.CursorToken)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "", "invalid cursor token", nil)
+		return
+	}
+
+	var resp struct {
+		RetrievedItems []Item      `json:"retrieved_items"`
+		SavedItems     []Item      `json:"saved_items"`
+		Unsaved        []Item      `json:"unsaved"`
+		Conflicts      []conflict  `json:"conflicts"`
+		SyncToken      string      `json:"sync_token"`
+		CursorToken    interface{} `json:"cursor_token"`
+	}
+
+	resp.RetrievedItems = []Item{}
+	resp.SavedItems = []Item{}
+	resp.Unsaved = []Item{}
+	resp.Conflicts = []conflict{}
+
+	saved := make(map[string]bool)
+
+	for _, item := range req.Items {
+		if owner, ok := s.owners[item.UUID]; ok && owner != u {
+			unsaved := item
+			resp.Conflicts = append(resp.Conflicts, conflict{Type: uuidConflict, UnsavedItem: &unsaved})
+
+			continue
+		}
+
+		if existing, ok := u.items[item.UUID]; ok && req.API == syncAPIVersion && isStale(item, existing) {
+			serverItem, unsaved := existing.Item, item
+			resp.Conflicts = append(resp.Conflicts, conflict{Type: syncConflict, ServerItem: &serverItem,
+				UnsavedItem: &unsaved})
+
+			continue
+		}
+
+		resp.SavedItems = append(resp.SavedItems, s.save(u, item).Item)
+		saved[item.UUID] = true
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	// continue from the cursor, if specified, otherwise retrieve changes since the last sync
+	since := syncTime
+	if !cursorTime.IsZero() {
+		since = cursorTime
+	}
+
+	for _, si := range u.sortedItems() {
+		switch {
+		case saved[si.UUID]:
+			continue
+		case syncTime.IsZero() && si.Deleted:
+			continue
+		case !si.updated.After(since):
+			continue
+		}
+
+		if len(resp.RetrievedItems) == limit {
+			// more remain, so return cursor to the last item retrieved
+			resp.CursorToken = makeToken(u.items[resp.RetrievedItems[limit-1].UUID].updated)
+			break
+		}
+
+		resp.RetrievedItems = append(resp.RetrievedItems, si.Item)
+	}
+
+	resp.SyncToken = makeToken(s.clock)
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// save stores the item with a new update time
+func (s *Server) save(u *user, item Item) *storedItem {
+	now := s.now()
+
+	si := &storedItem{
+		Item:    item,
+		updated: now,
+	}
+
+	si.UpdatedAt = now.Format(timeLayout)
+
+	if existing, ok := u.items[item.UUID]; ok {
+		si.CreatedAt = existing.CreatedAt
+	}
+
+	if si.CreatedAt == "" {
+		si.CreatedAt = si.UpdatedAt
+	}
+
+	if si.Deleted {
+		si.Content = ""
+		si.EncItemKey = ""
+		si.AuthHash = ""
+		si.ItemsKeyID = ""
+	}
+
+	u.items[item.UUID] = si
+	s.owners[item.UUID] = u
+
+	return si
+}
+
+// now returns the current time, advanced if required so that each item has a unique update time
+func (s *Server) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(s.clock) {
+		now = s.clock.Add(time.Millisecond)
+	}
+
+	s.clock = now
+
+	return now
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (u *user, token string, ok bool) {
+	token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	u, ok = s.tokens[token]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid-auth", "Invalid login credentials.", nil)
+	}
+
+	return u, token, ok
+}
+
+func (s *Server) writeSession(w http.ResponseWriter, u *user) {
+	b := make([]byte, 32)
+
+	if _, err := crand.Read(b); err != nil {
+		writeError(w, http.StatusInternalServerError, "", err.Error(), nil)
+		return
+	}
+
+	token := hex.EncodeToString(b)
+	s.tokens[token] = u
+
+	resp := map[string]interface{}{
+		"user": map[string]string{
+			"uuid":  u.uuid,
+			"email": u.email,
+		},
+		"token": token,
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (u *user) mfaSatisfied(token string) bool {
+	return u.mfaKey == "" || token == u.mfaToken
+}
+
+func (u *user) sortedItems() (items []*storedItem) {
+	for _, si := range u.items {
+		items = append(items, si)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].updated.Before(items[j].updated)
+	})
+
+	return items
+}
+
+// isStale returns true if the item was based on an older version than the server's
+func isStale(item Item, existing *storedItem) bool {
+	updated, err := time.Parse(timeLayout, item.UpdatedAt)
+	if err != nil {
+		return true
+	}
+
+	return updated.Before(existing.updated)
+}
+
+func pseudoKeyParams(email string) KeyParams {
+	nonce := sha256.Sum256([]byte("gosntest:" + email))
+
+	return KeyParams{
+		Identifier:    email,
+		PasswordCost:  defaultPasswordCost,
+		PasswordNonce: hex.EncodeToString(nonce[:]),
+		Version:       "003",
+	}
+}
+
+func writeMFARequired(w http.ResponseWriter, u *user) {
+	writeError(w, http.StatusUnauthorized, "mfa-required", "Please enter your two-factor authentication code.",
+		map[string]string{"mfa_key": u.mfaKey})
+}
+
+func makeToken(t time.Time) string {
+	return base64.StdEncoding.EncodeToString([]byte("2:" + strconv.FormatInt(t.UnixNano(), 10)))
+}
+
+func parseToken(token string) (t time.Time, err error) {
+	token = strings.TrimSpace(token)
+	if token == "" || token == "null" {
+		return
+	}
+
+	var b []byte
+
+	b, err = base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return
+	}
+
+	var nanos int64
+
+	nanos, err = strconv.ParseInt(strings.TrimPrefix(string(b), "2:"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	return time.Unix(0, nanos).UTC(), err
+}
+
+func stringValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), nil)
+		return false
+	}
+
+	return true
+}
+
+func writeError(w http.ResponseWriter, statusCode int, tag, message string, payload interface{}) {
+	e := map[string]interface{}{
+		"tag":     tag,
+		"message": message,
+	}
+
+	if payload != nil {
+		e["payload"] = payload
+	}
+
+	writeJSON(w, statusCode, map[string]interface{}{"error": e})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,295 @@
+package gosntest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testEmail    = "me@example.com"
+	testPassword = "derived-password"
+)
+
+type testSyncResponse struct {
+	RetrievedItems []Item      `json:"retrieved_items"`
+	SavedItems     []Item      `json:"saved_items"`
+	Conflicts      []conflict  `json:"conflicts"`
+	SyncToken      string      `json:"sync_token"`
+	CursorToken    interface{} `json:"cursor_token"`
+}
+
+func post(t *testing.T, url, token string, body interface{}) (statusCode int, respBody []byte) {
+	b, err := json.Marshal(body)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	assert.NoError(t, err)
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	respBody, err = ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	return resp.StatusCode, respBody
+}
+
+func signIn(t *testing.T, s *Server, body map[string]string) string {
+	statusCode, respBody := post(t, s.URL+signInPath, "", body)
+	assert.Equal(t, http.StatusOK, statusCode, string(respBody))
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+
+	assert.NoError(t, json.Unmarshal(respBody, &resp))
+
+	return resp.Token
+}
+
+func newTestServer(t *testing.T) (s *Server, token string) {
+	s = NewServer()
+	assert.NoError(t, s.AddUser(testEmail, testPassword, KeyParams{PasswordNonce: "nonce", Version: "004"}))
+
+	return s, signIn(t, s, map[string]string{"email": testEmail, "password": testPassword})
+}
+
+func doSync(t *testing.T, s *Server, token string, body map[string]interface{}) (resp testSyncResponse) {
+	statusCode, respBody := post(t, s.URL+syncPath, token, body)
+	assert.Equal(t, http.StatusOK, statusCode, string(respBody))
+	assert.NoError(t, json.Unmarshal(respBody, &resp))
+
+	return resp
+}
+
+func testItems(num int) (items []Item) {
+	for x := 1; x <= num; x++ {
+		items = append(items, Item{
+			UUID:        fmt.Sprintf("00000000-0000-0000-0000-%012d", x),
+			Content:     fmt.Sprintf("004:content-%d", x),
+			ContentType: "Note",
+			EncItemKey:  "004:key",
+		})
+	}
+
+	return items
+}
+
+func TestAuthParams(t *testing.T) {
+	s, _ := newTestServer(t)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + authParamsPath + "?email=" + testEmail)
+	assert.NoError(t, err)
+
+	var params KeyParams
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&params))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, KeyParams{Identifier: testEmail, PasswordNonce: "nonce", Version: "004"}, params)
+
+	// unknown accounts are given consistent parameters
+	resp, err = http.Get(s.URL + authParamsPath + "?email=unknown@example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&params))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, pseudoKeyParams("unknown@example.com"), params)
+}
+
+func TestSignInMFA(t *testing.T) {
+	s, _ := newTestServer(t)
+	defer s.Close()
+
+	assert.NoError(t, s.EnableMFA(testEmail, "mfa_1", "123456"))
+
+	statusCode, respBody := post(t, s.URL+signInPath, "", map[string]string{"email": testEmail,
+		"password": testPassword})
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+	assert.Contains(t, string(respBody), `"mfa_key":"mfa_1"`)
+
+	resp, err := http.Get(s.URL + authParamsPath + "?email=" + testEmail)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Get(s.URL + authParamsPath + "?email=" + testEmail + "&mfa_1=123456")
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.NotEmpty(t, signIn(t, s, map[string]string{"email": testEmail, "password": testPassword,
+		"mfa_1": "123456"}))
+}
+
+func TestSignInWithBadPassword(t *testing.T) {
+	s, _ := newTestServer(t)
+	defer s.Close()
+
+	statusCode, respBody := post(t, s.URL+signInPath, "", map[string]string{"email": testEmail, "password": "bad"})
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+	assert.Contains(t, string(respBody), "Invalid email or password.")
+}
+
+func TestSyncPagination(t *testing.T) {
+	s, token := newTestServer(t)
+	defer s.Close()
+
+	resp := doSync(t, s, token, map[string]interface{}{"items": testItems(5)})
+	assert.Len(t, resp.SavedItems, 5)
+
+	var retrieved []Item
+
+	var cursor interface{}
+
+	for {
+		resp = doSync(t, s, token, map[string]interface{}{"items": []Item{}, "limit": 2, "cursor_token": cursor})
+		retrieved = append(retrieved, resp.RetrievedItems...)
+
+		if resp.CursorToken == nil {
+			break
+		}
+
+		cursor = resp.CursorToken
+	}
+
+	assert.Equal(t, s.Items(testEmail), retrieved)
+
+	// only changes are retrieved with the sync token
+	changed := retrieved[2]
+	changed.Content = "004:changed"
+	_, err := s.UpsertItem(testEmail, changed)
+	assert.NoError(t, err)
+
+	resp = doSync(t, s, token, map[string]interface{}{"items": []Item{}, "sync_token": resp.SyncToken})
+	assert.Len(t, resp.RetrievedItems, 1)
+	assert.Equal(t, "004:changed", resp.RetrievedItems[0].Content)
+}
+
+func TestSyncDeletedItems(t *testing.T) {
+	s, token := newTestServer(t)
+	defer s.Close()
+
+	items := testItems(2)
+	resp := doSync(t, s, token, map[string]interface{}{"items": items})
+
+	deleted := resp.SavedItems[0]
+	deleted.Deleted = true
+	resp = doSync(t, s, token, map[string]interface{}{"items": []Item{deleted}, "sync_token": resp.SyncToken})
+	assert.Empty(t, resp.SavedItems[0].Content)
+
+	// deleted items are not returned by an initial sync
+	resp = doSync(t, s, token, map[string]interface{}{"items": []Item{}})
+	assert.Len(t, resp.RetrievedItems, 1)
+	assert.Equal(t, items[1].UUID, resp.RetrievedItems[0].UUID)
+}
+
+func TestSyncConflicts(t *testing.T) {
+	s, token := newTestServer(t)
+	defer s.Close()
+
+	resp := doSync(t, s, token, map[string]interface{}{"items": testItems(1), "api": syncAPIVersion})
+	original := resp.SavedItems[0]
+
+	changed := original
+	changed.Content = "004:changed"
+	_, err := s.UpsertItem(testEmail, changed)
+	assert.NoError(t, err)
+
+	local := original
+	local.Content = "004:local"
+	resp = doSync(t, s, token, map[string]interface{}{"items": []Item{local}, "api": syncAPIVersion})
+	assert.Empty(t, resp.SavedItems)
+	assert.Len(t, resp.Conflicts, 1)
+	assert.Equal(t, syncConflict, resp.Conflicts[0].Type)
+	assert.Equal(t, "004:changed", resp.Conflicts[0].ServerItem.Content)
+	assert.Equal(t, "004:local", resp.Conflicts[0].UnsavedItem.Content)
+
+	// items belonging to other accounts cannot be saved
+	assert.NoError(t, s.AddUser("other@example.com", testPassword, KeyParams{Version: "004"}))
+	otherToken := signIn(t, s, map[string]string{"email": "other@example.com", "password": testPassword})
+	resp = doSync(t, s, otherToken, map[string]interface{}{"items": []Item{local}, "api": syncAPIVersion})
+	assert.Len(t, resp.Conflicts, 1)
+	assert.Equal(t, uuidConflict, resp.Conflicts[0].Type)
+}
+
+func TestSyncPayloadTooLarge(t *testing.T) {
+	s, token := newTestServer(t)
+	defer s.Close()
+
+	s.MaxRequestBytes = 200
+	s.MaxLimit = 10
+
+	statusCode, _ := post(t, s.URL+syncPath, token, map[string]interface{}{"items": testItems(5)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+
+	statusCode, _ = post(t, s.URL+syncPath, token, map[string]interface{}{"items": []Item{}, "limit": 11})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+
+	statusCode, _ = post(t, s.URL+syncPath, token, map[string]interface{}{"items": []Item{}, "limit": 10})
+	assert.Equal(t, http.StatusOK, statusCode)
+}
+
+func TestSyncUnauthorized(t *testing.T) {
+	s, _ := newTestServer(t)
+	defer s.Close()
+
+	statusCode, _ := post(t, s.URL+syncPath, "invalid", map[string]interface{}{"items": []Item{}})
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+}
+
+func TestChangePassword(t *testing.T) {
+	s, token := newTestServer(t)
+	defer s.Close()
+
+	newParams := KeyParams{Identifier: testEmail, PasswordNonce: "new-nonce", Version: "004"}
+
+	statusCode, _ := post(t, s.URL+changePasswordPath, token, map[string]interface{}{
+		"current_password": "wrong", "new_password": "new", "pw_nonce": "new-nonce", "version": "004"})
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+
+	statusCode, _ = post(t, s.URL+changePasswordPath, token, map[string]interface{}{
+		"current_password": testPassword, "new_password": "new", "pw_nonce": "new-nonce", "version": "004"})
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	// previous token is revoked
+	statusCode, _ = post(t, s.URL+syncPath, token, map[string]interface{}{"items": []Item{}})
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+
+	resp, err := http.Get(s.URL + authParamsPath + "?email=" + testEmail)
+	assert.NoError(t, err)
+
+	var params KeyParams
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&params))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, newParams, params)
+
+	assert.NotEmpty(t, signIn(t, s, map[string]string{"email": testEmail, "password": "new"}))
+}
+
+func TestSignOut(t *testing.T) {
+	s, token := newTestServer(t)
+	defer s.Close()
+
+	statusCode, _ := post(t, s.URL+signOutPath, token, nil)
+	assert.Equal(t, http.StatusNoContent, statusCode)
+
+	// token is revoked
+	statusCode, _ = post(t, s.URL+syncPath, token, map[string]interface{}{"items": []Item{}})
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+
+	statusCode, _ = post(t, s.URL+signOutPath, token, nil)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+}
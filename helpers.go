@@ -1,6 +1,8 @@
 package gosn
 
 import (
+	"encoding/json"
+	"reflect"
 	"strings"
 
 	uuid "github.com/satori/go.uuid"
@@ -31,3 +33,91 @@ func stringInSlice(inStr string, inSlice []string, matchCase bool) bool {
 
 	return false
 }
+
+// marshalWithOther marshals the value and adds the other attributes not already present
+func marshalWithOther(v interface{}, other map[string]json.RawMessage) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(other) == 0 {
+		return b, err
+	}
+
+	var attrs map[string]json.RawMessage
+
+	if err = json.Unmarshal(b, &attrs); err != nil {
+		return nil, err
+	}
+
+	for k, o := range other {
+		if _, ok := attrs[k]; !ok {
+			attrs[k] = o
+		}
+	}
+
+	return json.Marshal(attrs)
+}
+
+// unmarshalWithOther unmarshals into the struct that v points to, returning the attributes it does not model
+func unmarshalWithOther(b []byte, v interface{}) (other map[string]json.RawMessage, err error) {
+	if err = json.Unmarshal(b, v); err != nil {
+		return
+	}
+
+	var attrs map[string]json.RawMessage
+
+	if err = json.Unmarshal(b, &attrs); err != nil {
+		return
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v).Elem())
+
+	for k, attr := range attrs {
+		if known[k] {
+			continue
+		}
+
+		if other == nil {
+			other = make(map[string]json.RawMessage)
+		}
+
+		other[k] = attr
+	}
+
+	return
+}
+
+// copyOther returns a copy of the other attributes, so changes to either are not seen by the other
+func copyOther(other map[string]json.RawMessage) map[string]json.RawMessage {
+	if other == nil {
+		return nil
+	}
+
+	res := make(map[string]json.RawMessage, len(other))
+
+	for k, o := range other {
+		res[k] = append(json.RawMessage(nil), o...)
+	}
+
+	return res
+}
+
+// jsonFieldNames returns the names of the struct's fields as they are marshalled
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+
+	for x := 0; x < t.NumField(); x++ {
+		f := t.Field(x)
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+
+		names[name] = true
+	}
+
+	return names
+}
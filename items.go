@@ -2,6 +2,7 @@ package gosn
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,10 +11,7 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
-	"strings"
 	"time"
-
-	"gopkg.in/matryer/try.v1"
 )
 
 // Item describes a decrypted item
@@ -25,6 +23,10 @@ type Item struct {
 	CreatedAt   string
 	UpdatedAt   string
 	ContentSize int
+	ItemsKeyID  string
+	// content as decrypted, encrypted byte for byte when Content is nil, as it is for types without a content model
+	// modelled content is also encrypted byte for byte, unless modified, in which case it is marshalled again
+	RawContent json.RawMessage
 }
 
 // returns a new, typeless item
@@ -139,11 +141,51 @@ type ClientStructure interface {
 type syncResponse struct {
 	Items       EncryptedItems `json:"retrieved_items"`
 	SavedItems  EncryptedItems `json:"saved_items"`
-	Unsaved     EncryptedItems `json:"unsaved"`
+	Unsaved     unsavedItems   `json:"unsaved"`
+	Conflicts   []Conflict     `json:"conflicts"`
 	SyncToken   string         `json:"sync_token"`
 	CursorToken string         `json:"cursor_token"`
 }
 
+// unsavedItems are the items the server refused to save, returned by the legacy sync API
+type unsavedItems EncryptedItems
+
+// UnmarshalJSON reads the unsaved items, held either alongside the error that prevented them being saved,
+// as returned by the legacy sync API, or on their own
+func (u *unsavedItems) UnmarshalJSON(b []byte) error {
+	var entries []json.RawMessage
+
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+
+	items := unsavedItems{}
+
+	for _, entry := range entries {
+		var wrapped struct {
+			Item *EncryptedItem `json:"item"`
+		}
+
+		if err := json.Unmarshal(entry, &wrapped); err != nil {
+			return err
+		}
+
+		if wrapped.Item == nil {
+			wrapped.Item = &EncryptedItem{}
+
+			if err := json.Unmarshal(entry, wrapped.Item); err != nil {
+				return err
+			}
+		}
+
+		items = append(items, *wrapped.Item)
+	}
+
+	*u = items
+
+	return nil
+}
+
 // AppTagConfig defines expected configuration structure for making Tag related operations
 type AppTagConfig struct {
 	Email    string
@@ -162,18 +204,22 @@ type GetItemsInput struct {
 	OutType     string
 	BatchSize   int // number of items to retrieve
 	PageSize    int // override default number of items to request with each sync call
-	Debug       bool
+	// optional store from which items are loaded, so that only changes since its sync token are retrieved
+	// the store is updated with the changes and the items it then holds are returned
+	Store ItemStore
+	Debug bool
 }
 
 // GetItemsOutput defines the output from retrieving items
 // It contains slices of items based on their state
 // see: https://standardfile.org/ for state details
 type GetItemsOutput struct {
-	Items      EncryptedItems // items new or modified since last sync
+	Items      EncryptedItems // items new or modified since last sync, or all stored items if using a store
 	SavedItems EncryptedItems // dirty items needing resolution
 	Unsaved    EncryptedItems // items not saved during sync
 	SyncToken  string
 	Cursor     string
+	ItemsKeys  ItemsKeys // session items keys plus any retrieved
 }
 
 const retryScaleFactor = 0.25
@@ -191,38 +237,45 @@ func resizeForRetry(in *GetItemsInput) {
 
 type EncryptedItems []EncryptedItem
 
+// Decrypt decrypts the items using the root keys and any items keys included in the set
 func (ei EncryptedItems) Decrypt(Mk, Ak string, debug bool) (o DecryptedItems, err error) {
-	debugPrint(debug, fmt.Sprintf("Decrypt | decrypting %d items", len(ei)))
+	return ei.DecryptWithItemsKeys(Mk, Ak, nil, debug)
+}
 
-	for _, eItem := range ei {
-		var item DecryptedItem
+// DecryptWithItemsKeys decrypts the items using the root keys and items keys provided, plus any items keys
+// included in the set. Items referencing an items key are decrypted with it, and all others with the root keys.
+func (ei EncryptedItems) DecryptWithItemsKeys(Mk, Ak string, iks ItemsKeys, debug bool) (o DecryptedItems, err error) {
+	debugPrint(debug, fmt.Sprintf("Decrypt | decrypting %d items", len(ei)))
 
-		if eItem.EncItemKey != "" {
-			var decryptedEncItemKey string
+	var setItemsKeys ItemsKeys
 
-			decryptedEncItemKey, err = decryptString(eItem.EncItemKey, Mk, Ak, eItem.UUID)
-			if err != nil {
-				return
-			}
+	setItemsKeys, err = ei.DecryptItemsKeys(Mk, Ak)
+	if err != nil {
+		return
+	}
 
-			itemEncryptionKey := decryptedEncItemKey[:len(decryptedEncItemKey)/2]
-			itemAuthKey := decryptedEncItemKey[len(decryptedEncItemKey)/2:]
+	iks = mergeItemsKeys(iks, setItemsKeys)
 
-			var decryptedContent string
+	for _, eItem := range ei {
+		key, authKey := Mk, Ak
 
-			decryptedContent, err = decryptString(eItem.Content, itemEncryptionKey, itemAuthKey, eItem.UUID)
-			if err != nil {
+		if eItem.ItemsKeyID != "" {
+			ik, ok := iks.Get(eItem.ItemsKeyID)
+			if !ok {
+				err = fmt.Errorf("items key \"%s\" required to decrypt item \"%s\" not found",
+					eItem.ItemsKeyID, eItem.UUID)
 				return
 			}
 
-			item.Content = decryptedContent
+			key, authKey = ik.ItemsKey, ik.AuthKey
 		}
 
-		item.UUID = eItem.UUID
-		item.Deleted = eItem.Deleted
-		item.ContentType = eItem.ContentType
-		item.UpdatedAt = eItem.UpdatedAt
-		item.CreatedAt = eItem.CreatedAt
+		var item DecryptedItem
+
+		item, err = decryptItem(eItem, key, authKey)
+		if err != nil {
+			return
+		}
 
 		o = append(o, item)
 	}
@@ -230,6 +283,43 @@ func (ei EncryptedItems) Decrypt(Mk, Ak string, debug bool) (o DecryptedItems, e
 	return o, err
 }
 
+func decryptItem(eItem EncryptedItem, key, authKey string) (item DecryptedItem, err error) {
+	switch {
+	case eItem.EncItemKey != "" && eItem.Version() == "001":
+		item.Content, err = decryptItem001(eItem, key)
+		if err != nil {
+			return
+		}
+	case eItem.EncItemKey != "":
+		var decryptedEncItemKey string
+
+		decryptedEncItemKey, err = decryptString(eItem.EncItemKey, key, authKey, eItem.UUID)
+		if err != nil {
+			return
+		}
+
+		itemEncryptionKey, itemAuthKey := splitItemKey(eItem.Version(), decryptedEncItemKey)
+
+		var decryptedContent string
+
+		decryptedContent, err = decryptString(eItem.Content, itemEncryptionKey, itemAuthKey, eItem.UUID)
+		if err != nil {
+			return
+		}
+
+		item.Content = decryptedContent
+	}
+
+	item.UUID = eItem.UUID
+	item.Deleted = eItem.Deleted
+	item.ContentType = eItem.ContentType
+	item.UpdatedAt = eItem.UpdatedAt
+	item.CreatedAt = eItem.CreatedAt
+	item.ItemsKeyID = eItem.ItemsKeyID
+
+	return item, err
+}
+
 func (ei EncryptedItems) DecryptAndParse(Mk, Ak string, debug bool) (o Items, err error) {
 	debugPrint(debug, fmt.Sprintf("DecryptAndParse | items: %d", len(ei)))
 
@@ -247,58 +337,124 @@ func (ei EncryptedItems) DecryptAndParse(Mk, Ak string, debug bool) (o Items, er
 
 // GetItems retrieves items from the API using optional filters
 func GetItems(input GetItemsInput) (output GetItemsOutput, err error) {
+	return defaultClient.GetItems(input)
+}
+
+// GetItemsWithContext is GetItems with a context that can cancel the requests made
+// If the context is cancelled, then the items retrieved so far are returned along with
+// the sync and cursor tokens required to resume retrieval, and the context's error
+func GetItemsWithContext(ctx context.Context, input GetItemsInput) (output GetItemsOutput, err error) {
+	return defaultClient.GetItemsWithContext(ctx, input)
+}
+
+// GetItems retrieves items from the API using optional filters
+func (c *Client) GetItems(input GetItemsInput) (output GetItemsOutput, err error) {
+	return c.GetItemsWithContext(context.Background(), input)
+}
+
+// GetItemsWithContext is GetItems with a context that can cancel the requests made
+func (c *Client) GetItemsWithContext(ctx context.Context, input GetItemsInput) (output GetItemsOutput, err error) {
 	giStart := time.Now()
 
 	defer func() {
-		debugPrint(input.Debug, fmt.Sprintf("GetItems | duration %v", time.Since(giStart)))
+		c.debugPrint(input.Debug, fmt.Sprintf("GetItems | duration %v", time.Since(giStart)))
 	}()
 
 	if !input.Session.Valid() {
-		err = fmt.Errorf("session is invalid")
+		err = ErrSessionInvalid
 		return
 	}
 
+	var stored EncryptedItems
+
+	var storedToken string
+
+	if input.Store != nil {
+		stored, storedToken, err = input.Store.Load()
+		if err != nil {
+			return
+		}
+
+		if input.SyncToken == "" && input.CursorToken == "" {
+			input.SyncToken = storedToken
+		}
+
+		c.debugPrint(input.Debug, fmt.Sprintf("GetItems | loaded %d stored items", len(stored)))
+	}
+
 	var sResp syncResponse
 
-	debugPrint(input.Debug, fmt.Sprintf("GetItems | PageSize %d", input.PageSize))
+	c.debugPrint(input.Debug, fmt.Sprintf("GetItems | PageSize %d", input.PageSize))
 	// retry logic is to handle responses that are too large
 	// so we can reduce number we retrieve with each sync request
 	start := time.Now()
-	rErr := try.Do(func(attempt int) (bool, error) {
-		debugPrint(input.Debug, fmt.Sprintf("GetItems | attempt %d", attempt))
+	rErr := retry(func(attempt int) (bool, error) {
+		c.debugPrint(input.Debug, fmt.Sprintf("GetItems | attempt %d", attempt))
 		var rErr error
-		sResp, rErr = getItemsViaAPI(input)
-		if rErr != nil && strings.Contains(strings.ToLower(rErr.Error()), "too large") {
-			debugPrint(input.Debug, fmt.Sprintf("GetItems | %s", rErr.Error()))
+		sResp, rErr = c.getItemsViaAPI(ctx, input)
+		if rErr != nil && ctx.Err() != nil {
+			return false, rErr
+		}
+		if errors.Is(rErr, ErrPayloadTooLarge) {
+			c.debugPrint(input.Debug, fmt.Sprintf("GetItems | %s", rErr.Error()))
 			initialSize := input.PageSize
 			resizeForRetry(&input)
-			debugPrint(input.Debug, fmt.Sprintf("GetItems | failed to retrieve %d items "+
+			c.debugPrint(input.Debug, fmt.Sprintf("GetItems | failed to retrieve %d items "+
 				"at a time so reducing to %d", initialSize, input.PageSize))
 		}
-		return attempt < 3, rErr
+		return attempt < c.retry.GetAttempts, rErr
 	})
 
-	if rErr != nil {
+	// when cancelled, continue so that the progress made is returned
+	if rErr != nil && ctx.Err() == nil {
 		return output, rErr
 	}
 
 	elapsed := time.Since(start)
 
-	debugPrint(input.Debug, fmt.Sprintf("GetItems | took %v to get all items", elapsed))
+	c.debugPrint(input.Debug, fmt.Sprintf("GetItems | took %v to get all items", elapsed))
 
 	postStart := time.Now()
 	output.Items = sResp.Items
 	output.Items.DeDupe()
-	output.Unsaved = sResp.Unsaved
+	output.Unsaved = EncryptedItems(sResp.Unsaved)
 	output.Unsaved.DeDupe()
 	output.SavedItems = sResp.SavedItems
 	output.SavedItems.DeDupe()
 	output.Cursor = sResp.CursorToken
 	output.SyncToken = sResp.SyncToken
+
+	// the stored token is only updated once all pages have been retrieved
+	if input.Store != nil && rErr == nil {
+		if output.Cursor == "" {
+			storedToken = output.SyncToken
+		}
+
+		if err = input.Store.Apply(output.Items, storedToken); err != nil {
+			err = fmt.Errorf("failed to update item store: %+v", err)
+			return
+		}
+
+		output.Items = mergeEncryptedItems(stored, output.Items)
+	}
+
+	var retrievedItemsKeys ItemsKeys
+
+	retrievedItemsKeys, err = output.Items.DecryptItemsKeys(input.Session.Mk, input.Session.Ak)
+	if err != nil {
+		return
+	}
+
+	output.ItemsKeys = mergeItemsKeys(input.Session.ItemsKeys, retrievedItemsKeys)
 	// strip any duplicates (https://github.com/standardfile/rails-engine/issues/5)
 	postElapsed := time.Since(postStart)
-	debugPrint(input.Debug, fmt.Sprintf("GetItems | post processing took %v", postElapsed))
-	debugPrint(input.Debug, fmt.Sprintf("GetItems | sync token: %+v", stripLineBreak(output.SyncToken)))
+	c.debugPrint(input.Debug, fmt.Sprintf("GetItems | post processing took %v", postElapsed))
+	c.debugPrint(input.Debug, fmt.Sprintf("GetItems | sync token: %+v", stripLineBreak(output.SyncToken)))
+
+	if rErr != nil {
+		c.debugPrint(input.Debug, fmt.Sprintf("GetItems | cancelled after retrieving %d items", len(output.Items)))
+		err = ctx.Err()
+	}
 
 	return output, err
 }
@@ -309,6 +465,8 @@ type PutItemsInput struct {
 	SyncToken string
 	Session   Session
 	Debug     bool
+	// re-encrypt any 001 or 002 items with the session's keys before putting
+	ReEncryptLegacyItems bool
 }
 
 // PutItemsOutput defines the output from putting items
@@ -352,25 +510,60 @@ func (i *Items) Validate() error {
 	return err
 }
 
+// Encrypt encrypts the items using the root keys, which must be 003 keys
+// Items of 004 accounts must be encrypted with an items key, using EncryptWithItemsKeys
 func (i *Items) Encrypt(Mk, Ak string, debug bool) (e EncryptedItems, err error) {
-	e, err = encryptItems(i, Mk, Ak, debug)
+	return i.EncryptWithItemsKeys(Mk, Ak, nil, debug)
+}
+
+// EncryptWithItemsKeys encrypts each item with the items key it references or, if it doesn't reference one,
+// the default items key. If no suitable items key is available the root keys are used, which must be 003 keys.
+func (i *Items) EncryptWithItemsKeys(Mk, Ak string, iks ItemsKeys, debug bool) (e EncryptedItems, err error) {
+	e, err = encryptItems(i, Mk, Ak, defaultSNVersion, iks, debug)
 	return
 }
 
 // PutItems validates and then syncs items via API
 func PutItems(i PutItemsInput) (output PutItemsOutput, err error) {
+	return defaultClient.PutItems(i)
+}
+
+// PutItemsWithContext is PutItems with a context that can cancel the requests made
+// If the context is cancelled, then the items saved so far are returned along with the context's error
+func PutItemsWithContext(ctx context.Context, i PutItemsInput) (output PutItemsOutput, err error) {
+	return defaultClient.PutItemsWithContext(ctx, i)
+}
+
+// PutItems validates and then syncs items via API
+func (c *Client) PutItems(i PutItemsInput) (output PutItemsOutput, err error) {
+	return c.PutItemsWithContext(context.Background(), i)
+}
+
+// PutItemsWithContext is PutItems with a context that can cancel the requests made
+func (c *Client) PutItemsWithContext(ctx context.Context, i PutItemsInput) (output PutItemsOutput, err error) {
 	piStart := time.Now()
 
 	defer func() {
-		debugPrint(i.Debug, fmt.Sprintf("PutItems | duration %v", time.Since(piStart)))
+		c.debugPrint(i.Debug, fmt.Sprintf("PutItems | duration %v", time.Since(piStart)))
 	}()
 
 	if !i.Session.Valid() {
-		err = fmt.Errorf("session is invalid")
+		err = ErrSessionInvalid
 		return
 	}
 
-	debugPrint(i.Debug, fmt.Sprintf("PutItems | putting %d items", len(i.Items)))
+	if i.ReEncryptLegacyItems {
+		i.Items, err = i.Items.reEncryptLegacy(i.Session, i.Debug)
+		if err != nil {
+			return
+		}
+	}
+
+	if err = i.Items.checkNotEncryptedWith001Keys(i.Session); err != nil {
+		return
+	}
+
+	c.debugPrint(i.Debug, fmt.Sprintf("PutItems | putting %d items", len(i.Items)))
 
 	// for each page size, send to push and get response
 	syncToken := stripLineBreak(i.SyncToken)
@@ -390,7 +583,7 @@ func PutItems(i PutItemsInput) (output PutItemsOutput, err error) {
 			lastItemInChunkIndex = x + PageSize
 		}
 
-		debugPrint(i.Debug, fmt.Sprintf("PutItems | putting items: %d to %d", x+1, lastItemInChunkIndex+1))
+		c.debugPrint(i.Debug, fmt.Sprintf("PutItems | putting items: %d to %d", x+1, lastItemInChunkIndex+1))
 
 		bigChunkSize := (lastItemInChunkIndex - x) + 1
 
@@ -402,28 +595,39 @@ func PutItems(i PutItemsInput) (output PutItemsOutput, err error) {
 		// initialise running total
 		totalPut := 0
 		// keep trying to push chunk of encrypted items in reducing subChunk sizes until it succeeds
-		maxAttempts := 20
-		try.MaxRetries = 20
+		maxAttempts := c.retry.PutAttempts
 
 		for {
-			rErr := try.Do(func(attempt int) (bool, error) {
+			rErr := retry(func(attempt int) (bool, error) {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return false, ctxErr
+				}
 				var rErr error
 				// if chunk is too big to put then try with smaller chunk
 				var encItemJSON []byte
 				itemsToPut := i.Items[subChunkStart : subChunkEnd+1]
 				encItemJSON, _ = json.Marshal(itemsToPut)
 				var s []EncryptedItem
-				s, syncToken, rErr = putChunk(i.Session, encItemJSON, i.Debug)
-				if rErr != nil && strings.Contains(strings.ToLower(rErr.Error()), "too large") {
+				s, syncToken, rErr = c.putChunk(ctx, i.Session, encItemJSON, i.Debug)
+				if errors.Is(rErr, ErrPayloadTooLarge) {
 					subChunkEnd = resizePutForRetry(subChunkStart, subChunkEnd, len(encItemJSON))
 				}
 				if rErr == nil {
 					savedItems = append(savedItems, s...)
 					totalPut += len(itemsToPut)
 				}
-				debugPrint(i.Debug, fmt.Sprintf("PutItems | attempt: %d of %d", attempt, maxAttempts))
+				c.debugPrint(i.Debug, fmt.Sprintf("PutItems | attempt: %d of %d", attempt, maxAttempts))
 				return attempt < maxAttempts, rErr
 			})
+			if rErr != nil && ctx.Err() != nil {
+				c.debugPrint(i.Debug, fmt.Sprintf("PutItems | cancelled after saving %d items", len(savedItems)))
+				output.ResponseBody.SyncToken = syncToken
+				output.ResponseBody.SavedItems = savedItems
+				err = ctx.Err()
+
+				return
+			}
+
 			if rErr != nil {
 				err = errors.New("failed to put all items")
 				return
@@ -458,6 +662,71 @@ func PutItems(i PutItemsInput) (output PutItemsOutput, err error) {
 	return output, err
 }
 
+func isLegacyVersion(version string) bool {
+	return version == "001" || version == "002"
+}
+
+// checkNotEncryptedWith001Keys returns an error if the session has 001 keys and any of the items are not
+// 001 items, as 001 keys have no auth key, so items encrypted with them cannot be read by other clients
+func (ei EncryptedItems) checkNotEncryptedWith001Keys(session Session) error {
+	if session.Version != "001" {
+		return nil
+	}
+
+	for _, eItem := range ei {
+		if !eItem.Deleted && eItem.Version() != "001" {
+			return fmt.Errorf("unable to encrypt item \"%s\" with 001 keys: change the password to upgrade them", eItem.UUID)
+		}
+	}
+
+	return nil
+}
+
+// reEncryptLegacy returns the items with any 001 and 002 items re-encrypted using the session's keys
+func (ei EncryptedItems) reEncryptLegacy(session Session, debug bool) (o EncryptedItems, err error) {
+	for _, eItem := range ei {
+		if eItem.Deleted || !isLegacyVersion(eItem.Version()) {
+			o = append(o, eItem)
+			continue
+		}
+
+		if session.Ak == "" && session.Version != "004" {
+			err = fmt.Errorf("unable to re-encrypt item \"%s\" with %s keys", eItem.UUID, session.Version)
+			return
+		}
+
+		var di DecryptedItem
+
+		di, err = decryptItem(eItem, session.Mk, session.Ak)
+		if err != nil {
+			return
+		}
+
+		var key, authKey, keyVersion, itemsKeyID string
+
+		key, authKey, keyVersion, itemsKeyID, err = session.ItemsKeys.keysForItem(Item{UUID: eItem.UUID},
+			session.Mk, session.Ak, session.Version)
+		if err != nil {
+			return
+		}
+
+		reItem := eItem
+		reItem.AuthHash = ""
+		reItem.ItemsKeyID = itemsKeyID
+
+		reItem.Content, reItem.EncItemKey, err = encryptContent(di.Content, keyVersion, key, authKey, eItem.UUID)
+		if err != nil {
+			return
+		}
+
+		debugPrint(debug, fmt.Sprintf("reEncryptLegacy | re-encrypted %s item: %s", eItem.Version(), eItem.UUID))
+
+		o = append(o, reItem)
+	}
+
+	return o, err
+}
+
 func resizePutForRetry(start, end, numBytes int) int {
 	preShrink := end
 	// reduce to 90%
@@ -479,13 +748,13 @@ func resizePutForRetry(start, end, numBytes int) int {
 	return end
 }
 
-func putChunk(session Session, encItemJSON []byte, debug bool) (savedItems []EncryptedItem, syncToken string, err error) {
+func (c *Client) putChunk(ctx context.Context, session Session, encItemJSON []byte, debug bool) (savedItems []EncryptedItem, syncToken string, err error) {
 	reqBody := []byte(`{"items":` + string(encItemJSON) +
 		`,"sync_token":"` + stripLineBreak(syncToken) + `"}`)
 
 	var syncRespBodyBytes []byte
 
-	syncRespBodyBytes, err = makeSyncRequest(session, reqBody, debug)
+	syncRespBodyBytes, err = c.makeSyncRequest(ctx, session, reqBody, debug)
 	if err != nil {
 		return
 	}
@@ -509,15 +778,23 @@ type EncryptedItem struct {
 	Content     string `json:"content"`
 	ContentType string `json:"content_type"`
 	EncItemKey  string `json:"enc_item_key"`
+	ItemsKeyID  string `json:"items_key_id,omitempty"`
+	AuthHash    string `json:"auth_hash,omitempty"` // 001 only
 	Deleted     bool   `json:"deleted"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
 }
 
+// Version returns the protocol version the item's content is encrypted with
+func (ei EncryptedItem) Version() string {
+	return getVersion(ei.Content)
+}
+
 type DecryptedItem struct {
 	UUID        string `json:"uuid"`
 	Content     string `json:"content"`
 	ContentType string `json:"content_type"`
+	ItemsKeyID  string `json:"items_key_id,omitempty"`
 	Deleted     bool   `json:"deleted"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
@@ -595,10 +872,10 @@ func (noteContent *NoteContent) UpsertReferences(newRefs ItemReferences) {
 	}
 }
 
-func makeSyncRequest(session Session, reqBody []byte, debug bool) (responseBody []byte, err error) {
+func (c *Client) makeSyncRequest(ctx context.Context, session Session, reqBody []byte, debug bool) (responseBody []byte, err error) {
 	var request *http.Request
 
-	request, err = http.NewRequest(http.MethodPost, session.Server+syncPath, bytes.NewBuffer(reqBody))
+	request, err = c.newRequest(ctx, http.MethodPost, session.Server+syncPath, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return
 	}
@@ -609,10 +886,10 @@ func makeSyncRequest(session Session, reqBody []byte, debug bool) (responseBody
 	var response *http.Response
 
 	start := time.Now()
-	response, err = httpClient.Do(request)
+	response, err = c.httpClient.Do(request)
 	elapsed := time.Since(start)
 
-	debugPrint(debug, fmt.Sprintf("makeSyncRequest | request took: %v", elapsed))
+	c.debugPrint(debug, fmt.Sprintf("makeSyncRequest | request took: %v", elapsed))
 
 	if err != nil {
 		return
@@ -620,65 +897,71 @@ func makeSyncRequest(session Session, reqBody []byte, debug bool) (responseBody
 
 	defer func() {
 		if err := response.Body.Close(); err != nil {
-			debugPrint(debug, fmt.Sprintf("makeSyncRequest | failed to close body closed"))
+			c.debugPrint(debug, fmt.Sprintf("makeSyncRequest | failed to close body closed"))
 		}
-		debugPrint(debug, fmt.Sprintf("makeSyncRequest | response body closed"))
+		c.debugPrint(debug, fmt.Sprintf("makeSyncRequest | response body closed"))
 	}()
 
-	switch response.StatusCode {
-	case 413:
-		err = errors.New("payload too large")
-		return
-	}
+	if response.StatusCode >= 400 {
+		c.debugPrint(debug, fmt.Sprintf("makeSyncRequest | sync of %d req bytes failed with: %s", len(reqBody), response.Status))
+
+		body, _ := ioutil.ReadAll(response.Body)
+		err = newAPIError(response.StatusCode, body)
 
-	if response.StatusCode > 400 {
-		debugPrint(debug, fmt.Sprintf("makeSyncRequest | sync of %d req bytes failed with: %s", len(reqBody), response.Status))
 		return
 	}
 
 	if response.StatusCode >= 200 && response.StatusCode < 300 {
-		debugPrint(debug, fmt.Sprintf("makeSyncRequest | sync of %d req bytes succeeded with: %s", len(reqBody), response.Status))
+		c.debugPrint(debug, fmt.Sprintf("makeSyncRequest | sync of %d req bytes succeeded with: %s", len(reqBody), response.Status))
 	}
 
 	readStart := time.Now()
 	responseBody, err = ioutil.ReadAll(response.Body)
-	debugPrint(debug, fmt.Sprintf("makeSyncRequest | response read took %+v", time.Since(readStart)))
+	c.debugPrint(debug, fmt.Sprintf("makeSyncRequest | response read took %+v", time.Since(readStart)))
 
 	if err != nil {
 		return
 	}
 
-	debugPrint(debug, fmt.Sprintf("makeSyncRequest | response size %d bytes", len(responseBody)))
+	c.debugPrint(debug, fmt.Sprintf("makeSyncRequest | response size %d bytes", len(responseBody)))
 
 	return responseBody, err
 }
 
-func getItemsViaAPI(input GetItemsInput) (out syncResponse, err error) {
+func (c *Client) getItemsViaAPI(ctx context.Context, input GetItemsInput) (out syncResponse, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	// determine how many items to retrieve with each call
 	var limit int
 
 	switch {
 	case input.BatchSize > 0:
-		debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI |input.BatchSize: %d", input.BatchSize))
+		c.debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI |input.BatchSize: %d", input.BatchSize))
 		// batch size must be lower than or equal to page size
 		limit = input.BatchSize
 	case input.PageSize > 0:
-		debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | input.PageSize: %d", input.PageSize))
+		c.debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | input.PageSize: %d", input.PageSize))
 		limit = input.PageSize
 	default:
-		debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | default - limit: %d", PageSize))
+		c.debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | default - limit: %d", PageSize))
 		limit = PageSize
 	}
 
-	debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | using limit: %d", limit))
+	c.debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | using limit: %d", limit))
 
 	var requestBody []byte
 	// generate request body
 	switch {
-	case input.CursorToken == "":
+	case input.CursorToken == "" && input.SyncToken == "":
 		requestBody = []byte(`{"limit":` + strconv.Itoa(limit) + `}`)
+	case input.CursorToken == "":
+		// retrieve the changes since the sync token
+		requestBody = []byte(`{"limit":` + strconv.Itoa(limit) +
+			`,"items":[],"sync_token":"` + stripLineBreak(input.SyncToken) + `\n"}`)
 	case input.CursorToken == "null":
-		debugPrint(input.Debug, "getItemsViaAPI | cursor is null")
+		c.debugPrint(input.Debug, "getItemsViaAPI | cursor is null")
 
 		requestBody = []byte(`{"limit":` + strconv.Itoa(limit) +
 			`,"items":[],"sync_token":"` + input.SyncToken + `\n","cursor_token":null}`)
@@ -691,12 +974,12 @@ func getItemsViaAPI(input GetItemsInput) (out syncResponse, err error) {
 	}
 
 	// make the request
-	debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | making request: %s", stripLineBreak(string(requestBody))))
+	c.debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | making request: %s", stripLineBreak(string(requestBody))))
 
 	msrStart := time.Now()
-	responseBody, err := makeSyncRequest(input.Session, requestBody, input.Debug)
+	responseBody, err := c.makeSyncRequest(ctx, input.Session, requestBody, input.Debug)
 	msrEnd := time.Since(msrStart)
-	debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | makeSyncRequest took: %v", msrEnd))
+	c.debugPrint(input.Debug, fmt.Sprintf("getItemsViaAPI | makeSyncRequest took: %v", msrEnd))
 
 	if err != nil {
 		return
@@ -727,15 +1010,25 @@ func getItemsViaAPI(input GetItemsInput) (out syncResponse, err error) {
 		input.CursorToken = out.CursorToken
 		input.PageSize = limit
 
-		newOutput, err = getItemsViaAPI(input)
+		newOutput, err = c.getItemsViaAPI(ctx, input)
 
-		if err != nil {
+		if err != nil && ctx.Err() == nil {
 			return
 		}
 
 		out.Items = append(out.Items, newOutput.Items...)
-		out.SavedItems = append(out.Items, newOutput.SavedItems...)
-		out.Unsaved = append(out.Items, newOutput.Unsaved...)
+		out.SavedItems = append(out.SavedItems, newOutput.SavedItems...)
+		out.Unsaved = append(out.Unsaved, newOutput.Unsaved...)
+
+		if err != nil {
+			// cancelled, so return the tokens required to resume from the last page retrieved
+			if newOutput.CursorToken != "" {
+				out.SyncToken = newOutput.SyncToken
+				out.CursorToken = newOutput.CursorToken
+			}
+
+			return out, err
+		}
 	} else {
 		return out, err
 	}
@@ -751,13 +1044,8 @@ type ItemReference struct {
 	UUID string `json:"uuid"`
 	// type of item being referenced
 	ContentType string `json:"content_type"`
-}
-
-type OrgStandardNotesSNDetail struct {
-	ClientUpdatedAt string `json:"client_updated_at"`
-}
-type AppDataContent struct {
-	OrgStandardNotesSN OrgStandardNotesSNDetail `json:"org.standardnotes.sn"`
+	// type of relationship, such as TagToParentTag, if not the item referencing the other
+	ReferenceType string `json:"reference_type,omitempty"`
 }
 
 type NoteContent struct {
@@ -765,6 +1053,32 @@ type NoteContent struct {
 	Text           string         `json:"text"`
 	ItemReferences ItemReferences `json:"references"`
 	AppData        AppDataContent `json:"appData"`
+
+	// attributes not modelled, such as those added by newer clients, written back as is
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON returns the modelled attributes along with any others retained when unmarshalled
+func (noteContent NoteContent) MarshalJSON() ([]byte, error) {
+	type content NoteContent
+
+	return marshalWithOther(content(noteContent), noteContent.Other)
+}
+
+// UnmarshalJSON populates the modelled attributes and retains any others
+func (noteContent *NoteContent) UnmarshalJSON(b []byte) (err error) {
+	type content NoteContent
+
+	var c content
+
+	c.Other, err = unmarshalWithOther(b, &c)
+	if err != nil {
+		return
+	}
+
+	*noteContent = NoteContent(c)
+
+	return
 }
 
 func (noteContent *NoteContent) GetUpdateTime() (time.Time, error) {
@@ -905,6 +1219,32 @@ type TagContent struct {
 	Title          string         `json:"title"`
 	ItemReferences ItemReferences `json:"references"`
 	AppData        AppDataContent `json:"appData"`
+
+	// attributes not modelled, such as those added by newer clients, written back as is
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON returns the modelled attributes along with any others retained when unmarshalled
+func (tagContent TagContent) MarshalJSON() ([]byte, error) {
+	type content TagContent
+
+	return marshalWithOther(content(tagContent), tagContent.Other)
+}
+
+// UnmarshalJSON populates the modelled attributes and retains any others
+func (tagContent *TagContent) UnmarshalJSON(b []byte) (err error) {
+	type content TagContent
+
+	var c content
+
+	c.Other, err = unmarshalWithOther(b, &c)
+	if err != nil {
+		return
+	}
+
+	*tagContent = TagContent(c)
+
+	return
 }
 
 type ComponentContent struct {
@@ -924,6 +1264,32 @@ type ComponentContent struct {
 	AssociatedItemIds  []string       `json:"associatedItemIds"`
 	ItemReferences     ItemReferences `json:"references"`
 	AppData            AppDataContent `json:"appData"`
+
+	// attributes not modelled, such as those added by newer clients, written back as is
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON returns the modelled attributes along with any others retained when unmarshalled
+func (cc ComponentContent) MarshalJSON() ([]byte, error) {
+	type content ComponentContent
+
+	return marshalWithOther(content(cc), cc.Other)
+}
+
+// UnmarshalJSON populates the modelled attributes and retains any others
+func (cc *ComponentContent) UnmarshalJSON(b []byte) (err error) {
+	type content ComponentContent
+
+	var c content
+
+	c.Other, err = unmarshalWithOther(b, &c)
+	if err != nil {
+		return
+	}
+
+	*cc = ComponentContent(c)
+
+	return
 }
 
 func (cc *ComponentContent) UpsertReferences(input ItemReferences) {
@@ -1061,15 +1427,23 @@ type Items []Item
 
 func (di *DecryptedItems) Parse() (p Items, err error) {
 	for _, i := range *di {
+		// items keys are managed as ItemsKeys rather than Items
+		if i.ContentType == itemsKeyContentType {
+			continue
+		}
+
 		var processedItem Item
 
 		processedItem.ContentType = i.ContentType
+		processedItem.ItemsKeyID = i.ItemsKeyID
 
 		if !i.Deleted {
 			processedItem.Content, err = processContentModel(i.ContentType, i.Content)
 			if err != nil {
 				return
 			}
+
+			processedItem.RawContent = json.RawMessage(i.Content)
 		}
 
 		var cAt, uAt time.Time
@@ -1128,6 +1502,11 @@ func processContentModel(contentType, input string) (output ClientStructure, err
 		var componentContent ComponentContent
 		err = json.Unmarshal([]byte(input), &componentContent)
 		return &componentContent, err
+	case smartTagContentType:
+		var smartTagContent SmartTagContent
+		err = json.Unmarshal([]byte(input), &smartTagContent)
+
+		return &smartTagContent, err
 	}
 
 	return
@@ -1234,16 +1613,18 @@ func (noteContent NoteContent) Copy() *NoteContent {
 	res := new(NoteContent)
 	res.Title = noteContent.Title
 	res.Text = noteContent.Text
-	res.AppData = noteContent.AppData
+	res.AppData = noteContent.AppData.copy()
 	res.ItemReferences = noteContent.ItemReferences
+	res.Other = copyOther(noteContent.Other)
 
 	return res
 }
 func (tagContent TagContent) Copy() *TagContent {
 	res := new(TagContent)
 	res.Title = tagContent.Title
-	res.AppData = tagContent.AppData
+	res.AppData = tagContent.AppData.copy()
 	res.ItemReferences = tagContent.ItemReferences
+	res.Other = copyOther(tagContent.Other)
 
 	return res
 }
@@ -1258,15 +1639,21 @@ func (item Item) Copy() *Item {
 	case *TagContent:
 		tContent := item.Content.(*TagContent)
 		res.Content = tContent.Copy()
+	case nil:
 	default:
 		fmt.Printf("unable to copy items with content of type: %s", reflect.TypeOf(item.Content))
 	}
 
+	if item.RawContent != nil {
+		res.RawContent = append(json.RawMessage(nil), item.RawContent...)
+	}
+
 	res.UpdatedAt = item.UpdatedAt
 	res.CreatedAt = item.CreatedAt
 	res.ContentSize = item.ContentSize
 	res.ContentType = item.ContentType
 	res.UUID = item.UUID
+	res.ItemsKeyID = item.ItemsKeyID
 
 	return res
 }
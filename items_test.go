@@ -1,8 +1,14 @@
 package gosn
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
@@ -457,6 +463,122 @@ func TestEncryptedItemsRemoveDeleted(t *testing.T) {
 	}
 }
 
+func TestEncryptAndDecryptItems004(t *testing.T) {
+	noteContent := NewNoteContent()
+	noteContent.Title = "Title"
+	noteContent.Text = "Text"
+
+	note := NewNote()
+	note.Content = noteContent
+
+	var testInput generateEncryptedPasswordInput
+	testInput.userPassword = "oWB7c&77Zahw8XK$AUy#"
+	testInput.Identifier = "soba@lessknown.co.uk"
+	testInput.PasswordNonce = "9e88fc67fb8b1efe92deeb98b5b6a801c78bdfae08eecb315f843f6badf60aef"
+	testInput.Version = "004"
+	_, mk, ak, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.NoError(t, err)
+
+	notes := Items{*note}
+
+	// 004 items must be encrypted with an items key rather than the root key
+	_, err = notes.Encrypt(mk, ak, false)
+	assert.Error(t, err)
+
+	ik := NewItemsKey()
+
+	var eNotes EncryptedItems
+	eNotes, err = notes.EncryptWithItemsKeys(mk, ak, ItemsKeys{ik}, false)
+	assert.NoError(t, err)
+	assert.Len(t, eNotes, 1)
+	assert.Equal(t, "004", eNotes[0].Version())
+	assert.True(t, strings.HasPrefix(eNotes[0].EncItemKey, "004:"))
+
+	var di DecryptedItems
+	di, err = eNotes.DecryptWithItemsKeys(mk, ak, ItemsKeys{ik}, false)
+	assert.NoError(t, err)
+
+	var dNotes Items
+	dNotes, err = di.Parse()
+	assert.NoError(t, err)
+	assert.Len(t, dNotes, 1)
+	assert.Equal(t, note.UUID, dNotes[0].UUID)
+	assert.Equal(t, "Title", dNotes[0].Content.GetTitle())
+	assert.Equal(t, "Text", dNotes[0].Content.GetText())
+}
+
+func TestDecryptAndParseMixedVersionItems(t *testing.T) {
+	mk := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	ak := "aca431d6fc360e46e853e19d70afec26e4825e2609c2e6df9f4431cbd344e1bc"
+
+	itemOne := encryptItem001(t, "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec", `{"title":"one","text":"001"}`, mk)
+
+	itemKey := "0f1e2d3c4b5a69788796a5b4c3d2e1f00112233445566778899aabbccddeeff0" +
+		"d8b0d0ea5bb0a1f4c7d4cf8e5fd3d0d9a4e1f3e0f5e4c3b2a1908f7e6d5c4b3a"
+	uuidTwo := "277613b2-f1df-4e95-985f-d23a08172e52"
+	itemTwo := EncryptedItem{
+		UUID:        uuidTwo,
+		Content:     encryptString002(t, `{"title":"two","text":"002"}`, itemKey[:64], itemKey[64:], uuidTwo),
+		ContentType: "Note",
+		EncItemKey:  encryptString002(t, itemKey, mk, ak, uuidTwo),
+		CreatedAt:   "2017-01-02T03:04:05.000Z",
+		UpdatedAt:   "2017-01-02T03:04:05.000Z",
+	}
+
+	noteContent := NewNoteContent()
+	noteContent.Title = "three"
+	noteContent.Text = "003"
+	note := NewNote()
+	note.Content = noteContent
+	notes := Items{*note}
+	eNotes, err := notes.Encrypt(mk, ak, false)
+	assert.NoError(t, err)
+
+	eItems := EncryptedItems{itemOne, itemTwo, eNotes[0]}
+
+	items, err := eItems.DecryptAndParse(mk, ak, false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+	assert.Equal(t, "001", items[0].Content.GetText())
+	assert.Equal(t, "002", items[1].Content.GetText())
+	assert.Equal(t, "003", items[2].Content.GetText())
+
+	// re-encrypting upgrades only the legacy items
+	session := Session{Mk: mk, Ak: ak, Version: "003"}
+	reItems, err := eItems.reEncryptLegacy(session, false)
+	assert.NoError(t, err)
+	assert.Len(t, reItems, 3)
+
+	for _, ri := range reItems {
+		assert.Equal(t, "003", ri.Version())
+		assert.Empty(t, ri.AuthHash)
+	}
+
+	assert.Equal(t, eItems[2], reItems[2])
+
+	reParsed, err := reItems.DecryptAndParse(mk, ak, false)
+	assert.NoError(t, err)
+	assert.Equal(t, items, reParsed)
+}
+
+func TestPutItemsRefuses001Keys(t *testing.T) {
+	mk := "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	session := Session{Mk: mk, Token: "token", Server: "https://example.com", Version: "001"}
+
+	// an item encrypted by a later version
+	notes := Items{*createNote("one", "one", "")}
+	eNotes, err := notes.Encrypt(session.Mk, "aca431d6fc360e46e853e19d70afec26e4825e2609c2e6df9f4431cbd344e1bc", false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eNotes})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "with 001 keys")
+
+	// 001 items are left as they are
+	legacy := EncryptedItems{encryptItem001(t, "fa9d5b81-7b2d-4d9b-988d-db09cee3f9ec", `{"title":"one"}`, mk)}
+	assert.NoError(t, legacy.checkNotEncryptedWith001Keys(session))
+}
+
 func TestNoteContentCopy(t *testing.T) {
 	initialNoteTitle := "Title"
 	initialNoteText := "Title"
@@ -1237,3 +1359,187 @@ func genNotes(num int, textParas int) (notes Items) {
 
 	return notes
 }
+
+func TestGetItemsWithContextCancelledReturnsProgress(t *testing.T) {
+	note := createEncryptedTestNote(t, "one", "one", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if requests > 1 {
+			// cancel while the next page is being retrieved
+			_, _ = ioutil.ReadAll(r.Body)
+
+			cancel()
+			<-r.Context().Done()
+
+			return
+		}
+
+		b, _ := json.Marshal(syncResponse{Items: EncryptedItems{note}, SyncToken: "token-1", CursorToken: "cursor-1"})
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	out, err := GetItemsWithContext(ctx, GetItemsInput{
+		Session: Session{Mk: testSyncMk, Ak: testSyncAk, Token: "token", Server: ts.URL},
+	})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, EncryptedItems{note}, out.Items)
+	assert.Equal(t, "token-1", out.SyncToken)
+	assert.Equal(t, "cursor-1", out.Cursor)
+}
+
+func TestGetItemsSendsSyncToken(t *testing.T) {
+	var req syncRequest
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &req))
+
+		b, _ := json.Marshal(syncResponse{SyncToken: "token-2"})
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	out, err := GetItems(GetItemsInput{
+		Session:   Session{Mk: testSyncMk, Ak: testSyncAk, Token: "token", Server: ts.URL},
+		SyncToken: "token-1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", stripLineBreak(req.SyncToken))
+	assert.Empty(t, req.CursorToken)
+	assert.Equal(t, "token-2", out.SyncToken)
+}
+
+func TestPutItemsWithContextCancelled(t *testing.T) {
+	note := createEncryptedTestNote(t, "one", "one", "")
+
+	var requests int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out, err := PutItemsWithContext(ctx, PutItemsInput{
+		Items:   EncryptedItems{note},
+		Session: Session{Mk: testSyncMk, Ak: testSyncAk, Token: "token", Server: ts.URL},
+	})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Zero(t, requests)
+	assert.Empty(t, out.ResponseBody.SavedItems)
+}
+
+func TestParseAndEncryptRetainUnknownContent(t *testing.T) {
+	raw := `{"title": "theme",  "package_info": {"version": "1.0"}, "references": []}`
+	// modelled content with its keys out of order and spaced
+	note := `{"text": "text", "title":"note","references":[],"protected":true,"appData":{"org.standardnotes.sn":{"client_updated_at":""}},"spellcheck":{"enabled":false}}`
+	tag := `{ "references":[],"title":"tag","appData":{"org.standardnotes.sn":{"client_updated_at":""}},"expanded":true }`
+	component := `{"area":"editor-editor", "name":"editor","newSetting":[1.0,2,3]}`
+
+	di := DecryptedItems{
+		{UUID: GenUUID(), ContentType: "SN|Theme", Content: raw, CreatedAt: "2020-01-01T10:00:00.000Z", UpdatedAt: "2020-01-01T10:00:00.000Z"},
+		{UUID: GenUUID(), ContentType: "Note", Content: note, CreatedAt: "2020-01-01T10:00:00.000Z", UpdatedAt: "2020-01-01T10:00:00.000Z"},
+		{UUID: GenUUID(), ContentType: "Tag", Content: tag, CreatedAt: "2020-01-01T10:00:00.000Z", UpdatedAt: "2020-01-01T10:00:00.000Z"},
+		{UUID: GenUUID(), ContentType: "SN|Component", Content: component, CreatedAt: "2020-01-01T10:00:00.000Z", UpdatedAt: "2020-01-01T10:00:00.000Z"},
+	}
+
+	items, err := di.Parse()
+	assert.NoError(t, err)
+	assert.Len(t, items, 4)
+	assert.Nil(t, items[0].Content)
+	assert.Equal(t, raw, string(items[0].RawContent))
+	assert.Equal(t, note, string(items[1].RawContent))
+	assert.Equal(t, "note", items[1].Content.GetTitle())
+
+	eItems, err := items.Encrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+
+	decrypted, err := eItems.Decrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+	assert.Len(t, decrypted, 4)
+
+	// unmodified content is encrypted byte for byte, whether or not it has a model
+	for x := range di {
+		assert.Equal(t, di[x].Content, decrypted[x].Content)
+	}
+
+	// modified content is marshalled again, retaining the attributes not modelled
+	items[1].Content.SetTitle("modified")
+
+	eItems, err = items.Encrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+
+	decrypted, err = eItems.Decrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, note, decrypted[1].Content)
+	assert.Equal(t, tag, decrypted[2].Content)
+
+	var expected, actual map[string]json.RawMessage
+
+	assert.NoError(t, json.Unmarshal([]byte(note), &expected))
+	assert.NoError(t, json.Unmarshal([]byte(decrypted[1].Content), &actual))
+	assert.JSONEq(t, `"modified"`, string(actual["title"]))
+
+	for k, v := range expected {
+		if k != "title" {
+			assert.JSONEq(t, string(v), string(actual[k]), k)
+		}
+	}
+}
+
+func TestCopyAndEncryptRetainUnknownContent(t *testing.T) {
+	raw := `{"title": "theme",  "package_info": {"version": "1.0"}, "references": []}`
+	note := `{"title":"note","text":"text","references":[],"appData":{"org.standardnotes.sn":{"client_updated_at":"","editorWidth":80},"org.example.app":{"a":1}},"protected":true}`
+	tag := `{"title":"tag","references":[],"appData":{"org.standardnotes.sn":{"client_updated_at":""}},"expanded":true}`
+
+	di := DecryptedItems{
+		{UUID: GenUUID(), ContentType: "SN|Theme", Content: raw, CreatedAt: "2020-01-01T10:00:00.000Z", UpdatedAt: "2020-01-01T10:00:00.000Z"},
+		{UUID: GenUUID(), ContentType: "Note", Content: note, CreatedAt: "2020-01-01T10:00:00.000Z", UpdatedAt: "2020-01-01T10:00:00.000Z"},
+		{UUID: GenUUID(), ContentType: "Tag", Content: tag, CreatedAt: "2020-01-01T10:00:00.000Z", UpdatedAt: "2020-01-01T10:00:00.000Z"},
+	}
+
+	items, err := di.Parse()
+	assert.NoError(t, err)
+
+	var copies Items
+	for _, item := range items {
+		copies = append(copies, *item.Copy())
+	}
+
+	// the copies do not share the attributes not modelled with the originals
+	copies[0].RawContent[0] = ' '
+	copies[1].Content.(*NoteContent).Other["protected"] = json.RawMessage(`false`)
+	copies[1].Content.(*NoteContent).AppData.Other["org.example.app"] = json.RawMessage(`{}`)
+	copies[2].Content.(*TagContent).Other["expanded"] = json.RawMessage(`false`)
+
+	assert.Equal(t, raw, string(items[0].RawContent))
+	assert.Equal(t, json.RawMessage(`true`), items[1].Content.(*NoteContent).Other["protected"])
+	assert.Equal(t, json.RawMessage(`{"a":1}`), items[1].Content.(*NoteContent).AppData.Other["org.example.app"])
+	assert.Equal(t, json.RawMessage(`true`), items[2].Content.(*TagContent).Other["expanded"])
+
+	copies = Items{}
+	for _, item := range items {
+		copies = append(copies, *item.Copy())
+	}
+
+	eItems, err := copies.Encrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+
+	decrypted, err := eItems.Decrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+	assert.Len(t, decrypted, 3)
+	assert.Equal(t, raw, decrypted[0].Content)
+	assert.Equal(t, note, decrypted[1].Content)
+	assert.Equal(t, tag, decrypted[2].Content)
+}
@@ -0,0 +1,322 @@
+package gosn
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const itemsKeyContentType = "SN|ItemsKey"
+
+// ItemsKey is a decrypted SN|ItemsKey item
+// Items keys are encrypted with the root key and are used to encrypt the item keys of all other items
+type ItemsKey struct {
+	UUID      string
+	ItemsKey  string // hex encoded encryption key
+	AuthKey   string // hex encoded authentication key (003 items keys only)
+	Version   string
+	Default   bool
+	CreatedAt string
+	UpdatedAt string
+}
+
+// ItemsKeys is a keyring of decrypted items keys
+type ItemsKeys []ItemsKey
+
+type itemsKeyContent struct {
+	ItemsKey              string `json:"itemsKey"`
+	DataAuthenticationKey string `json:"dataAuthenticationKey,omitempty"`
+	Version               string `json:"version"`
+	IsDefault             bool   `json:"isDefault"`
+}
+
+// NewItemsKey returns a new, default, 004 items key
+func NewItemsKey() ItemsKey {
+	keyBytes := make([]byte, 32)
+
+	_, err := crand.Read(keyBytes)
+	if err != nil {
+		panic(err)
+	}
+
+	now := time.Now().UTC().Format(timeLayout)
+
+	return ItemsKey{
+		UUID:      GenUUID(),
+		ItemsKey:  hex.EncodeToString(keyBytes),
+		Version:   "004",
+		Default:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Get returns the items key with the specified UUID
+func (iks ItemsKeys) Get(uuid string) (ItemsKey, bool) {
+	for _, ik := range iks {
+		if ik.UUID == uuid {
+			return ik, true
+		}
+	}
+
+	return ItemsKey{}, false
+}
+
+// Default returns the items key to use when encrypting new items
+func (iks ItemsKeys) Default() (ItemsKey, bool) {
+	for _, ik := range iks {
+		if ik.Default {
+			return ik, true
+		}
+	}
+
+	return ItemsKey{}, false
+}
+
+// Upsert adds the items key to the keyring, replacing any with the same UUID
+// If the items key is the default, then any existing default is unset
+func (iks *ItemsKeys) Upsert(ik ItemsKey) {
+	var updated ItemsKeys
+
+	for _, existing := range *iks {
+		if existing.UUID == ik.UUID {
+			continue
+		}
+
+		if ik.Default {
+			existing.Default = false
+		}
+
+		updated = append(updated, existing)
+	}
+
+	*iks = append(updated, ik)
+}
+
+// Encrypt returns the items key as an item encrypted with the root key
+// As with the official apps, 004 items keys are bound to the params of the root key, kp, that encrypts them
+func (ik ItemsKey) Encrypt(Mk, Ak string, kp KeyParams) (encryptedItem EncryptedItem, err error) {
+	var content []byte
+
+	content, err = json.Marshal(itemsKeyContent{
+		ItemsKey:              ik.ItemsKey,
+		DataAuthenticationKey: ik.AuthKey,
+		Version:               ik.Version,
+		IsDefault:             ik.Default,
+	})
+	if err != nil {
+		return
+	}
+
+	if ik.Version == "004" {
+		encryptedItem.Content, encryptedItem.EncItemKey, err = encryptContent004(string(content), Mk, ik.UUID, &kp)
+	} else {
+		encryptedItem.Content, encryptedItem.EncItemKey, err = encryptContent(string(content), ik.Version, Mk, Ak, ik.UUID)
+	}
+
+	if err != nil {
+		return
+	}
+
+	encryptedItem.UUID = ik.UUID
+	encryptedItem.ContentType = itemsKeyContentType
+	encryptedItem.CreatedAt = ik.CreatedAt
+	encryptedItem.UpdatedAt = ik.UpdatedAt
+
+	return encryptedItem, err
+}
+
+// DecryptItemsKeys decrypts the SN|ItemsKey items in the set using the root key
+func (ei EncryptedItems) DecryptItemsKeys(Mk, Ak string) (iks ItemsKeys, err error) {
+	for _, eItem := range ei {
+		if eItem.ContentType != itemsKeyContentType || eItem.Deleted {
+			continue
+		}
+
+		var di DecryptedItem
+
+		di, err = decryptItem(eItem, Mk, Ak)
+		if err != nil {
+			return
+		}
+
+		var content itemsKeyContent
+
+		err = json.Unmarshal([]byte(di.Content), &content)
+		if err != nil {
+			return
+		}
+
+		iks.Upsert(ItemsKey{
+			UUID:      eItem.UUID,
+			ItemsKey:  content.ItemsKey,
+			AuthKey:   content.DataAuthenticationKey,
+			Version:   content.Version,
+			Default:   content.IsDefault,
+			CreatedAt: eItem.CreatedAt,
+			UpdatedAt: eItem.UpdatedAt,
+		})
+	}
+
+	return iks, err
+}
+
+// mergeItemsKeys returns a new keyring containing the keys of both
+func mergeItemsKeys(existing, additional ItemsKeys) (merged ItemsKeys) {
+	merged = append(merged, existing...)
+
+	for _, ik := range additional {
+		merged.Upsert(ik)
+	}
+
+	return
+}
+
+// keysForItem returns the keys required to encrypt the item's key, their protocol version and the UUID of
+// the items key used, if any. The root keys, of the version specified, are used if no items key is available,
+// but only 003 root keys may encrypt items.
+func (iks ItemsKeys) keysForItem(item Item, Mk, Ak, version string) (key, authKey, keyVersion, itemsKeyID string,
+	err error) {
+	if item.ItemsKeyID != "" {
+		if ik, ok := iks.Get(item.ItemsKeyID); ok {
+			return ik.ItemsKey, ik.AuthKey, ik.Version, ik.UUID, err
+		}
+	}
+
+	if ik, ok := iks.Default(); ok {
+		return ik.ItemsKey, ik.AuthKey, ik.Version, ik.UUID, err
+	}
+
+	if version != "003" || Ak == "" {
+		err = fmt.Errorf("unable to encrypt item \"%s\" as no items key is available and only 003 root keys "+
+			"can be used in their place", item.UUID)
+		return
+	}
+
+	return Mk, Ak, version, "", err
+}
+
+// newDefaultItemsKey returns a new default items key for the session's protocol version
+// As with the official apps, a 003 items key holds the root key, so that items encrypted with it
+// remain readable by clients unaware of items keys
+func newDefaultItemsKey(session Session) (ik ItemsKey, err error) {
+	switch session.Version {
+	case "004":
+		return NewItemsKey(), err
+	case "003":
+		now := time.Now().UTC().Format(timeLayout)
+
+		return ItemsKey{
+			UUID:      GenUUID(),
+			ItemsKey:  session.Mk,
+			AuthKey:   session.Ak,
+			Version:   "003",
+			Default:   true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}, err
+	default:
+		return ik, fmt.Errorf("items keys are not supported by protocol version %s", session.Version)
+	}
+}
+
+// CreateItemsKey generates a new default items key and syncs it, encrypted with the session's root key
+// Any existing default items key is synced with its default flag unset
+// The new key is added to the session's items keys
+func CreateItemsKey(session *Session, debug bool) (ik ItemsKey, err error) {
+	return defaultClient.CreateItemsKeyWithContext(context.Background(), session, debug)
+}
+
+// CreateItemsKeyWithContext is CreateItemsKey with a context that can cancel the request made
+func CreateItemsKeyWithContext(ctx context.Context, session *Session, debug bool) (ik ItemsKey, err error) {
+	return defaultClient.CreateItemsKeyWithContext(ctx, session, debug)
+}
+
+// CreateItemsKey generates a new default items key and syncs it using the client
+func (c *Client) CreateItemsKey(session *Session, debug bool) (ik ItemsKey, err error) {
+	return c.CreateItemsKeyWithContext(context.Background(), session, debug)
+}
+
+// CreateItemsKeyWithContext is CreateItemsKey with a context that can cancel the request made
+func (c *Client) CreateItemsKeyWithContext(ctx context.Context, session *Session, debug bool) (ik ItemsKey, err error) {
+	ik, err = newDefaultItemsKey(*session)
+	if err != nil {
+		return
+	}
+
+	var toPut EncryptedItems
+
+	for _, existing := range session.ItemsKeys {
+		if !existing.Default {
+			continue
+		}
+
+		existing.Default = false
+		existing.UpdatedAt = ik.CreatedAt
+
+		var e EncryptedItem
+
+		e, err = existing.Encrypt(session.Mk, session.Ak, session.KeyParams)
+		if err != nil {
+			return
+		}
+
+		toPut = append(toPut, e)
+	}
+
+	var eik EncryptedItem
+
+	eik, err = ik.Encrypt(session.Mk, session.Ak, session.KeyParams)
+	if err != nil {
+		return
+	}
+
+	toPut = append(toPut, eik)
+
+	_, err = c.PutItemsWithContext(ctx, PutItemsInput{
+		Items:   toPut,
+		Session: *session,
+		Debug:   debug,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to put items key: %+v", err)
+		return
+	}
+
+	session.ItemsKeys.Upsert(ik)
+
+	return ik, err
+}
+
+// ensureDefaultItemsKey retrieves the account's items keys into the session and, if none is the default,
+// creates and syncs a new default items key, so that items are not encrypted with the root key
+func (c *Client) ensureDefaultItemsKey(ctx context.Context, session *Session, debug bool) (err error) {
+	if isLegacyVersion(session.Version) {
+		return
+	}
+
+	var output GetItemsOutput
+
+	output, err = c.GetItemsWithContext(ctx, GetItemsInput{
+		Session: *session,
+		Debug:   debug,
+	})
+	if err != nil {
+		return
+	}
+
+	session.ItemsKeys = output.ItemsKeys
+
+	if _, ok := session.ItemsKeys.Default(); ok {
+		return
+	}
+
+	c.debugPrint(debug, "ensureDefaultItemsKey | creating default items key")
+
+	_, err = c.CreateItemsKeyWithContext(ctx, session, debug)
+
+	return err
+}
@@ -0,0 +1,193 @@
+package gosn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jonhadfield/gosn/gosntest"
+	"github.com/stretchr/testify/assert"
+)
+
+func genTestRootKeys004(t *testing.T) (mk, ak string) {
+	var testInput generateEncryptedPasswordInput
+	testInput.userPassword = "oWB7c&77Zahw8XK$AUy#"
+	testInput.Identifier = "soba@lessknown.co.uk"
+	testInput.PasswordNonce = "9e88fc67fb8b1efe92deeb98b5b6a801c78bdfae08eecb315f843f6badf60aef"
+	testInput.Version = "004"
+	_, mk, ak, err := generateEncryptedPasswordAndKeys(testInput)
+	assert.NoError(t, err)
+
+	return mk, ak
+}
+
+func TestItemsKeysUpsertReplacesDefault(t *testing.T) {
+	ikOne := NewItemsKey()
+	ikTwo := NewItemsKey()
+
+	var iks ItemsKeys
+
+	iks.Upsert(ikOne)
+	iks.Upsert(ikTwo)
+	assert.Len(t, iks, 2)
+
+	def, ok := iks.Default()
+	assert.True(t, ok)
+	assert.Equal(t, ikTwo.UUID, def.UUID)
+
+	one, ok := iks.Get(ikOne.UUID)
+	assert.True(t, ok)
+	assert.False(t, one.Default)
+
+	// upserting an existing key replaces it
+	iks.Upsert(ikTwo)
+	assert.Len(t, iks, 2)
+}
+
+func TestEncryptAndDecryptItemsWithItemsKey(t *testing.T) {
+	mk, ak := genTestRootKeys004(t)
+
+	kp := KeyParams{
+		Identifier:    "soba@lessknown.co.uk",
+		PasswordNonce: "9e88fc67fb8b1efe92deeb98b5b6a801c78bdfae08eecb315f843f6badf60aef",
+		Version:       "004",
+	}
+
+	ik := NewItemsKey()
+	eik, err := ik.Encrypt(mk, ak, kp)
+	assert.NoError(t, err)
+	assert.Equal(t, "SN|ItemsKey", eik.ContentType)
+	assert.Empty(t, eik.ItemsKeyID)
+
+	// the root key's params are bound to the items key
+	for _, s := range []string{eik.Content, eik.EncItemKey} {
+		ad, err := base64.StdEncoding.DecodeString(strings.Split(s, ":")[3])
+		assert.NoError(t, err)
+
+		var authData authenticatedData004
+
+		assert.NoError(t, json.Unmarshal(ad, &authData))
+		assert.Equal(t, &kp, authData.KeyParams)
+	}
+
+	noteContent := NewNoteContent()
+	noteContent.Title = "Title"
+	noteContent.Text = "Text"
+	note := NewNote()
+	note.Content = noteContent
+	notes := Items{*note}
+
+	eNotes, err := notes.EncryptWithItemsKeys(mk, ak, ItemsKeys{ik}, false)
+	assert.NoError(t, err)
+	assert.Len(t, eNotes, 1)
+	assert.Equal(t, ik.UUID, eNotes[0].ItemsKeyID)
+
+	// item key must not be decryptable with the root key
+	_, err = eNotes.Decrypt(mk, ak, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+
+	// items key included in the set
+	items, err := append(eNotes, eik).DecryptAndParse(mk, ak, false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Text", items[0].Content.GetText())
+	assert.Equal(t, ik.UUID, items[0].ItemsKeyID)
+
+	// items key provided separately
+	di, err := eNotes.DecryptWithItemsKeys(mk, ak, ItemsKeys{ik}, false)
+	assert.NoError(t, err)
+	assert.Len(t, di, 1)
+
+	// decrypted items keys match the original
+	iks, err := EncryptedItems{eik}.DecryptItemsKeys(mk, ak)
+	assert.NoError(t, err)
+	assert.Len(t, iks, 1)
+	assert.Equal(t, ik, iks[0])
+}
+
+func TestEncryptItemsKeyAsItemFails(t *testing.T) {
+	mk, ak := genTestRootKeys004(t)
+	item := newItem()
+	item.ContentType = "SN|ItemsKey"
+	items := Items{*item}
+	_, err := items.Encrypt(mk, ak, false)
+	assert.Error(t, err)
+}
+
+func TestEncryptWithoutItemsKeyFailsFor004Keys(t *testing.T) {
+	mk, ak := genTestRootKeys004(t)
+	notes := Items{*createNote("one", "one", "")}
+
+	// 004 root keys must not be used in place of an items key
+	_, err := notes.Encrypt(mk, ak, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no items key is available")
+
+	_, err = DecryptedItems{{UUID: GenUUID(), ContentType: "Note", Content: "{}"}}.Encrypt(mk, ak, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no items key is available")
+}
+
+func TestRegisterCreatesDefaultItemsKey(t *testing.T) {
+	email, session := signInNewTestUser(t, "secret")
+
+	ik, ok := session.ItemsKeys.Default()
+	assert.True(t, ok)
+	// a 003 items key holds the root key
+	assert.Equal(t, "003", ik.Version)
+	assert.Equal(t, session.Mk, ik.ItemsKey)
+
+	// signing in again uses the existing items key
+	out, err := SignIn(SignInInput{Email: email, Password: "secret", APIServer: testServer.URL, EnsureItemsKey: true})
+	assert.NoError(t, err)
+	assert.Len(t, out.Session.ItemsKeys, 1)
+	assert.Len(t, testServer.Items(email), 1)
+}
+
+func TestSignInCreatesDefaultItemsKey(t *testing.T) {
+	if testServer == nil {
+		t.Skip("requires the in-memory server")
+	}
+
+	email := GenUUID() + "@example.com"
+
+	var input generateEncryptedPasswordInput
+	input.userPassword = "secret"
+	input.Identifier = email
+	input.PasswordNonce = "9e88fc67fb8b1efe92deeb98b5b6a801c78bdfae08eecb315f843f6badf60aef"
+	input.Version = "004"
+
+	pw, _, _, err := generateEncryptedPasswordAndKeys(input)
+	assert.NoError(t, err)
+	assert.NoError(t, testServer.AddUser(email, pw, gosntest.KeyParams{
+		PasswordNonce: input.PasswordNonce,
+		Version:       "004",
+	}))
+
+	// items keys are only retrieved, and created, on request
+	requests := testServer.Requests(syncPath)
+	out, err := SignIn(SignInInput{Email: email, Password: "secret", APIServer: testServer.URL})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Session.ItemsKeys)
+	assert.Equal(t, requests, testServer.Requests(syncPath))
+	assert.Empty(t, testServer.Items(email))
+
+	// the account has no items key, so one is created on sign-in
+	out, err = SignIn(SignInInput{Email: email, Password: "secret", APIServer: testServer.URL, EnsureItemsKey: true})
+	assert.NoError(t, err)
+
+	ik, ok := out.Session.ItemsKeys.Default()
+	assert.True(t, ok)
+	assert.Equal(t, "004", ik.Version)
+
+	items := testServer.Items(email)
+	assert.Len(t, items, 1)
+	assert.Equal(t, itemsKeyContentType, items[0].ContentType)
+
+	out, err = SignIn(SignInInput{Email: email, Password: "secret", APIServer: testServer.URL, EnsureItemsKey: true})
+	assert.NoError(t, err)
+	assert.Len(t, out.Session.ItemsKeys, 1)
+	assert.Equal(t, ik.UUID, out.Session.ItemsKeys[0].UUID)
+}
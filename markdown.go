@@ -0,0 +1,560 @@
+package gosn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// markdownTagsFileName is the file, in the root of an exported directory, that holds the tags
+	markdownTagsFileName = "tags.yaml"
+	// markdownFrontMatterDelimiter marks the start and end of a note's front matter
+	markdownFrontMatterDelimiter = "---\n"
+	// markdownMaxFileNameLength is the maximum number of characters of a title used in a file name
+	markdownMaxFileNameLength = 100
+)
+
+// markdownFrontMatter holds the attributes of a note that are not part of its text
+// App data and attributes without a front matter field of their own are held as JSON
+type markdownFrontMatter struct {
+	UUID               string              `yaml:"uuid"`
+	Title              string              `yaml:"title"`
+	Created            string              `yaml:"created"`
+	Updated            string              `yaml:"updated"`
+	ClientUpdated      string              `yaml:"client_updated,omitempty"`
+	Tags               []string            `yaml:"tags,omitempty"`
+	Pinned             bool                `yaml:"pinned,omitempty"`
+	Archived           bool                `yaml:"archived,omitempty"`
+	Locked             bool                `yaml:"locked,omitempty"`
+	Trashed            bool                `yaml:"trashed,omitempty"`
+	PrefersPlainEditor bool                `yaml:"prefers_plain_editor,omitempty"`
+	References         []markdownReference `yaml:"references,omitempty"`
+	AppData            string              `yaml:"app_data,omitempty"`
+	Other              string              `yaml:"other,omitempty"`
+}
+
+// markdownTag holds the attributes of a tag, with the notes it references recorded in their front matter
+type markdownTag struct {
+	UUID          string              `yaml:"uuid"`
+	Title         string              `yaml:"title"`
+	Created       string              `yaml:"created"`
+	Updated       string              `yaml:"updated"`
+	ClientUpdated string              `yaml:"client_updated,omitempty"`
+	Parent        string              `yaml:"parent,omitempty"`
+	References    []markdownReference `yaml:"references,omitempty"`
+	AppData       string              `yaml:"app_data,omitempty"`
+	Other         string              `yaml:"other,omitempty"`
+}
+
+// markdownReference holds a reference to an item
+type markdownReference struct {
+	UUID          string `yaml:"uuid"`
+	ContentType   string `yaml:"content_type"`
+	ReferenceType string `yaml:"reference_type,omitempty"`
+}
+
+// ExportMarkdown writes each note to a Markdown file, with its attributes and the UUIDs of its tags held in
+// YAML front matter
+// Notes are written to a folder named after their first tag, by title, or the root if untagged, and the tags
+// themselves are written to tags.yaml, so the directory can be imported again with ImportMarkdown
+// The directory is created if it does not exist and must otherwise be empty
+func ExportMarkdown(dir string, items Items) (err error) {
+	if err = prepareMarkdownDir(dir); err != nil {
+		return
+	}
+
+	var notes, tags Items
+
+	for _, item := range items {
+		if item.Deleted || item.Content == nil {
+			continue
+		}
+
+		switch item.ContentType {
+		case "Note":
+			notes = append(notes, item)
+		case "Tag":
+			tags = append(tags, item)
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Content.GetTitle() < tags[j].Content.GetTitle()
+	})
+
+	noteTags := make(map[string][]string)
+	tagTitles := make(map[string]string)
+
+	var mTags []markdownTag
+
+	for _, tag := range tags {
+		tc, ok := tag.Content.(*TagContent)
+		if !ok {
+			continue
+		}
+
+		mt := markdownTag{
+			UUID:          tag.UUID,
+			Title:         tc.Title,
+			Created:       tag.CreatedAt,
+			Updated:       tag.UpdatedAt,
+			ClientUpdated: tc.AppData.OrgStandardNotesSN.ClientUpdatedAt,
+			Parent:        tc.ParentUUID(),
+		}
+
+		for _, ref := range tc.ItemReferences {
+			switch {
+			case ref.ContentType == "Note":
+				noteTags[ref.UUID] = append(noteTags[ref.UUID], tag.UUID)
+			case ref.ReferenceType != tagToParentTagReferenceType:
+				mt.References = append(mt.References, markdownReference(ref))
+			}
+		}
+
+		mt.AppData, mt.Other, err = marshalMarkdownAttributes(tc.AppData, tc.Other)
+		if err != nil {
+			return
+		}
+
+		mTags = append(mTags, mt)
+		tagTitles[tag.UUID] = tc.Title
+	}
+
+	if len(mTags) > 0 {
+		var b []byte
+
+		b, err = yaml.Marshal(mTags)
+		if err != nil {
+			return
+		}
+
+		if err = writeFileAtomic(filepath.Join(dir, markdownTagsFileName), b); err != nil {
+			return
+		}
+	}
+
+	written := make(map[string]bool)
+
+	for _, note := range notes {
+		nc, ok := note.Content.(*NoteContent)
+		if !ok {
+			continue
+		}
+
+		fm := markdownFrontMatter{
+			UUID:               note.UUID,
+			Title:              nc.Title,
+			Created:            note.CreatedAt,
+			Updated:            note.UpdatedAt,
+			ClientUpdated:      nc.AppData.OrgStandardNotesSN.ClientUpdatedAt,
+			Tags:               noteTags[note.UUID],
+			Pinned:             nc.IsPinned(),
+			Archived:           nc.IsArchived(),
+			Locked:             nc.IsLocked(),
+			Trashed:            nc.IsTrashed(),
+			PrefersPlainEditor: nc.PrefersPlainEditor(),
+		}
+
+		for _, ref := range nc.ItemReferences {
+			fm.References = append(fm.References, markdownReference(ref))
+		}
+
+		fm.AppData, fm.Other, err = marshalMarkdownAttributes(nc.AppData, nc.Other)
+		if err != nil {
+			return
+		}
+
+		folder := dir
+		if len(fm.Tags) > 0 {
+			folder = filepath.Join(dir, markdownFileName(tagTitles[fm.Tags[0]], "untitled"))
+		}
+
+		name := markdownFileName(fm.Title, note.UUID)
+
+		path := filepath.Join(folder, name+".md")
+		if written[path] {
+			path = filepath.Join(folder, fmt.Sprintf("%s-%s.md", name, note.UUID))
+		}
+
+		if err = os.MkdirAll(folder, 0700); err != nil {
+			return
+		}
+
+		var b []byte
+
+		b, err = marshalMarkdownNote(fm, nc.Text)
+		if err != nil {
+			return
+		}
+
+		if err = writeFileAtomic(path, b); err != nil {
+			return
+		}
+
+		written[path] = true
+	}
+
+	return err
+}
+
+// ImportMarkdown reads a directory of Markdown files, as written by ExportMarkdown, returning the notes
+// and the tags, with each tag referencing the notes that list it in their front matter
+// Tags listed in front matter are matched by UUID against those in tags.yaml, falling back to title, so
+// tags can be added by hand
+// Files without front matter are imported as new notes, titled after the file, and tagged with the name
+// of the folder they are in, if any
+func ImportMarkdown(dir string) (items Items, err error) {
+	var tags Items
+
+	tags, err = readMarkdownTags(dir)
+	if err != nil {
+		return
+	}
+
+	tagsByUUID := make(map[string]int)
+	tagsByTitle := make(map[string]int)
+
+	for x := range tags {
+		tagsByUUID[tags[x].UUID] = x
+
+		if _, ok := tagsByTitle[tags[x].Content.GetTitle()]; !ok {
+			tagsByTitle[tags[x].Content.GetTitle()] = x
+		}
+	}
+
+	var notes Items
+
+	tagged := make(map[int]Items)
+	paths := make(map[string]string)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, wErr error) error {
+		if wErr != nil {
+			return wErr
+		}
+
+		if info.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		note, noteTags, rErr := readMarkdownNote(dir, path)
+		if rErr != nil {
+			return rErr
+		}
+
+		if existing, ok := paths[note.UUID]; ok {
+			return fmt.Errorf("notes %s and %s have the same uuid %s", existing, path, note.UUID)
+		}
+
+		paths[note.UUID] = path
+
+		for _, noteTag := range noteTags {
+			x, ok := tagsByUUID[noteTag]
+			if !ok {
+				x, ok = tagsByTitle[noteTag]
+			}
+
+			if !ok {
+				tag := NewTag()
+				tc := NewTagContent()
+				tc.Title = noteTag
+				tc.ItemReferences = ItemReferences{}
+				tag.Content = tc
+
+				tags = append(tags, *tag)
+				x = len(tags) - 1
+				tagsByTitle[noteTag] = x
+			}
+
+			tagged[x] = append(tagged[x], note)
+		}
+
+		notes = append(notes, note)
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for x := range tags {
+		if len(tagged[x]) == 0 {
+			continue
+		}
+
+		tags[x] = UpdateItemRefs(UpdateItemRefsInput{
+			Items: Items{tags[x]},
+			ToRef: tagged[x],
+		}).Items[0]
+	}
+
+	return append(notes, tags...), err
+}
+
+// prepareMarkdownDir creates the directory, returning an error if it exists and is not empty
+func prepareMarkdownDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.MkdirAll(dir, 0700)
+		}
+
+		return err
+	}
+
+	if len(files) > 0 {
+		return fmt.Errorf("directory %s is not empty", dir)
+	}
+
+	return nil
+}
+
+// markdownFileName returns the name, less any characters not permitted in file names, or the fallback if empty
+func markdownFileName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+
+		return r
+	}, name)
+
+	if r := []rune(name); len(r) > markdownMaxFileNameLength {
+		name = string(r[:markdownMaxFileNameLength])
+	}
+
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return fallback
+	}
+
+	return name
+}
+
+// marshalMarkdownAttributes returns, as JSON, the app data without a front matter field of its own and the
+// attributes not modelled, or empty strings if there are none
+func marshalMarkdownAttributes(ad AppDataContent, other map[string]json.RawMessage) (appData, attrs string, err error) {
+	if len(ad.Other) > 0 || len(ad.OrgStandardNotesSN.Other) > 0 {
+		var b []byte
+
+		b, err = json.Marshal(AppDataContent{
+			OrgStandardNotesSN: OrgStandardNotesSNDetail{Other: ad.OrgStandardNotesSN.Other},
+			Other:              ad.Other,
+		})
+		if err != nil {
+			return
+		}
+
+		appData = string(b)
+	}
+
+	if len(other) > 0 {
+		var b []byte
+
+		b, err = json.Marshal(other)
+		if err != nil {
+			return
+		}
+
+		attrs = string(b)
+	}
+
+	return
+}
+
+// unmarshalMarkdownAttributes populates the app data and attributes not modelled from their JSON, if any
+func unmarshalMarkdownAttributes(appData, attrs string, ad *AppDataContent, other *map[string]json.RawMessage) (err error) {
+	if appData != "" {
+		if err = json.Unmarshal([]byte(appData), ad); err != nil {
+			return fmt.Errorf("failed to read app data: %w", err)
+		}
+	}
+
+	if attrs != "" {
+		if err = json.Unmarshal([]byte(attrs), other); err != nil {
+			return fmt.Errorf("failed to read other attributes: %w", err)
+		}
+	}
+
+	return
+}
+
+// markdownReferences returns the references held in front matter or tags.yaml
+func markdownReferences(mRefs []markdownReference) ItemReferences {
+	refs := ItemReferences{}
+
+	for _, ref := range mRefs {
+		refs = append(refs, ItemReference(ref))
+	}
+
+	return refs
+}
+
+func marshalMarkdownNote(fm markdownFrontMatter, text string) ([]byte, error) {
+	b, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(markdownFrontMatterDelimiter)
+	buf.Write(b)
+	buf.WriteString(markdownFrontMatterDelimiter)
+	buf.WriteString(text)
+
+	return buf.Bytes(), nil
+}
+
+// splitMarkdownNote returns a note's front matter and text, with the front matter empty if it has none
+func splitMarkdownNote(content string) (fm, text string, err error) {
+	if !strings.HasPrefix(content, markdownFrontMatterDelimiter) {
+		return "", content, nil
+	}
+
+	rest := content[len(markdownFrontMatterDelimiter):]
+	if strings.HasPrefix(rest, markdownFrontMatterDelimiter) {
+		return "", rest[len(markdownFrontMatterDelimiter):], nil
+	}
+
+	end := strings.Index(rest, "\n"+markdownFrontMatterDelimiter)
+	if end == -1 {
+		return "", "", errors.New("front matter is not terminated")
+	}
+
+	return rest[:end+1], rest[end+1+len(markdownFrontMatterDelimiter):], nil
+}
+
+// readMarkdownNote returns the note held in the file and the UUIDs, or titles, of its tags
+func readMarkdownNote(dir, path string) (note Item, tags []string, err error) {
+	var b []byte
+
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var rawFM, text string
+
+	rawFM, text, err = splitMarkdownNote(string(b))
+	if err != nil {
+		err = fmt.Errorf("failed to read %s: %w", path, err)
+		return
+	}
+
+	note = *NewNote()
+	nc := NewNoteContent()
+	nc.Text = text
+	nc.ItemReferences = ItemReferences{}
+
+	if rawFM == "" {
+		nc.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		if folder := filepath.Dir(path); folder != filepath.Clean(dir) {
+			tags = []string{filepath.Base(folder)}
+		}
+
+		note.Content = nc
+
+		return note, tags, err
+	}
+
+	var fm markdownFrontMatter
+
+	if err = yaml.Unmarshal([]byte(rawFM), &fm); err != nil {
+		err = fmt.Errorf("failed to read front matter of %s: %w", path, err)
+		return
+	}
+
+	if fm.UUID != "" {
+		note.UUID = fm.UUID
+	}
+
+	if fm.Created != "" {
+		note.CreatedAt = fm.Created
+	}
+
+	if fm.Updated != "" {
+		note.UpdatedAt = fm.Updated
+	}
+
+	if err = unmarshalMarkdownAttributes(fm.AppData, fm.Other, &nc.AppData, &nc.Other); err != nil {
+		err = fmt.Errorf("failed to read front matter of %s: %w", path, err)
+		return
+	}
+
+	nc.Title = fm.Title
+	nc.ItemReferences = markdownReferences(fm.References)
+	nc.AppData.OrgStandardNotesSN.ClientUpdatedAt = fm.ClientUpdated
+	nc.SetPinned(fm.Pinned)
+	nc.SetArchived(fm.Archived)
+	nc.SetLocked(fm.Locked)
+	nc.SetTrashed(fm.Trashed)
+	nc.SetPrefersPlainEditor(fm.PrefersPlainEditor)
+	note.Content = nc
+
+	return note, fm.Tags, err
+}
+
+// readMarkdownTags returns the tags held in the directory's tags file, without references to notes
+func readMarkdownTags(dir string) (tags Items, err error) {
+	var b []byte
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, markdownTagsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	var mTags []markdownTag
+
+	if err = yaml.Unmarshal(b, &mTags); err != nil {
+		err = fmt.Errorf("failed to read %s: %w", markdownTagsFileName, err)
+		return
+	}
+
+	for _, mt := range mTags {
+		tag := NewTag()
+		if mt.UUID != "" {
+			tag.UUID = mt.UUID
+		}
+
+		if mt.Created != "" {
+			tag.CreatedAt = mt.Created
+		}
+
+		if mt.Updated != "" {
+			tag.UpdatedAt = mt.Updated
+		}
+
+		tc := NewTagContent()
+
+		if err = unmarshalMarkdownAttributes(mt.AppData, mt.Other, &tc.AppData, &tc.Other); err != nil {
+			err = fmt.Errorf("failed to read tag %s in %s: %w", mt.UUID, markdownTagsFileName, err)
+			return
+		}
+
+		tc.Title = mt.Title
+		tc.ItemReferences = markdownReferences(mt.References)
+		tc.AppData.OrgStandardNotesSN.ClientUpdatedAt = mt.ClientUpdated
+		tc.SetParentUUID(mt.Parent)
+
+		tag.Content = tc
+
+		tags = append(tags, *tag)
+	}
+
+	return tags, err
+}
@@ -0,0 +1,157 @@
+package gosn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportMarkdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosn-markdown")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	dir = filepath.Join(dir, "export")
+
+	first := createNote("first/note", "# heading\n\n---\nnot front matter", "")
+	first.Content.(*NoteContent).SetPinned(true)
+	second := createNote("second", "no trailing newline", "")
+	second.Content.(*NoteContent).SetArchived(true)
+	duplicate := createNote("first/note", "same title", "")
+	deleted := createNote("deleted", "deleted", "")
+	deleted.Deleted = true
+
+	work := createTag("work", "")
+	home := createTag("home", "")
+	empty := createTag("empty", "")
+	empty.Content.(*TagContent).SetParentUUID(work.UUID)
+	tagged := UpdateItemRefs(UpdateItemRefsInput{Items: Items{*work}, ToRef: Items{*first, *duplicate}}).Items
+	tagged = append(tagged, UpdateItemRefs(UpdateItemRefsInput{Items: Items{*home}, ToRef: Items{*first}}).Items...)
+
+	items := append(Items{*first, *second, *duplicate, *deleted, *empty}, tagged...)
+
+	assert.NoError(t, ExportMarkdown(dir, items))
+	assert.FileExists(t, filepath.Join(dir, "home", "first-note.md"))
+	assert.FileExists(t, filepath.Join(dir, "work", "first-note.md"))
+	assert.FileExists(t, filepath.Join(dir, "second.md"))
+	assert.FileExists(t, filepath.Join(dir, markdownTagsFileName))
+	assert.Error(t, ExportMarkdown(dir, items))
+
+	imported, err := ImportMarkdown(dir)
+	assert.NoError(t, err)
+	assert.Len(t, imported, 6)
+
+	byUUID := make(map[string]Item)
+	for _, item := range imported {
+		byUUID[item.UUID] = item
+	}
+
+	assert.NotContains(t, byUUID, deleted.UUID)
+
+	for _, note := range []Item{*first, *second, *duplicate} {
+		in := byUUID[note.UUID]
+		assert.Equal(t, "Note", in.ContentType)
+		assert.Equal(t, note.CreatedAt, in.CreatedAt)
+		assert.Equal(t, note.UpdatedAt, in.UpdatedAt)
+		assert.Equal(t, note.Content.(*NoteContent).Title, in.Content.(*NoteContent).Title)
+		assert.Equal(t, note.Content.(*NoteContent).Text, in.Content.(*NoteContent).Text)
+		assert.Equal(t, note.Content.(*NoteContent).AppData, in.Content.(*NoteContent).AppData)
+	}
+
+	for _, tag := range append(tagged, *empty) {
+		in := byUUID[tag.UUID]
+		assert.Equal(t, "Tag", in.ContentType)
+		assert.Equal(t, tag.CreatedAt, in.CreatedAt)
+		assert.Equal(t, tag.UpdatedAt, in.UpdatedAt)
+		assert.Equal(t, tag.Content.GetTitle(), in.Content.GetTitle())
+		assert.Equal(t, tag.Content.GetAppData(), in.Content.GetAppData())
+		assert.ElementsMatch(t, tag.Content.References(), in.Content.References())
+	}
+}
+
+func TestExportImportMarkdownIsLossless(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosn-markdown")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	linked := createNote("linked", "linked", "")
+	note := createNote("note", "text", "")
+	nc := note.Content.(*NoteContent)
+	nc.SetTrashed(true)
+	nc.SetLocked(true)
+	nc.SetPrefersPlainEditor(true)
+	nc.ItemReferences = ItemReferences{{UUID: linked.UUID, ContentType: "Note"}}
+	nc.AppData.OrgStandardNotesSN.Other = map[string]json.RawMessage{"editorWidth": json.RawMessage(`80`)}
+	nc.AppData.Other = map[string]json.RawMessage{"org.example.app": json.RawMessage(`{"spellcheck":false}`)}
+	nc.Other = map[string]json.RawMessage{"preview_plain": json.RawMessage(`"text"`)}
+
+	// tags with the same title remain distinct
+	first := createTag("dup", "")
+	second := createTag("dup", "")
+	second.Content.(*TagContent).Other = map[string]json.RawMessage{"expanded": json.RawMessage(`true`)}
+	tagged := UpdateItemRefs(UpdateItemRefsInput{Items: Items{*first, *second}, ToRef: Items{*note}}).Items
+
+	items := append(Items{*note, *linked}, tagged...)
+
+	assert.NoError(t, ExportMarkdown(dir, items))
+
+	imported, err := ImportMarkdown(dir)
+	assert.NoError(t, err)
+	assert.Len(t, imported, 4)
+
+	byUUID := make(map[string]Item)
+	for _, item := range imported {
+		byUUID[item.UUID] = item
+	}
+
+	in := byUUID[note.UUID].Content.(*NoteContent)
+	assert.True(t, in.IsTrashed())
+	assert.True(t, in.IsLocked())
+	assert.Equal(t, nc.AppData, in.AppData)
+	assert.Equal(t, nc.Other, in.Other)
+	assert.Equal(t, nc.ItemReferences, in.ItemReferences)
+
+	for _, tag := range tagged {
+		in := byUUID[tag.UUID]
+		assert.Equal(t, "dup", in.Content.GetTitle())
+		assert.Equal(t, tag.Content.(*TagContent).Other, in.Content.(*TagContent).Other)
+		assert.Equal(t, ItemReferences{{UUID: note.UUID, ContentType: "Note"}}, in.Content.References())
+	}
+}
+
+func TestImportMarkdownWithoutFrontMatter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosn-markdown")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "ideas"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ideas", "new idea.md"), []byte("some text\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("ignored"), 0600))
+
+	imported, err := ImportMarkdown(dir)
+	assert.NoError(t, err)
+	assert.Len(t, imported, 2)
+
+	note, tag := imported[0], imported[1]
+	assert.Equal(t, "new idea", note.Content.GetTitle())
+	assert.Equal(t, "some text\n", note.Content.GetText())
+	assert.Equal(t, "ideas", tag.Content.GetTitle())
+	assert.Equal(t, ItemReferences{{UUID: note.UUID, ContentType: "Note"}}, tag.Content.References())
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.md"), []byte("---\nuuid: abc\n"), 0600))
+	_, err = ImportMarkdown(dir)
+	assert.Error(t, err)
+}
+
+func TestMarkdownFileName(t *testing.T) {
+	assert.Equal(t, "a-b-c", markdownFileName("a/b:c", "x"))
+	assert.Equal(t, "x", markdownFileName(" .. ", "x"))
+	assert.Len(t, []rune(markdownFileName(string(make([]rune, 200)), "x")), markdownMaxFileNameLength)
+}
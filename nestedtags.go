@@ -0,0 +1,284 @@
+package gosn
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// tagToParentTagReferenceType is the type of reference a tag holds to its parent
+	tagToParentTagReferenceType = "TagToParentTag"
+	// tagPathSeparator separates the titles of the tags in a tag's path
+	tagPathSeparator = "."
+)
+
+// ParentUUID returns the UUID of the tag's parent, or an empty string if it has none
+func (tagContent *TagContent) ParentUUID() string {
+	for _, ref := range tagContent.ItemReferences {
+		if ref.ReferenceType == tagToParentTagReferenceType {
+			return ref.UUID
+		}
+	}
+
+	return ""
+}
+
+// SetParentUUID replaces the tag's parent with the tag specified, or removes it if the UUID is empty
+func (tagContent *TagContent) SetParentUUID(parentUUID string) {
+	refs := ItemReferences{}
+
+	for _, ref := range tagContent.ItemReferences {
+		if ref.ReferenceType != tagToParentTagReferenceType {
+			refs = append(refs, ref)
+		}
+	}
+
+	if parentUUID != "" {
+		refs = append(refs, ItemReference{
+			UUID:          parentUUID,
+			ContentType:   "Tag",
+			ReferenceType: tagToParentTagReferenceType,
+		})
+	}
+
+	tagContent.ItemReferences = refs
+}
+
+// tagTree holds the tags of an account, with the path of each
+type tagTree struct {
+	tags  map[string]Item
+	paths map[string]string
+}
+
+// newTagTree returns the tree of the tags held in items, ignoring any other items
+func newTagTree(items Items) tagTree {
+	tt := tagTree{
+		tags:  make(map[string]Item),
+		paths: make(map[string]string),
+	}
+
+	for _, item := range items {
+		if item.ContentType == "Tag" && !item.Deleted && item.Content != nil {
+			tt.tags[item.UUID] = item
+		}
+	}
+
+	for uuid := range tt.tags {
+		tt.path(uuid, make(map[string]bool))
+	}
+
+	return tt
+}
+
+// path returns the titles of the tag and its ancestors, from the root, joined by the separator
+// A tag without a parent has a path of its title, so titles following the dotted convention are paths
+func (tt tagTree) path(uuid string, visited map[string]bool) string {
+	if p, ok := tt.paths[uuid]; ok {
+		return p
+	}
+
+	tag := tt.tags[uuid]
+	title := tag.Content.GetTitle()
+
+	var parentUUID string
+
+	if tc, ok := tag.Content.(*TagContent); ok {
+		parentUUID = tc.ParentUUID()
+	}
+
+	// a missing parent, or one creating a cycle, is ignored
+	if _, ok := tt.tags[parentUUID]; !ok || visited[uuid] {
+		tt.paths[uuid] = title
+
+		return title
+	}
+
+	visited[uuid] = true
+
+	p := tt.path(parentUUID, visited) + tagPathSeparator + title
+	tt.paths[uuid] = p
+
+	return p
+}
+
+// isDescendant returns true if the tag's path is below the ancestor's
+func (tt tagTree) isDescendant(uuid, ancestorUUID string) bool {
+	return uuid != ancestorUUID && strings.HasPrefix(tt.paths[uuid], tt.paths[ancestorUUID]+tagPathSeparator)
+}
+
+// descendants returns the tags below the ancestor, whether by parent reference or dotted title
+func (tt tagTree) descendants(ancestorUUID string) (tags Items) {
+	for uuid, tag := range tt.tags {
+		if tt.isDescendant(uuid, ancestorUUID) {
+			tags = append(tags, tag)
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tt.paths[tags[i].UUID] < tt.paths[tags[j].UUID]
+	})
+
+	return
+}
+
+// find returns the tag with the path
+func (tt tagTree) find(path string) (Item, bool) {
+	for uuid, p := range tt.paths {
+		if p == path {
+			return tt.tags[uuid], true
+		}
+	}
+
+	return Item{}, false
+}
+
+// TagPath returns the path of the tag, such as work.projects.alpha, made up of its title and those of
+// its ancestors, where tags are related by parent references or by the dotted title convention
+func TagPath(tag Item, tags Items) string {
+	tt := newTagTree(append(Items{tag}, tags...))
+
+	return tt.paths[tag.UUID]
+}
+
+// TagDescendants returns the tags below the tag, whether related by parent references or dotted titles
+func TagDescendants(tag Item, tags Items) Items {
+	tt := newTagTree(append(Items{tag}, tags...))
+
+	return tt.descendants(tag.UUID)
+}
+
+// CreateTagPath returns the tags to create so that a tag exists with each path from the root to the
+// one specified, with each created tag referencing its parent, along with the tag at the path
+func CreateTagPath(path string, tags Items) (created Items, leaf Item, err error) {
+	titles := strings.Split(path, tagPathSeparator)
+
+	for _, title := range titles {
+		if title == "" {
+			return nil, leaf, fmt.Errorf("invalid tag path \"%s\"", path)
+		}
+	}
+
+	tt := newTagTree(tags)
+
+	var parentUUID string
+
+	for x, title := range titles {
+		existing, ok := tt.find(strings.Join(titles[:x+1], tagPathSeparator))
+		if ok {
+			leaf = existing
+			parentUUID = existing.UUID
+
+			continue
+		}
+
+		tag := NewTag()
+		tc := NewTagContent()
+		tc.Title = title
+		tc.SetParentUUID(parentUUID)
+		tag.Content = tc
+
+		created = append(created, *tag)
+		leaf = *tag
+		parentUUID = tag.UUID
+	}
+
+	return created, leaf, err
+}
+
+// MoveTag returns the tags to update to move the tag, and the tags below it, to beneath the new parent,
+// or to the root if nil
+// The tag references its new parent, keeping its title if it already referenced a parent, or the last
+// part of it if it followed the dotted convention, and the titles of tags below it following the dotted
+// convention are updated to the new path
+func MoveTag(tag Item, newParent *Item, tags Items) (updated Items, err error) {
+	tt := newTagTree(append(Items{tag}, tags...))
+
+	tc, ok := tag.Content.(*TagContent)
+	if !ok {
+		return nil, fmt.Errorf("item %s is not a tag", tag.UUID)
+	}
+
+	oldPath := tt.paths[tag.UUID]
+
+	title := tc.Title
+	if tc.ParentUUID() == "" {
+		title = oldPath[strings.LastIndex(oldPath, tagPathSeparator)+1:]
+	}
+
+	newPath := title
+
+	var parentUUID string
+
+	if newParent != nil {
+		if newParent.UUID == tag.UUID || tt.isDescendant(newParent.UUID, tag.UUID) {
+			return nil, errors.New("a tag cannot be moved below itself")
+		}
+
+		if _, ok = tt.tags[newParent.UUID]; !ok {
+			return nil, fmt.Errorf("parent %s is not a tag", newParent.UUID)
+		}
+
+		parentUUID = newParent.UUID
+		newPath = tt.paths[parentUUID] + tagPathSeparator + title
+	}
+
+	c := *tc
+	c.Title = title
+	c.SetParentUUID(parentUUID)
+	c.SetUpdateTime(time.Now().UTC())
+	tag.Content = &c
+
+	updated = append(Items{tag}, retitleDescendants(tt, tag.UUID, oldPath, newPath)...)
+
+	return updated, err
+}
+
+// RenameTag returns the tags to update to rename the tag, replacing the last part of its title, and
+// the titles of tags below it following the dotted convention
+func RenameTag(tag Item, title string, tags Items) (updated Items, err error) {
+	if title == "" || strings.Contains(title, tagPathSeparator) {
+		return nil, fmt.Errorf("invalid tag title \"%s\": must not be empty or contain \"%s\"", title, tagPathSeparator)
+	}
+
+	tt := newTagTree(append(Items{tag}, tags...))
+
+	tc, ok := tag.Content.(*TagContent)
+	if !ok {
+		return nil, fmt.Errorf("item %s is not a tag", tag.UUID)
+	}
+
+	oldPath := tt.paths[tag.UUID]
+	newPath := oldPath[:strings.LastIndex(oldPath, tagPathSeparator)+1] + title
+
+	c := *tc
+	c.Title = tc.Title[:strings.LastIndex(tc.Title, tagPathSeparator)+1] + title
+	c.SetUpdateTime(time.Now().UTC())
+	tag.Content = &c
+
+	updated = append(Items{tag}, retitleDescendants(tt, tag.UUID, oldPath, newPath)...)
+
+	return updated, err
+}
+
+// retitleDescendants returns the tags below the ancestor whose titles start with the ancestor's path,
+// following the dotted convention, with that part of their title replaced with the new path
+func retitleDescendants(tt tagTree, ancestorUUID, oldPath, newPath string) (updated Items) {
+	for _, d := range tt.descendants(ancestorUUID) {
+		tc, ok := d.Content.(*TagContent)
+		if !ok || !strings.HasPrefix(tc.Title, oldPath+tagPathSeparator) {
+			continue
+		}
+
+		c := *tc
+		c.Title = newPath + strings.TrimPrefix(tc.Title, oldPath)
+		c.SetUpdateTime(time.Now().UTC())
+		d.Content = &c
+
+		updated = append(updated, d)
+	}
+
+	return
+}
@@ -0,0 +1,172 @@
+package gosn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tagTitles(tags Items) (titles []string) {
+	for _, tag := range tags {
+		titles = append(titles, tag.Content.GetTitle())
+	}
+
+	return
+}
+
+func TestCreateTagPath(t *testing.T) {
+	work := createTag("work", "")
+
+	created, leaf, err := CreateTagPath("work.projects.alpha", Items{*work})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"projects", "alpha"}, tagTitles(created))
+	assert.Equal(t, created[1].UUID, leaf.UUID)
+	assert.Equal(t, work.UUID, created[0].Content.(*TagContent).ParentUUID())
+	assert.Equal(t, created[0].UUID, created[1].Content.(*TagContent).ParentUUID())
+
+	tags := append(Items{*work}, created...)
+	assert.Equal(t, "work.projects.alpha", TagPath(leaf, tags))
+	assert.Equal(t, []string{"projects", "alpha"}, tagTitles(TagDescendants(*work, tags)))
+
+	// existing paths are reused
+	none, existing, err := CreateTagPath("work.projects", tags)
+	assert.NoError(t, err)
+	assert.Empty(t, none)
+	assert.Equal(t, created[0].UUID, existing.UUID)
+
+	_, _, err = CreateTagPath("work..alpha", tags)
+	assert.Error(t, err)
+}
+
+func TestTagPathWithDottedTitles(t *testing.T) {
+	work := createTag("work", "")
+	dotted := createTag("work.projects", "")
+	child := createTag("beta", "")
+	child.Content.(*TagContent).SetParentUUID(dotted.UUID)
+
+	tags := Items{*work, *dotted, *child}
+
+	assert.Equal(t, "work.projects", TagPath(*dotted, tags))
+	assert.Equal(t, "work.projects.beta", TagPath(*child, tags))
+	assert.Equal(t, []string{"work.projects", "beta"}, tagTitles(TagDescendants(*work, tags)))
+
+	// a missing parent is ignored
+	orphan := createTag("orphan", "")
+	orphan.Content.(*TagContent).SetParentUUID("missing")
+	assert.Equal(t, "orphan", TagPath(*orphan, tags))
+}
+
+func TestSetParentUUID(t *testing.T) {
+	tag := createTag("tag", "")
+	note := createNote("note", "", "")
+	tc := tag.Content.(*TagContent)
+	tc.UpsertReferences(ItemReferences{{UUID: note.UUID, ContentType: "Note"}})
+
+	tc.SetParentUUID("first")
+	tc.SetParentUUID("second")
+	assert.Equal(t, "second", tc.ParentUUID())
+	assert.Len(t, tc.References(), 2)
+
+	tc.SetParentUUID("")
+	assert.Empty(t, tc.ParentUUID())
+	assert.Equal(t, ItemReferences{{UUID: note.UUID, ContentType: "Note"}}, tc.References())
+}
+
+func TestMoveTag(t *testing.T) {
+	work := createTag("work", "")
+	personal := createTag("personal", "")
+	projects := createTag("work.projects", "")
+	alpha := createTag("work.projects.alpha", "")
+	beta := createTag("beta", "")
+	beta.Content.(*TagContent).SetParentUUID(projects.UUID)
+
+	tags := Items{*work, *personal, *projects, *alpha, *beta}
+
+	updated, err := MoveTag(*projects, personal, tags)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"projects", "personal.projects.alpha"}, tagTitles(updated))
+	assert.Equal(t, personal.UUID, updated[0].Content.(*TagContent).ParentUUID())
+	// the original is unchanged
+	assert.Equal(t, "work.projects", projects.Content.GetTitle())
+
+	moved := Items{*work, *personal, updated[0], updated[1], *beta}
+	assert.Equal(t, "personal.projects.beta", TagPath(*beta, moved))
+	assert.Equal(t, "personal.projects.alpha", TagPath(updated[1], moved))
+
+	updated, err = MoveTag(updated[0], nil, moved)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"projects", "projects.alpha"}, tagTitles(updated))
+	assert.Empty(t, updated[0].Content.(*TagContent).ParentUUID())
+
+	// a tag referencing its parent keeps its title, even if it contains the separator
+	dotted := createTag("a.b", "")
+	dotted.Content.(*TagContent).SetParentUUID(work.UUID)
+
+	updated, err = MoveTag(*dotted, personal, append(tags, *dotted))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.b"}, tagTitles(updated))
+	assert.Equal(t, personal.UUID, updated[0].Content.(*TagContent).ParentUUID())
+
+	_, err = MoveTag(*work, projects, tags)
+	assert.Error(t, err)
+
+	_, err = MoveTag(*work, work, tags)
+	assert.Error(t, err)
+}
+
+func TestRenameTag(t *testing.T) {
+	work := createTag("work", "")
+	projects := createTag("work.projects", "")
+	alpha := createTag("alpha", "")
+	alpha.Content.(*TagContent).SetParentUUID(projects.UUID)
+
+	tags := Items{*work, *projects, *alpha}
+
+	updated, err := RenameTag(*work, "job", tags)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"job", "job.projects"}, tagTitles(updated))
+
+	updated, err = RenameTag(*projects, "plans", tags)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"work.plans"}, tagTitles(updated))
+	assert.Equal(t, "work.plans.alpha", TagPath(*alpha, Items{*work, updated[0], *alpha}))
+
+	_, err = RenameTag(*work, "a.b", tags)
+	assert.Error(t, err)
+}
+
+func TestFilterNotesByTagTree(t *testing.T) {
+	inWork := createNote("in work", "", "")
+	inAlpha := createNote("in alpha", "", "")
+	inBeta := createNote("in beta", "", "")
+	elsewhere := createNote("elsewhere", "", "")
+
+	work := createTag("work", "")
+	work = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*work}, ToRef: Items{*inWork}}).Items[0]
+	alpha := createTag("work.projects.alpha", "")
+	alpha = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*alpha}, ToRef: Items{*inAlpha}}).Items[0]
+	beta := createTag("beta", "")
+	beta = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*beta}, ToRef: Items{*inBeta}}).Items[0]
+	beta.Content.(*TagContent).SetParentUUID(work.UUID)
+	other := createTag("other", "")
+	other = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*other}, ToRef: Items{*elsewhere}}).Items[0]
+
+	all := Items{*inWork, *inAlpha, *inBeta, *elsewhere, *work, *alpha, *beta, *other}
+
+	items := append(Items{}, all...)
+	items.Filter(ItemFilters{Filters: []Filter{{Type: "Note", Key: "TagTitle", Comparison: "==", Value: "work", IncludeSubTags: true}}})
+	assert.ElementsMatch(t, []string{"in work", "in alpha", "in beta"}, tagTitles(items))
+
+	items = append(Items{}, all...)
+	items.Filter(ItemFilters{Filters: []Filter{{Type: "Note", Key: "TagTitle", Comparison: "==", Value: "work.projects", IncludeSubTags: true}}})
+	assert.Equal(t, []string{"in alpha"}, tagTitles(items))
+
+	items = append(Items{}, all...)
+	items.Filter(ItemFilters{Filters: []Filter{{Type: "Note", Key: "TagTitle", Comparison: "~", Value: "^work.beta$", IncludeSubTags: true}}})
+	assert.Equal(t, []string{"in beta"}, tagTitles(items))
+
+	// without the option only notes tagged with the tag itself match
+	items = append(Items{}, all...)
+	items.Filter(ItemFilters{Filters: []Filter{{Type: "Note", Key: "TagTitle", Comparison: "==", Value: "work"}}})
+	assert.Equal(t, []string{"in work"}, tagTitles(items))
+}
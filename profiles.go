@@ -0,0 +1,232 @@
+package gosn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// DefaultProfile is the profile used when none has been added or selected
+// Its session is stored under the name used before profiles were introduced
+const DefaultProfile = "default"
+
+// profileIndexName is the name under which the profile index is stored
+const profileIndexName = "profiles"
+
+var profileNameRegex = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// profileIndex records the profiles held in a SessionStore and which one is active
+type profileIndex struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+func (idx profileIndex) contains(profile string) bool {
+	for _, p := range idx.Profiles {
+		if p == profile {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (idx *profileIndex) remove(profile string) {
+	var profiles []string
+
+	for _, p := range idx.Profiles {
+		if p != profile {
+			profiles = append(profiles, p)
+		}
+	}
+
+	idx.Profiles = profiles
+
+	if idx.Active == profile {
+		idx.Active = ""
+
+		if idx.contains(DefaultProfile) {
+			idx.Active = DefaultProfile
+		} else if len(idx.Profiles) > 0 {
+			idx.Active = idx.Profiles[0]
+		}
+	}
+}
+
+// profileSessionName returns the name under which a profile's session is stored
+func profileSessionName(profile string) string {
+	if profile == DefaultProfile {
+		return defaultSessionName
+	}
+
+	return fmt.Sprintf("%s_%s", defaultSessionName, profile)
+}
+
+func validateProfileName(profile string) error {
+	if !profileNameRegex.MatchString(profile) {
+		return fmt.Errorf("invalid profile name \"%s\": only letters, numbers, '-' and '_' are permitted", profile)
+	}
+
+	return nil
+}
+
+// loadProfileIndex returns the store's profile index
+// Stores without an index hold, at most, the session of the default profile
+func loadProfileIndex(store SessionStore) (idx profileIndex, err error) {
+	var raw string
+
+	raw, err = sessionStore(store).Get(profileIndexName)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return
+	}
+
+	if raw != "" {
+		if err = json.Unmarshal([]byte(raw), &idx); err != nil {
+			err = fmt.Errorf("failed to read profile index: %w", err)
+		}
+
+		return
+	}
+
+	var s string
+
+	s, err = sessionStore(store).Get(defaultSessionName)
+	if errors.Is(err, ErrSessionNotFound) {
+		return idx, nil
+	}
+
+	if err == nil && s != "" {
+		idx.Active = DefaultProfile
+		idx.Profiles = []string{DefaultProfile}
+	}
+
+	return idx, err
+}
+
+func saveProfileIndex(store SessionStore, idx profileIndex) error {
+	if len(idx.Profiles) == 0 {
+		err := sessionStore(store).Delete(profileIndexName)
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	return sessionStore(store).Set(profileIndexName, string(b))
+}
+
+// resolveProfile returns the profile, or the active profile if empty
+func resolveProfile(store SessionStore, profile string) (string, error) {
+	if profile != "" {
+		return profile, validateProfileName(profile)
+	}
+
+	return ActiveProfile(store)
+}
+
+// ActiveProfile returns the profile used when one is not specified
+func ActiveProfile(store SessionStore) (profile string, err error) {
+	var idx profileIndex
+
+	idx, err = loadProfileIndex(store)
+	if err != nil {
+		return
+	}
+
+	if idx.Active == "" {
+		return DefaultProfile, nil
+	}
+
+	return idx.Active, nil
+}
+
+// ListProfiles returns the profiles held in the store and the active profile
+func ListProfiles(store SessionStore) (profiles []string, active string, err error) {
+	var idx profileIndex
+
+	idx, err = loadProfileIndex(store)
+	if err != nil {
+		return
+	}
+
+	return idx.Profiles, idx.Active, err
+}
+
+// SelectProfile makes an existing profile the active profile
+func SelectProfile(store SessionStore, profile string) (err error) {
+	var idx profileIndex
+
+	idx, err = loadProfileIndex(store)
+	if err != nil {
+		return
+	}
+
+	if !idx.contains(profile) {
+		return fmt.Errorf("profile \"%s\": %w", profile, ErrSessionNotFound)
+	}
+
+	idx.Active = profile
+
+	return saveProfileIndex(store, idx)
+}
+
+// RemoveProfile removes a profile's session from the store, or the active profile's if profile is empty
+// If the active profile is removed, then the default profile, or the first remaining, becomes active
+func RemoveProfile(store SessionStore, profile string) (err error) {
+	profile, err = resolveProfile(store, profile)
+	if err != nil {
+		return
+	}
+
+	var idx profileIndex
+
+	idx, err = loadProfileIndex(store)
+	if err != nil {
+		return
+	}
+
+	if !idx.contains(profile) {
+		return fmt.Errorf("profile \"%s\": %w", profile, ErrSessionNotFound)
+	}
+
+	err = sessionStore(store).Delete(profileSessionName(profile))
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return
+	}
+
+	idx.remove(profile)
+
+	return saveProfileIndex(store, idx)
+}
+
+// writeProfileSession stores a profile's session and adds the profile to the index
+// The profile becomes active if no other profile is
+func writeProfileSession(store SessionStore, profile, s string) (err error) {
+	var idx profileIndex
+
+	idx, err = loadProfileIndex(store)
+	if err != nil {
+		return
+	}
+
+	if err = sessionStore(store).Set(profileSessionName(profile), s); err != nil {
+		return
+	}
+
+	if !idx.contains(profile) {
+		idx.Profiles = append(idx.Profiles, profile)
+	}
+
+	if idx.Active == "" {
+		idx.Active = profile
+	}
+
+	return saveProfileIndex(store, idx)
+}
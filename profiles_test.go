@@ -0,0 +1,111 @@
+package gosn
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	store := NewMemorySessionStore()
+
+	profiles, active, err := ListProfiles(store)
+	assert.NoError(t, err)
+	assert.Empty(t, profiles)
+	assert.Empty(t, active)
+
+	workSession := fmt.Sprintf("work@example.com;%s;token;ak;mk", testSessionServer)
+
+	assert.NoError(t, writeProfileSession(store, DefaultProfile, testSession))
+	assert.NoError(t, writeProfileSession(store, "work", workSession))
+
+	profiles, active, err = ListProfiles(store)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DefaultProfile, "work"}, profiles)
+	assert.Equal(t, DefaultProfile, active)
+
+	// the default profile is stored under the original name
+	s, err := store.Get(KeyringApplicationName)
+	assert.NoError(t, err)
+	assert.Equal(t, testSession, s)
+
+	assert.True(t, errors.Is(SelectProfile(store, "missing"), ErrSessionNotFound))
+	assert.NoError(t, SelectProfile(store, "work"))
+
+	_, email, err := GetSession(true, "", "", store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "work@example.com", email)
+
+	_, email, err = LoadProfileSession(DefaultProfile, "", store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, testSessionEmail, email)
+
+	msg, err := SessionStatus("", store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "session found: work@example.com\nprofiles:\n  default: me@home.com\n* work: work@example.com", msg)
+
+	// removing the active profile makes the default profile active
+	assert.NoError(t, RemoveProfile(store, ""))
+
+	profiles, active, err = ListProfiles(store)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DefaultProfile}, profiles)
+	assert.Equal(t, DefaultProfile, active)
+
+	assert.True(t, errors.Is(RemoveProfile(store, "work"), ErrSessionNotFound))
+	assert.NoError(t, RemoveProfile(store, DefaultProfile))
+
+	// the index is removed with the last profile
+	_, err = store.Get(profileIndexName)
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+}
+
+func TestProfileNames(t *testing.T) {
+	store := NewMemorySessionStore()
+
+	_, err := GetStoredProfileSession(store, "not valid")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid profile name")
+
+	assert.Equal(t, "session_work", profileSessionName("work"))
+	assert.Equal(t, KeyringApplicationName, profileSessionName(DefaultProfile))
+}
+
+func TestAddProfileSession(t *testing.T) {
+	email, _ := signInNewTestUser(t, "secret")
+
+	store := NewMemorySessionStore()
+
+	_, err := AddProfileSession("test", testServer.URL, "", store, StaticPrompter{
+		PromptEmail:    email,
+		PromptPassword: "secret",
+	})
+	assert.NoError(t, err)
+
+	profiles, active, err := ListProfiles(store)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test"}, profiles)
+	assert.Equal(t, "test", active)
+
+	session, sessionEmail, err := GetSession(true, "", "", store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, email, sessionEmail)
+	assert.True(t, session.Valid())
+
+	// nothing is stored without credentials
+	store = NewMemorySessionStore()
+
+	res, err := AddProfileSession("test", testServer.URL, "", store, StaticPrompter{PromptEmail: email})
+	assert.True(t, errors.Is(err, ErrCredentialsRequired))
+	assert.NotContains(t, res, "success")
+
+	var credErr *CredentialsError
+
+	assert.True(t, errors.As(err, &credErr))
+	assert.Equal(t, "password not defined", credErr.Reason)
+
+	_, err = GetStoredProfileSession(store, "test")
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+}
@@ -0,0 +1,143 @@
+package gosn
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// fields requested from a Prompter
+const (
+	PromptEmail          = "email"
+	PromptPassword       = "password"
+	PromptServer         = "server"
+	PromptSessionKey     = "session_key"
+	PromptMFAToken       = "mfa_token"
+	PromptReplaceSession = "replace_session"
+)
+
+// promptLabels are the labels displayed when prompting on a terminal
+var promptLabels = map[string]string{
+	PromptEmail:          "email",
+	PromptPassword:       "password",
+	PromptServer:         "server",
+	PromptSessionKey:     "session key",
+	PromptMFAToken:       "token",
+	PromptReplaceSession: "replace existing session (y|n)",
+}
+
+// Prompter provides credentials and answers that would otherwise be requested from the user
+// Secret fields, such as passwords and keys, must not be echoed if read interactively
+type Prompter interface {
+	Prompt(field string, secret bool) (value string, err error)
+}
+
+// PromptFunc is a function that implements Prompter
+type PromptFunc func(field string, secret bool) (value string, err error)
+
+// Prompt calls f(field, secret)
+func (f PromptFunc) Prompt(field string, secret bool) (value string, err error) {
+	return f(field, secret)
+}
+
+// DefaultPrompter reads values from the SN_ prefixed environment variables, such as SN_EMAIL, SN_PASSWORD
+// and SN_SERVER, as previously read through viper, and then from the terminal
+var DefaultPrompter = MultiPrompter{EnvPrompter{}, TerminalPrompter{}}
+
+// TerminalPrompter reads values from the terminal attached to stdin
+// The server is not requested, as it defaults to the Standard Notes server
+type TerminalPrompter struct{}
+
+// Prompt displays the field's label and reads the response, hiding it if secret
+func (TerminalPrompter) Prompt(field string, secret bool) (value string, err error) {
+	if field == PromptServer {
+		return "", fmt.Errorf("%w: %s", ErrPromptUnavailable, field)
+	}
+
+	label, ok := promptLabels[field]
+	if !ok {
+		label = field
+	}
+
+	fmt.Printf("%s: ", label)
+
+	if secret {
+		var b []byte
+
+		b, err = terminal.ReadPassword(int(syscall.Stdin))
+
+		fmt.Println()
+
+		return string(b), err
+	}
+
+	_, err = fmt.Scanln(&value)
+
+	return value, err
+}
+
+// EnvPrompter reads values from environment variables named with the prefix and
+// the upper-cased field, e.g. SN_EMAIL, SN_PASSWORD, SN_SERVER and SN_SESSION_KEY
+type EnvPrompter struct {
+	Prefix string // defaults to "SN"
+}
+
+// Prompt returns the value of the field's environment variable
+func (e EnvPrompter) Prompt(field string, secret bool) (value string, err error) {
+	prefix := e.Prefix
+	if prefix == "" {
+		prefix = "SN"
+	}
+
+	name := fmt.Sprintf("%s_%s", prefix, strings.ToUpper(field))
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s not set", ErrPromptUnavailable, name)
+	}
+
+	return value, nil
+}
+
+// StaticPrompter returns values from a map of field to value
+type StaticPrompter map[string]string
+
+// Prompt returns the value for the field
+func (s StaticPrompter) Prompt(field string, secret bool) (value string, err error) {
+	value, ok := s[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrPromptUnavailable, field)
+	}
+
+	return value, nil
+}
+
+// MultiPrompter returns the value from the first Prompter able to provide it
+type MultiPrompter []Prompter
+
+// Prompt tries each Prompter in turn until one does not return ErrPromptUnavailable
+func (m MultiPrompter) Prompt(field string, secret bool) (value string, err error) {
+	err = fmt.Errorf("%w: %s", ErrPromptUnavailable, field)
+
+	for _, p := range m {
+		value, err = prompt(p, field, secret)
+		if !errors.Is(err, ErrPromptUnavailable) {
+			return
+		}
+	}
+
+	return
+}
+
+// prompt requests the field from p, which may be nil if prompting is not permitted
+func prompt(p Prompter, field string, secret bool) (value string, err error) {
+	if p == nil {
+		return "", fmt.Errorf("%w: %s", ErrPromptUnavailable, field)
+	}
+
+	return p.Prompt(field, secret)
+}
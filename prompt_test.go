@@ -0,0 +1,103 @@
+package gosn
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvPrompter(t *testing.T) {
+	assert.NoError(t, os.Setenv("GOSN_TEST_SESSION_KEY", "secret"))
+
+	defer os.Unsetenv("GOSN_TEST_SESSION_KEY")
+
+	p := EnvPrompter{Prefix: "GOSN_TEST"}
+
+	v, err := p.Prompt(PromptSessionKey, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", v)
+
+	_, err = p.Prompt(PromptMFAToken, false)
+	assert.True(t, errors.Is(err, ErrPromptUnavailable))
+	assert.Contains(t, err.Error(), "GOSN_TEST_MFA_TOKEN")
+}
+
+func TestMultiPrompter(t *testing.T) {
+	var requested []string
+
+	p := MultiPrompter{
+		StaticPrompter{PromptEmail: "me@example.com"},
+		PromptFunc(func(field string, secret bool) (string, error) {
+			requested = append(requested, field)
+			return "from func", nil
+		}),
+	}
+
+	v, err := p.Prompt(PromptEmail, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "me@example.com", v)
+
+	v, err = p.Prompt(PromptPassword, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "from func", v)
+	assert.Equal(t, []string{PromptPassword}, requested)
+
+	_, err = MultiPrompter{}.Prompt(PromptPassword, true)
+	assert.True(t, errors.Is(err, ErrPromptUnavailable))
+}
+
+func TestGetCredentialsWithoutPrompter(t *testing.T) {
+	_, _, _, errMsg := GetCredentials("", nil)
+	assert.Equal(t, "email required", errMsg)
+
+	_, _, _, errMsg = GetCredentials("", StaticPrompter{PromptEmail: "me@example.com"})
+	assert.Equal(t, "password not defined", errMsg)
+
+	email, password, server, errMsg := GetCredentials("", StaticPrompter{
+		PromptEmail:    "me@example.com",
+		PromptPassword: "secret",
+	})
+	assert.Empty(t, errMsg)
+	assert.Equal(t, "me@example.com", email)
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, SNServerURL, server)
+}
+
+func TestGetCredentialsWithDefaultPrompter(t *testing.T) {
+	for name, value := range map[string]string{
+		"SN_EMAIL":    "me@example.com",
+		"SN_PASSWORD": "secret",
+		"SN_SERVER":   "https://notes.example.com",
+	} {
+		assert.NoError(t, os.Setenv(name, value))
+		defer os.Unsetenv(name)
+	}
+
+	email, password, server, errMsg := GetCredentials("", DefaultPrompter)
+	assert.Empty(t, errMsg)
+	assert.Equal(t, "me@example.com", email)
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, "https://notes.example.com", server)
+
+	// the server specified takes precedence
+	_, _, server, _ = GetCredentials("https://other.example.com", DefaultPrompter)
+	assert.Equal(t, "https://other.example.com", server)
+
+	// the server is not requested from the terminal
+	_, err := TerminalPrompter{}.Prompt(PromptServer, false)
+	assert.True(t, errors.Is(err, ErrPromptUnavailable))
+}
+
+func TestCliSignInWithMFAPrompt(t *testing.T) {
+	email, _ := signInNewTestUser(t, "secret")
+	assert.NoError(t, testServer.EnableMFA(email, "mfa_cli", "654321"))
+
+	_, err := CliSignIn(email, "secret", testServer.URL, nil)
+	assert.True(t, errors.Is(err, ErrPromptUnavailable))
+
+	session, err := CliSignIn(email, "secret", testServer.URL, StaticPrompter{PromptMFAToken: "654321"})
+	assert.NoError(t, err)
+	assert.True(t, session.Valid())
+}
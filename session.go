@@ -5,17 +5,16 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"regexp"
 	"strings"
-	"syscall"
+	"time"
 
-	keyring "github.com/zalando/go-keyring"
-	"golang.org/x/crypto/ssh/terminal"
-
-	"github.com/spf13/viper"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 const (
@@ -26,111 +25,132 @@ const (
 	MsgSessionRemovalFailure = "failed to remove session"
 )
 
-func GetCredentials(inServer string) (email, password, apiServer, errMsg string) {
-	switch {
-	case viper.GetString("email") != "":
-		email = viper.GetString("email")
-	default:
-		fmt.Print("email: ")
-
-		_, err := fmt.Scanln(&email)
-		if err != nil || len(strings.TrimSpace(email)) == 0 {
-			errMsg = "email required"
-			return
-		}
+// GetCredentials requests the email and password from the prompter and returns them with the server,
+// which is requested from the prompter if not specified and defaults to the Standard Notes server
+// Use DefaultPrompter to read the environment variables and then the terminal
+func GetCredentials(inServer string, p Prompter) (email, password, apiServer, errMsg string) {
+	var err error
+
+	email, err = prompt(p, PromptEmail, false)
+	if err != nil || len(strings.TrimSpace(email)) == 0 {
+		errMsg = "email required"
+		return
 	}
 
-	if viper.GetString("password") != "" {
-		password = viper.GetString("password")
-	} else {
-		fmt.Print("password: ")
-		bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
-		fmt.Println()
-		if err == nil {
-			password = string(bytePassword)
-		} else {
+	password, err = prompt(p, PromptPassword, true)
+	if err != nil && !errors.Is(err, ErrPromptUnavailable) {
+		errMsg = err.Error()
+		return
+	}
+
+	if strings.TrimSpace(password) == "" {
+		errMsg = "password not defined"
+		return
+	}
+
+	apiServer = inServer
+	if apiServer == "" {
+		apiServer, err = prompt(p, PromptServer, false)
+		if err != nil && !errors.Is(err, ErrPromptUnavailable) {
 			errMsg = err.Error()
 			return
 		}
-		if strings.TrimSpace(password) == "" {
-			errMsg = "password not defined"
-		}
 	}
 
-	switch {
-	case inServer != "":
-		apiServer = inServer
-	case viper.GetString("server") != "":
-		apiServer = viper.GetString("server")
-	default:
+	if strings.TrimSpace(apiServer) == "" {
 		apiServer = SNServerURL
 	}
 
 	return email, password, apiServer, errMsg
 }
 
-// encrypt string to base64 crypto using AES
+// Encrypt encrypts text with XChaCha20-Poly1305 using a key derived from the
+// provided key with Argon2id and a random salt
+// The result is versioned and formatted as: v2:<salt>:<nonce>:<ciphertext>
 func Encrypt(key []byte, text string) string {
-	key = padToAESBlockSize(key)
-	plaintext := []byte(text)
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
+	salt := make([]byte, sessionKDFSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
 		panic(err)
 	}
 
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
 
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	aead, err := chacha20poly1305.NewX(deriveSessionKey(key, salt))
+	if err != nil {
 		panic(err)
 	}
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	// authenticate the version and salt along with the ciphertext
+	ad := sessionFormatVersion + ":" + base64.RawURLEncoding.EncodeToString(salt)
+	ciphertext := aead.Seal(nil, nonce, []byte(text), []byte(ad))
+
+	return fmt.Sprintf("%s:%s:%s", ad, base64.RawURLEncoding.EncodeToString(nonce),
+		base64.RawURLEncoding.EncodeToString(ciphertext))
+}
+
+func deriveSessionKey(key, salt []byte) []byte {
+	return argon2.IDKey(key, salt, sessionKDFIterations, sessionKDFMemory, sessionKDFParallelism,
+		chacha20poly1305.KeySize)
+}
+
+// isLegacyEncryptedSession returns true if the session was encrypted with AES-CFB
+// prior to the introduction of the versioned format
+func isLegacyEncryptedSession(cryptoText string) bool {
+	return !strings.HasPrefix(cryptoText, sessionFormatVersion+":")
+}
 
-	// convert to base64
-	return base64.URLEncoding.EncodeToString(ciphertext)
+// GetStoredSession returns the active profile's raw session held in the store,
+// which defaults to the system keyring if nil
+func GetStoredSession(store SessionStore) (s string, err error) {
+	return GetStoredProfileSession(store, "")
 }
 
-func GetSessionFromKeyring(k keyring.Keyring) (s string, err error) {
-	if k == nil {
-		return keyring.Get(KeyringService, KeyringApplicationName)
+// GetStoredProfileSession returns a profile's raw session held in the store, or the active profile's if empty
+func GetStoredProfileSession(store SessionStore, profile string) (s string, err error) {
+	profile, err = resolveProfile(store, profile)
+	if err != nil {
+		return
 	}
 
-	return k.Get(KeyringService, KeyringApplicationName)
+	return sessionStore(store).Get(profileSessionName(profile))
 }
 
-func AddSession(snServer, inKey string, k keyring.Keyring) (res string, err error) {
-	// check if session exists in keyring
+// AddSession signs in using credentials from the prompter and saves the session to the
+// active profile in the store
+// If inKey is "." then the key used to encrypt the session is requested from the prompter
+func AddSession(snServer, inKey string, store SessionStore, p Prompter) (res string, err error) {
+	return AddProfileSession("", snServer, inKey, store, p)
+}
+
+// AddProfileSession signs in using credentials from the prompter and saves the session to
+// the profile in the store, or the active profile if empty
+// If inKey is "." then the key used to encrypt the session is requested from the prompter
+func AddProfileSession(profile, snServer, inKey string, store SessionStore, p Prompter) (res string, err error) {
+	profile, err = resolveProfile(store, profile)
+	if err != nil {
+		return
+	}
+
+	// check if session exists in store
 	var s string
-	s, err = GetSessionFromKeyring(k)
-	// only return an error if there's an issue accessing the keyring
-	if err != nil && !strings.Contains(err.Error(), "secret not found in keyring") {
+	s, err = sessionStore(store).Get(profileSessionName(profile))
+	// only return an error if there's an issue accessing the store
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
 		return
 	}
 
 	if inKey == "." {
-		var byteKey []byte
-
-		fmt.Print("session key: ")
-
-		byteKey, err = terminal.ReadPassword(int(syscall.Stdin))
+		inKey, err = prompt(p, PromptSessionKey, true)
 		if err != nil {
 			return
 		}
-
-		inKey = string(byteKey)
-
-		fmt.Println()
 	}
 
 	if s != "" {
-		fmt.Print("replace existing session (y|n): ")
-
-		var resp string
-
-		_, err := fmt.Scanln(&resp)
+		resp, err := prompt(p, PromptReplaceSession, false)
 		if err != nil || strings.ToLower(resp) != "y" {
 			// do nothing
 			return "", nil
@@ -141,7 +161,7 @@ func AddSession(snServer, inKey string, k keyring.Keyring) (res string, err erro
 
 	var email string
 
-	session, email, err = GetSessionFromUser(snServer)
+	session, email, err = GetSessionFromUser(snServer, p)
 	if err != nil {
 		return fmt.Sprint("failed to get session: ", err), err
 	}
@@ -153,7 +173,7 @@ func AddSession(snServer, inKey string, k keyring.Keyring) (res string, err erro
 		rS = Encrypt(key, MakeSessionString(email, session))
 	}
 
-	err = writeSession(rS, k)
+	err = writeProfileSession(store, profile, rS)
 	if err != nil {
 		return fmt.Sprint("failed to set session: ", err), err
 	}
@@ -161,20 +181,79 @@ func AddSession(snServer, inKey string, k keyring.Keyring) (res string, err erro
 	return "session added successfully", err
 }
 
-func writeSession(s string, k keyring.Keyring) error {
-	if k == nil {
-		return keyring.Set(KeyringService, KeyringApplicationName, s)
-	}
+// sessionDocument is the serialised form of a session
+type sessionDocument struct {
+	DocumentVersion int       `json:"document_version"`
+	Email           string    `json:"email"`
+	UserUUID        string    `json:"user_uuid,omitempty"`
+	Server          string    `json:"server"`
+	Token           string    `json:"token"`
+	ProtocolVersion string    `json:"protocol_version"`
+	Mk              string    `json:"mk"`
+	Ak              string    `json:"ak,omitempty"`
+	KeyParams       KeyParams `json:"key_params"`
+	CreatedAt       time.Time `json:"created_at"`
+	// items keys, so items can be encrypted with them without first retrieving them
+	ItemsKeys []sessionItemsKey `json:"items_keys,omitempty"`
+}
 
-	return k.Set(KeyringService, KeyringApplicationName, s)
+// sessionItemsKey is the serialised form of a decrypted items key
+type sessionItemsKey struct {
+	UUID      string `json:"uuid"`
+	ItemsKey  string `json:"items_key"`
+	AuthKey   string `json:"auth_key,omitempty"`
+	Version   string `json:"version"`
+	Default   bool   `json:"default,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
 }
 
 func makeSessionString(email string, session Session) string {
-	return fmt.Sprintf("%s;%s;%s;%s;%s", email, session.Server, session.Token, session.Ak, session.Mk)
+	doc := sessionDocument{
+		DocumentVersion: sessionDocumentVersion,
+		Email:           email,
+		UserUUID:        session.UserUUID,
+		Server:          session.Server,
+		Token:           session.Token,
+		ProtocolVersion: session.Version,
+		Mk:              session.Mk,
+		Ak:              session.Ak,
+		KeyParams:       session.KeyParams,
+		CreatedAt:       session.CreatedAt,
+	}
+
+	for _, ik := range session.ItemsKeys {
+		doc.ItemsKeys = append(doc.ItemsKeys, sessionItemsKey(ik))
+	}
+
+	b, _ := json.Marshal(doc)
+
+	return string(b)
+}
+
+// parseSessionDocument returns the session document serialised as JSON
+func parseSessionDocument(in string) (doc sessionDocument, err error) {
+	if err = json.Unmarshal([]byte(in), &doc); err != nil {
+		return
+	}
+
+	switch {
+	case doc.DocumentVersion == 0:
+		err = errors.New("session document version is missing")
+	case doc.DocumentVersion > sessionDocumentVersion:
+		err = fmt.Errorf("unsupported session document version: %d", doc.DocumentVersion)
+	}
+
+	return
+}
+
+// isSessionDocument returns true if the session is serialised as JSON rather than the legacy string
+func isSessionDocument(in string) bool {
+	return strings.HasPrefix(strings.TrimSpace(in), "{")
 }
 
-func SessionExists(k keyring.Keyring) error {
-	s, err := GetSessionFromKeyring(k)
+func SessionExists(store SessionStore) error {
+	s, err := GetStoredSession(store)
 	if err != nil {
 		return err
 	}
@@ -186,49 +265,40 @@ func SessionExists(k keyring.Keyring) error {
 	return nil
 }
 
-// RemoveSession removes the SN session from the keyring
-func RemoveSession(k keyring.Keyring) string {
+// RemoveSession removes the active profile's SN session from the store
+func RemoveSession(store SessionStore) string {
 	var err error
-	if err = SessionExists(k); err != nil {
+	if err = SessionExists(store); err != nil {
 		return fmt.Sprintf("%s: %s", MsgSessionRemovalFailure, err.Error())
 	}
 
-	if k == nil {
-		err = keyring.Delete(KeyringService, KeyringApplicationName)
-	} else {
-		err = k.Delete(KeyringService, KeyringApplicationName)
-	}
-
-	if err != nil {
+	if err = RemoveProfile(store, ""); err != nil {
 		return fmt.Sprintf("%s: %s", MsgSessionRemovalFailure, err.Error())
 	}
 
 	return MsgSessionRemovalSuccess
 }
 
+// MakeSessionString serialises the session as a versioned JSON document
 func MakeSessionString(email string, session Session) string {
-	return fmt.Sprintf("%s;%s;%s;%s;%s", email, session.Server, session.Token, session.Ak, session.Mk)
+	return makeSessionString(email, session)
 }
 
-func GetSessionFromUser(server string) (Session, string, error) {
+// GetSessionFromUser signs in using credentials from the prompter
+// A *CredentialsError is returned if the prompter does not provide them
+func GetSessionFromUser(server string, p Prompter) (Session, string, error) {
 	var sess Session
 
 	var err error
 
 	var email, password, apiServer, errMsg string
 
-	email, password, apiServer, errMsg = GetCredentials(server)
+	email, password, apiServer, errMsg = GetCredentials(server, p)
 	if errMsg != "" {
-		if strings.Contains(errMsg, "password not defined") {
-			err = fmt.Errorf("password not defined")
-		} else {
-			fmt.Printf("\nerror: %s\n\n", errMsg)
-		}
-
-		return sess, email, err
+		return sess, email, &CredentialsError{Reason: errMsg}
 	}
 
-	sess, err = CliSignIn(email, password, apiServer)
+	sess, err = CliSignIn(email, password, apiServer, p)
 	if err != nil {
 		return sess, email, err
 	}
@@ -236,56 +306,73 @@ func GetSessionFromUser(server string) (Session, string, error) {
 	return sess, email, err
 }
 
-func GetSession(loadSession bool, sessionKey, server string) (session Session, email string, err error) {
+// GetSession returns the active profile's session held in the store, if loadSession is true,
+// or signs in using credentials from the prompter
+func GetSession(loadSession bool, sessionKey, server string, store SessionStore, p Prompter) (session Session, email string, err error) {
 	if loadSession {
-		var rawSess string
-
-		rawSess, err = keyring.Get(KeyringService, KeyringApplicationName)
-		if err != nil {
-			return
-		}
+		return LoadProfileSession("", sessionKey, store, p)
+	}
 
-		if !isUnencryptedSession(rawSess) {
-			if sessionKey == "" {
-				var byteKey []byte
+	return GetSessionFromUser(server, p)
+}
 
-				fmt.Print("session key: ")
+// LoadProfileSession returns a profile's session held in the store, or the active profile's if empty
+// If the session is encrypted and sessionKey is empty then the key is requested from the prompter
+// Sessions encrypted using the legacy format are re-encrypted and stored using the current format
+func LoadProfileSession(profile, sessionKey string, store SessionStore, p Prompter) (session Session, email string, err error) {
+	profile, err = resolveProfile(store, profile)
+	if err != nil {
+		return
+	}
 
-				byteKey, err = terminal.ReadPassword(int(syscall.Stdin))
-				if err != nil {
-					return
-				}
+	var rawSess string
 
-				fmt.Println()
+	rawSess, err = sessionStore(store).Get(profileSessionName(profile))
+	if err != nil {
+		return
+	}
 
-				if len(byteKey) == 0 {
-					err = fmt.Errorf("key not provided")
-					return
-				}
+	if !isUnencryptedSession(rawSess) {
+		legacy := isLegacyEncryptedSession(rawSess)
 
-				sessionKey = string(byteKey)
+		if sessionKey == "" {
+			sessionKey, err = prompt(p, PromptSessionKey, true)
+			if err != nil && !errors.Is(err, ErrPromptUnavailable) {
+				return
 			}
 
-			if rawSess, err = Decrypt([]byte(sessionKey), rawSess); err != nil {
+			if len(sessionKey) == 0 {
+				err = fmt.Errorf("key not provided")
 				return
 			}
 		}
 
-		email, session, err = ParseSessionString(rawSess)
-		if err != nil {
+		if rawSess, err = Decrypt([]byte(sessionKey), rawSess); err != nil {
 			return
 		}
-	} else {
-		session, email, err = GetSessionFromUser(server)
-		if err != nil {
+
+		if !isUnencryptedSession(rawSess) {
+			err = ErrWrongSessionKey
 			return
 		}
+
+		if legacy {
+			// best effort, as the store may be read-only
+			_ = sessionStore(store).Set(profileSessionName(profile), Encrypt([]byte(sessionKey), rawSess))
+		}
 	}
 
+	email, session, err = ParseSessionString(rawSess)
+
 	return session, email, err
 }
 
 func isUnencryptedSession(in string) bool {
+	if isSessionDocument(in) {
+		_, err := parseSessionDocument(in)
+		return err == nil
+	}
+
 	re := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 	if len(strings.Split(in, ";")) == 5 && re.MatchString(strings.Split(in, ";")[0]) {
 		return true
@@ -294,7 +381,35 @@ func isUnencryptedSession(in string) bool {
 	return false
 }
 
+// ParseSessionString returns the email and session from a serialised session
+// Both the JSON document and the legacy form, "email;server;token;ak;mk", are supported
 func ParseSessionString(in string) (email string, session Session, err error) {
+	if isSessionDocument(in) {
+		var doc sessionDocument
+
+		if doc, err = parseSessionDocument(in); err != nil {
+			err = fmt.Errorf("session invalid: %w", err)
+			return
+		}
+
+		session = Session{
+			Token:     doc.Token,
+			Mk:        doc.Mk,
+			Ak:        doc.Ak,
+			Server:    doc.Server,
+			Version:   doc.ProtocolVersion,
+			UserUUID:  doc.UserUUID,
+			KeyParams: doc.KeyParams,
+			CreatedAt: doc.CreatedAt,
+		}
+
+		for _, ik := range doc.ItemsKeys {
+			session.ItemsKeys = append(session.ItemsKeys, ItemsKey(ik))
+		}
+
+		return doc.Email, session, err
+	}
+
 	if !isUnencryptedSession(in) {
 		err = errors.New("session invalid, or encrypted and key was not provided")
 		return
@@ -303,17 +418,71 @@ func ParseSessionString(in string) (email string, session Session, err error) {
 	parts := strings.Split(in, ";")
 	email = parts[0]
 	session = Session{
-		Token:  parts[2],
-		Mk:     parts[4],
-		Ak:     parts[3],
-		Server: parts[1],
+		Token:   parts[2],
+		Mk:      parts[4],
+		Ak:      parts[3],
+		Server:  parts[1],
+		Version: defaultSNVersion,
+	}
+	// only 004 sessions are stored without an auth key
+	if session.Ak == "" {
+		session.Version = "004"
 	}
 
 	return
 }
 
-// decrypt from base64 to decrypted string
+// Decrypt decrypts text encrypted with Encrypt, returning ErrWrongSessionKey if
+// the key is incorrect or the text has been modified
+// Text encrypted with AES-CFB, prior to the versioned format, is also supported
 func Decrypt(key []byte, cryptoText string) (pt string, err error) {
+	if isLegacyEncryptedSession(cryptoText) {
+		return decryptLegacySession(key, cryptoText)
+	}
+
+	components := strings.Split(cryptoText, ":")
+	if len(components) != 4 {
+		return "", fmt.Errorf("expected 4 components in encrypted session but found %d", len(components))
+	}
+
+	var salt, nonce, ciphertext []byte
+
+	if salt, err = base64.RawURLEncoding.DecodeString(components[1]); err != nil {
+		return
+	}
+
+	if nonce, err = base64.RawURLEncoding.DecodeString(components[2]); err != nil {
+		return
+	}
+
+	if ciphertext, err = base64.RawURLEncoding.DecodeString(components[3]); err != nil {
+		return
+	}
+
+	if len(nonce) != chacha20poly1305.NonceSizeX {
+		return "", fmt.Errorf("invalid nonce length: %d", len(nonce))
+	}
+
+	var aead cipher.AEAD
+
+	if aead, err = chacha20poly1305.NewX(deriveSessionKey(key, salt)); err != nil {
+		return
+	}
+
+	var b []byte
+
+	ad := strings.Join(components[:2], ":")
+
+	if b, err = aead.Open(nil, nonce, ciphertext, []byte(ad)); err != nil {
+		return "", ErrWrongSessionKey
+	}
+
+	return string(b), err
+}
+
+// decryptLegacySession decrypts text encrypted with AES-CFB using the padded key
+// As the text is not authenticated, an incorrect key results in garbage rather than an error
+func decryptLegacySession(key []byte, cryptoText string) (pt string, err error) {
 	var ciphertext []byte
 
 	if ciphertext, err = base64.URLEncoding.DecodeString(cryptoText); err != nil {
@@ -343,20 +512,11 @@ func Decrypt(key []byte, cryptoText string) (pt string, err error) {
 	return
 }
 
-func getSessionContent(key, rawSession string) (session string, err error) {
+func getSessionContent(key, rawSession string, p Prompter) (session string, err error) {
 	// check if Session is encrypted
-	if len(strings.Split(rawSession, ";")) != 5 {
+	if !isUnencryptedSession(rawSession) {
 		if key == "" {
-			fmt.Printf("encryption key: ")
-
-			var byteKey []byte
-			byteKey, err = terminal.ReadPassword(int(syscall.Stdin))
-
-			fmt.Println()
-
-			if err == nil {
-				key = string(byteKey)
-			}
+			key, _ = prompt(p, PromptSessionKey, true)
 
 			if len(strings.TrimSpace(key)) == 0 {
 				err = fmt.Errorf("key required")
@@ -369,7 +529,7 @@ func getSessionContent(key, rawSession string) (session string, err error) {
 			return
 		}
 
-		if len(strings.Split(session, ";")) != 5 {
+		if !isUnencryptedSession(session) {
 			err = fmt.Errorf("invalid session or wrong key provided")
 		}
 	} else {
@@ -379,20 +539,65 @@ func getSessionContent(key, rawSession string) (session string, err error) {
 	return
 }
 
-func SessionStatus(sKey string, k keyring.Keyring) (msg string, err error) {
+// SessionStatus returns the email of the active profile's session held in the store,
+// followed by the list of profiles with the active profile marked
+// If the session is encrypted and sKey is empty then the key is requested from the prompter
+func SessionStatus(sKey string, store SessionStore, p Prompter) (msg string, err error) {
+	var profiles []string
+
+	var active string
+
+	profiles, active, err = ListProfiles(store)
+	if err != nil {
+		return
+	}
+
+	if len(profiles) == 0 {
+		return "", errors.New("session store is empty")
+	}
+
+	var email string
+
+	email, err = storedSessionEmail(store, active, sKey, p)
+	if err != nil {
+		return
+	}
+
+	lines := []string{fmt.Sprint("session found: ", email), "profiles:"}
+
+	for _, profile := range profiles {
+		if profile == active {
+			lines = append(lines, fmt.Sprintf("* %s: %s", profile, email))
+			continue
+		}
+
+		// other profiles are only decrypted if encrypted with the same key
+		detail, pErr := storedSessionEmail(store, profile, sKey, nil)
+		if pErr != nil {
+			detail = pErr.Error()
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s: %s", profile, detail))
+	}
+
+	return strings.Join(lines, "\n"), err
+}
+
+// storedSessionEmail returns the email of a profile's session held in the store
+func storedSessionEmail(store SessionStore, profile, sKey string, p Prompter) (email string, err error) {
 	var rawSession string
 
-	rawSession, err = GetSessionFromKeyring(k)
+	rawSession, err = GetStoredProfileSession(store, profile)
 	if err != nil {
 		return
 	}
 
 	if len(rawSession) == 0 {
-		return "", errors.New("keyring is empty")
+		return "", errors.New("session is empty")
 	}
 	// now decrypt if needed
 	var session string
-	session, err = getSessionContent(sKey, rawSession)
+	session, err = getSessionContent(sKey, rawSession, p)
 
 	if err != nil {
 		if strings.Contains(err.Error(), "illegal base64") {
@@ -402,16 +607,10 @@ func SessionStatus(sKey string, k keyring.Keyring) (msg string, err error) {
 		return
 	}
 
-	var email string
-
 	email, _, err = ParseSessionString(session)
 	if err != nil {
-		msg = fmt.Sprint("failed to parse session: ", err)
-
-		return
+		err = fmt.Errorf("failed to parse session: %w", err)
 	}
 
-	msg = fmt.Sprint("session found: ", email)
-
 	return
 }
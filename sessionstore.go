@@ -0,0 +1,300 @@
+package gosn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	keyring "github.com/zalando/go-keyring"
+)
+
+// defaultSessionName is the name under which the session is stored
+const defaultSessionName = KeyringApplicationName
+
+// SessionStore persists session strings by name
+type SessionStore interface {
+	// Get returns the named session, or ErrSessionNotFound if it does not exist
+	Get(name string) (string, error)
+	// Set stores the named session, replacing any existing
+	Set(name, session string) error
+	// Delete removes the named session, returning ErrSessionNotFound if it does not exist
+	Delete(name string) error
+}
+
+// sessionStore returns the store, or the system keyring if nil
+func sessionStore(store SessionStore) SessionStore {
+	if store == nil {
+		return KeyringSessionStore{}
+	}
+
+	return store
+}
+
+// KeyringSessionStore is a SessionStore persisted in a keyring
+type KeyringSessionStore struct {
+	Keyring keyring.Keyring // defaults to the system keyring
+	Service string          // defaults to KeyringService
+}
+
+func (ks KeyringSessionStore) service() string {
+	if ks.Service == "" {
+		return KeyringService
+	}
+
+	return ks.Service
+}
+
+// Get returns the named session from the keyring
+func (ks KeyringSessionStore) Get(name string) (s string, err error) {
+	if ks.Keyring == nil {
+		s, err = keyring.Get(ks.service(), name)
+	} else {
+		s, err = ks.Keyring.Get(ks.service(), name)
+	}
+
+	if errors.Is(err, keyring.ErrNotFound) {
+		err = ErrSessionNotFound
+	}
+
+	return
+}
+
+// Set stores the named session in the keyring
+func (ks KeyringSessionStore) Set(name, session string) error {
+	if ks.Keyring == nil {
+		return keyring.Set(ks.service(), name, session)
+	}
+
+	return ks.Keyring.Set(ks.service(), name, session)
+}
+
+// Delete removes the named session from the keyring
+func (ks KeyringSessionStore) Delete(name string) (err error) {
+	if ks.Keyring == nil {
+		err = keyring.Delete(ks.service(), name)
+	} else {
+		err = ks.Keyring.Delete(ks.service(), name)
+	}
+
+	if errors.Is(err, keyring.ErrNotFound) {
+		err = ErrSessionNotFound
+	}
+
+	return
+}
+
+// FileSessionStore is a SessionStore persisted in a single file, readable only by its owner, with its
+// content encrypted with the key, which is required
+type FileSessionStore struct {
+	Path string
+	Key  string // key the file's content is encrypted with
+
+	mu sync.Mutex
+}
+
+// NewFileSessionStore returns a SessionStore persisted to the specified path, encrypted with the key
+func NewFileSessionStore(path, key string) *FileSessionStore {
+	return &FileSessionStore{
+		Path: path,
+		Key:  key,
+	}
+}
+
+func (fs *FileSessionStore) load() (sessions map[string]string, err error) {
+	if fs.Key == "" {
+		return nil, ErrSessionKeyRequired
+	}
+
+	sessions = make(map[string]string)
+
+	var b []byte
+
+	b, err = ioutil.ReadFile(fs.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	var pt string
+
+	pt, err = Decrypt([]byte(fs.Key), string(b))
+	if err != nil {
+		err = fmt.Errorf("failed to decrypt session file %s: %w", fs.Path, err)
+		return
+	}
+
+	if err = json.Unmarshal([]byte(pt), &sessions); err != nil {
+		err = fmt.Errorf("failed to read session file %s: %w", fs.Path, ErrWrongSessionKey)
+	}
+
+	return
+}
+
+func (fs *FileSessionStore) save(sessions map[string]string) (err error) {
+	var b []byte
+
+	b, err = json.Marshal(sessions)
+	if err != nil {
+		return
+	}
+
+	if fs.Key == "" {
+		return ErrSessionKeyRequired
+	}
+
+	return writeFileAtomic(fs.Path, []byte(Encrypt([]byte(fs.Key), string(b))))
+}
+
+// Get returns the named session from the file
+func (fs *FileSessionStore) Get(name string) (s string, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var sessions map[string]string
+
+	sessions, err = fs.load()
+	if err != nil {
+		return
+	}
+
+	s, ok := sessions[name]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+
+	return s, nil
+}
+
+// Set stores the named session in the file
+func (fs *FileSessionStore) Set(name, session string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var sessions map[string]string
+
+	sessions, err = fs.load()
+	if err != nil {
+		return
+	}
+
+	sessions[name] = session
+
+	return fs.save(sessions)
+}
+
+// Delete removes the named session from the file
+func (fs *FileSessionStore) Delete(name string) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var sessions map[string]string
+
+	sessions, err = fs.load()
+	if err != nil {
+		return
+	}
+
+	if _, ok := sessions[name]; !ok {
+		return ErrSessionNotFound
+	}
+
+	delete(sessions, name)
+
+	return fs.save(sessions)
+}
+
+// MemorySessionStore is a SessionStore held in memory
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]string
+}
+
+// NewMemorySessionStore returns an empty SessionStore held in memory
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]string),
+	}
+}
+
+// Get returns the named session
+func (ms *MemorySessionStore) Get(name string) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s, ok := ms.sessions[name]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+
+	return s, nil
+}
+
+// Set stores the named session
+func (ms *MemorySessionStore) Set(name, session string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.sessions == nil {
+		ms.sessions = make(map[string]string)
+	}
+
+	ms.sessions[name] = session
+
+	return nil
+}
+
+// Delete removes the named session
+func (ms *MemorySessionStore) Delete(name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.sessions[name]; !ok {
+		return ErrSessionNotFound
+	}
+
+	delete(ms.sessions, name)
+
+	return nil
+}
+
+// EnvSessionStore is a read-only SessionStore that returns sessions from environment variables
+// named with the prefix and the upper-cased name, e.g. SN_SESSION
+type EnvSessionStore struct {
+	Prefix string // defaults to "SN"
+}
+
+func (es EnvSessionStore) variable(name string) string {
+	prefix := es.Prefix
+	if prefix == "" {
+		prefix = "SN"
+	}
+
+	return fmt.Sprintf("%s_%s", prefix, strings.ToUpper(name))
+}
+
+// Get returns the value of the named session's environment variable
+func (es EnvSessionStore) Get(name string) (string, error) {
+	s, ok := os.LookupEnv(es.variable(name))
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+
+	return s, nil
+}
+
+// Set is not supported as environment variables cannot be persisted
+func (es EnvSessionStore) Set(name, session string) error {
+	return fmt.Errorf("cannot set %s: environment session store is read-only", es.variable(name))
+}
+
+// Delete is not supported as environment variables cannot be persisted
+func (es EnvSessionStore) Delete(name string) error {
+	return fmt.Errorf("cannot delete %s: environment session store is read-only", es.variable(name))
+}
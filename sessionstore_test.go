@@ -0,0 +1,129 @@
+package gosn
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	keyring "github.com/zalando/go-keyring"
+)
+
+type mockKeyRingEmpty struct{}
+
+func (k mockKeyRingEmpty) Set(service, user, password string) error {
+	return nil
+}
+
+func (k mockKeyRingEmpty) Get(service, user string) (string, error) {
+	return "", keyring.ErrNotFound
+}
+
+func (k mockKeyRingEmpty) Delete(service, user string) error {
+	return keyring.ErrNotFound
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	_, err := store.Get("default")
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+	assert.True(t, errors.Is(store.Delete("default"), ErrSessionNotFound))
+
+	assert.NoError(t, store.Set("default", testSession))
+	assert.NoError(t, store.Set("other", "other session"))
+
+	s, err := store.Get("default")
+	assert.NoError(t, err)
+	assert.Equal(t, testSession, s)
+
+	assert.NoError(t, store.Delete("default"))
+
+	_, err = store.Get("default")
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+
+	s, err = store.Get("other")
+	assert.NoError(t, err)
+	assert.Equal(t, "other session", s)
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	testSessionStore(t, NewMemorySessionStore())
+	testSessionStore(t, &MemorySessionStore{})
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosn-session")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	// sessions are never written unencrypted
+	path := filepath.Join(dir, "sessions")
+	assert.True(t, errors.Is(NewFileSessionStore(path, "").Set("test", "session"), ErrSessionKeyRequired))
+	_, err = NewFileSessionStore(path, "").Get("test")
+	assert.True(t, errors.Is(err, ErrSessionKeyRequired))
+	assert.NoFileExists(t, path)
+
+	encPath := filepath.Join(dir, "sessions.enc")
+	testSessionStore(t, NewFileSessionStore(encPath, "secret"))
+
+	info, err := os.Stat(encPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	b, err := ioutil.ReadFile(encPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "other session")
+
+	_, err = NewFileSessionStore(encPath, "wrong").Get("other")
+	assert.True(t, errors.Is(err, ErrWrongSessionKey))
+
+	// no temporary files are left behind
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestKeyringSessionStoreNotFound(t *testing.T) {
+	store := KeyringSessionStore{Keyring: mockKeyRingEmpty{}}
+
+	_, err := store.Get(defaultSessionName)
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+	assert.True(t, errors.Is(store.Delete(defaultSessionName), ErrSessionNotFound))
+}
+
+func TestEnvSessionStore(t *testing.T) {
+	store := EnvSessionStore{Prefix: "GOSN_TEST"}
+
+	_, err := store.Get(defaultSessionName)
+	assert.True(t, errors.Is(err, ErrSessionNotFound))
+
+	assert.NoError(t, os.Setenv("GOSN_TEST_SESSION", testSession))
+
+	defer os.Unsetenv("GOSN_TEST_SESSION")
+
+	s, err := store.Get(defaultSessionName)
+	assert.NoError(t, err)
+	assert.Equal(t, testSession, s)
+
+	assert.Error(t, store.Set(defaultSessionName, testSession))
+	assert.Error(t, store.Delete(defaultSessionName))
+}
+
+func TestGetSessionFromStore(t *testing.T) {
+	store := NewMemorySessionStore()
+	assert.NoError(t, store.Set(defaultSessionName, testSession))
+
+	session, email, err := GetSession(true, "", "", store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, testSessionEmail, email)
+	assert.Equal(t, testSessionToken, session.Token)
+
+	msg, err := SessionStatus("", store, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, msg, "session found: "+testSessionEmail)
+
+	assert.Equal(t, MsgSessionRemovalSuccess, RemoveSession(store))
+	assert.Contains(t, RemoveSession(store), MsgSessionRemovalFailure)
+}
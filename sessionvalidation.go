@@ -0,0 +1,140 @@
+package gosn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ValidateSession checks the session is accepted by the server by making a sync request for a single item
+// ErrUnauthorized or ErrSessionExpired are returned if the server rejects the session's token
+func ValidateSession(session Session) error {
+	return defaultClient.ValidateSession(session)
+}
+
+// ValidateSessionWithContext is ValidateSession with a context that can cancel the request made
+func ValidateSessionWithContext(ctx context.Context, session Session) error {
+	return defaultClient.ValidateSessionWithContext(ctx, session)
+}
+
+// ValidateSession checks the session is accepted by the server by making a sync request for a single item
+// ErrUnauthorized or ErrSessionExpired are returned if the server rejects the session's token
+func (c *Client) ValidateSession(session Session) error {
+	return c.ValidateSessionWithContext(context.Background(), session)
+}
+
+// ValidateSessionWithContext is ValidateSession with a context that can cancel the request made
+func (c *Client) ValidateSessionWithContext(ctx context.Context, session Session) (err error) {
+	if !session.Valid() {
+		return ErrSessionInvalid
+	}
+
+	var reqBody []byte
+
+	reqBody, err = json.Marshal(syncRequest{
+		Items: EncryptedItems{},
+		Limit: 1,
+		API:   syncAPIVersion,
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = c.makeSyncRequest(ctx, session, reqBody, false)
+
+	return err
+}
+
+// isSessionRejected returns true if the error shows the server no longer accepts the session's token
+func isSessionRejected(err error) bool {
+	return errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrSessionExpired)
+}
+
+// LoadValidSession returns a profile's session held in the store, or the active profile's if empty,
+// having checked it is still accepted by the server
+// If the server rejects the session and a prompter is provided, then the password, and MFA token if
+// required, are requested from it to sign in again and the new session replaces the one in the store
+func LoadValidSession(profile, sessionKey string, store SessionStore, p Prompter) (session Session, email string, err error) {
+	return defaultClient.LoadValidSessionWithContext(context.Background(), profile, sessionKey, store, p)
+}
+
+// LoadValidSessionWithContext is LoadValidSession with a context that can cancel the requests made
+func LoadValidSessionWithContext(ctx context.Context, profile, sessionKey string, store SessionStore,
+	p Prompter) (session Session, email string, err error) {
+	return defaultClient.LoadValidSessionWithContext(ctx, profile, sessionKey, store, p)
+}
+
+// LoadValidSession returns a profile's session held in the store, or the active profile's if empty,
+// having checked it is still accepted by the server
+// If the server rejects the session and a prompter is provided, then the password, and MFA token if
+// required, are requested from it to sign in again and the new session replaces the one in the store
+func (c *Client) LoadValidSession(profile, sessionKey string, store SessionStore, p Prompter) (session Session, email string, err error) {
+	return c.LoadValidSessionWithContext(context.Background(), profile, sessionKey, store, p)
+}
+
+// LoadValidSessionWithContext is LoadValidSession with a context that can cancel the requests made
+func (c *Client) LoadValidSessionWithContext(ctx context.Context, profile, sessionKey string, store SessionStore,
+	p Prompter) (session Session, email string, err error) {
+	profile, err = resolveProfile(store, profile)
+	if err != nil {
+		return
+	}
+
+	var rawSess string
+
+	rawSess, err = sessionStore(store).Get(profileSessionName(profile))
+	if err != nil {
+		return
+	}
+
+	// request the key up front so the refreshed session can be stored encrypted with it
+	if !isUnencryptedSession(rawSess) && sessionKey == "" {
+		sessionKey, err = prompt(p, PromptSessionKey, true)
+		if err != nil && !errors.Is(err, ErrPromptUnavailable) {
+			return
+		}
+
+		if sessionKey == "" {
+			err = fmt.Errorf("key not provided")
+			return
+		}
+	}
+
+	session, email, err = LoadProfileSession(profile, sessionKey, store, p)
+	if err != nil {
+		return
+	}
+
+	err = c.ValidateSessionWithContext(ctx, session)
+	if err == nil || !isSessionRejected(err) || p == nil {
+		return
+	}
+
+	// sign in again using the stored account details
+	var password string
+
+	password, err = prompt(p, PromptPassword, true)
+	if err != nil {
+		return
+	}
+
+	var refreshed Session
+
+	refreshed, err = c.CliSignIn(email, password, session.Server, p)
+	if err != nil {
+		return
+	}
+
+	rS := makeSessionString(email, refreshed)
+	if sessionKey != "" {
+		rS = Encrypt([]byte(sessionKey), rS)
+	}
+
+	if err = writeProfileSession(store, profile, rS); err != nil {
+		err = fmt.Errorf("failed to store refreshed session: %w", err)
+		return
+	}
+
+	return refreshed, email, err
+}
@@ -0,0 +1,64 @@
+package gosn
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSession(t *testing.T) {
+	_, session := signInNewTestUser(t, "secret")
+	assert.NoError(t, ValidateSession(session))
+
+	session.Token = "invalid"
+	assert.True(t, errors.Is(ValidateSession(session), ErrUnauthorized))
+
+	assert.True(t, errors.Is(ValidateSession(Session{}), ErrSessionInvalid))
+}
+
+func TestValidateSessionExpired(t *testing.T) {
+	c := NewClient(ClientConfig{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(req, statusExpiredAccessToken, map[string]interface{}{
+				"error": map[string]string{"tag": expiredAccessTokenTag, "message": "The provided access token has expired."},
+			}), nil
+		}),
+	})
+
+	err := c.ValidateSession(Session{Mk: testSyncMk, Ak: testSyncAk, Token: "token", Server: "https://sn.example.com"})
+	assert.True(t, errors.Is(err, ErrSessionExpired))
+	assert.False(t, errors.Is(err, ErrUnauthorized))
+}
+
+func TestLoadValidSessionRefreshesRejectedSession(t *testing.T) {
+	email, session := signInNewTestUser(t, "secret")
+
+	session.Token = "revoked"
+
+	store := NewMemorySessionStore()
+	assert.NoError(t, writeProfileSession(store, DefaultProfile, Encrypt([]byte("key"), makeSessionString(email, session))))
+
+	// without a prompter the rejection is returned
+	_, _, err := LoadValidSession("", "key", store, nil)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	refreshed, refreshedEmail, err := LoadValidSession("", "", store, StaticPrompter{
+		PromptSessionKey: "key",
+		PromptPassword:   "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, email, refreshedEmail)
+	assert.NotEqual(t, "revoked", refreshed.Token)
+	assert.NoError(t, ValidateSession(refreshed))
+
+	// the refreshed session replaces the stored session, encrypted with the same key
+	raw, err := store.Get(defaultSessionName)
+	assert.NoError(t, err)
+	assert.False(t, isUnencryptedSession(raw))
+
+	stored, _, err := LoadValidSession("", "key", store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, refreshed.Token, stored.Token)
+}
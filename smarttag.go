@@ -0,0 +1,606 @@
+package gosn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const smartTagContentType = "SN|SmartTag"
+
+// SmartTagPredicate is the condition the notes shown by a smart tag meet
+// Compound predicates have the operator "and" or "or", with the predicates they combine held in Value
+type SmartTagPredicate struct {
+	KeyPath  string      `json:"keypath"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+// UnmarshalJSON reads a predicate held as an object or, as written by older clients, as an array
+// of the key path, operator and value
+func (p *SmartTagPredicate) UnmarshalJSON(b []byte) error {
+	var legacy []interface{}
+
+	if err := json.Unmarshal(b, &legacy); err == nil {
+		if len(legacy) != 3 {
+			return fmt.Errorf("invalid predicate: %s", b)
+		}
+
+		keyPath, kOK := legacy[0].(string)
+		operator, oOK := legacy[1].(string)
+
+		if !kOK || !oOK {
+			return fmt.Errorf("invalid predicate: %s", b)
+		}
+
+		*p = SmartTagPredicate{KeyPath: keyPath, Operator: operator, Value: legacy[2]}
+
+		return nil
+	}
+
+	type predicate SmartTagPredicate
+
+	var pp predicate
+
+	if err := json.Unmarshal(b, &pp); err != nil {
+		return err
+	}
+
+	*p = SmartTagPredicate(pp)
+
+	return nil
+}
+
+func (p SmartTagPredicate) isCompound() bool {
+	op := strings.ToLower(p.Operator)
+
+	return op == "and" || op == "or"
+}
+
+// subPredicate returns the predicate held in the value
+func (p SmartTagPredicate) subPredicate() (sp SmartTagPredicate, err error) {
+	err = remarshal(p.Value, &sp)
+
+	return
+}
+
+// remarshal converts a decoded JSON value into the type that out points to
+func remarshal(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// ItemFilters returns the filters that match the notes the predicate does
+func (p SmartTagPredicate) ItemFilters() (f ItemFilters, err error) {
+	if !p.isCompound() {
+		var filter Filter
+
+		filter, err = p.filter()
+		if err != nil {
+			return
+		}
+
+		f.Filters = []Filter{filter}
+
+		return
+	}
+
+	f.MatchAny = strings.ToLower(p.Operator) == "or"
+
+	var predicates []SmartTagPredicate
+
+	if err = remarshal(p.Value, &predicates); err != nil {
+		return f, fmt.Errorf("invalid compound predicate: %w", err)
+	}
+
+	for _, sp := range predicates {
+		if sp.isCompound() {
+			return f, errors.New("unsupported predicate: nested compound predicates cannot be expressed as filters")
+		}
+
+		var filter Filter
+
+		filter, err = sp.filter()
+		if err != nil {
+			return
+		}
+
+		f.Filters = append(f.Filters, filter)
+	}
+
+	return f, err
+}
+
+// filter returns the note filter equivalent to a predicate that is not compound
+func (p SmartTagPredicate) filter() (f Filter, err error) {
+	f.Type = "Note"
+
+	keyPath := strings.TrimPrefix(p.KeyPath, "content.")
+	unsupported := fmt.Errorf("unsupported predicate: %s %s %v", p.KeyPath, p.Operator, p.Value)
+
+	switch keyPath {
+	case "title", "text":
+		value, ok := p.Value.(string)
+		if !ok {
+			return f, unsupported
+		}
+
+		f.Key = keyPath
+		f.Value = value
+
+		switch p.Operator {
+		case "=":
+			f.Comparison = "=="
+		case "!=":
+			f.Comparison = "!="
+		case "includes":
+			f.Comparison = "contains"
+		case "matches":
+			f.Comparison = "~"
+		case "startsWith":
+			f.Comparison = "startswith"
+		default:
+			return f, unsupported
+		}
+	case "uuid":
+		value, ok := p.Value.(string)
+		if !ok || p.Operator != "=" {
+			return f, unsupported
+		}
+
+		f.Key = "uuid"
+		f.Value = value
+	case "tags":
+		if p.Operator != "includes" {
+			return f, unsupported
+		}
+
+		var tp SmartTagPredicate
+
+		tp, err = p.subPredicate()
+		if err != nil {
+			return f, unsupported
+		}
+
+		value, ok := tp.Value.(string)
+		if !ok {
+			return f, unsupported
+		}
+
+		f.Value = value
+
+		switch {
+		case tp.KeyPath == "title" && tp.Operator == "=":
+			f.Key = "tagtitle"
+			f.Comparison = "=="
+		case tp.KeyPath == "title" && tp.Operator == "matches":
+			f.Key = "tagtitle"
+			f.Comparison = "~"
+		case tp.KeyPath == "uuid" && tp.Operator == "=":
+			f.Key = "taguuid"
+			f.Comparison = "=="
+		default:
+			return f, unsupported
+		}
+	case "trashed", "pinned", "archived", "locked":
+		value, ok := p.Value.(bool)
+		if !ok || p.Operator != "=" {
+			return f, unsupported
+		}
+
+		f.Key = keyPath
+		f.Value = strconv.FormatBool(value)
+	default:
+		return f, unsupported
+	}
+
+	return f, err
+}
+
+// NewSmartTagPredicate returns the predicate equivalent to the note filters
+func NewSmartTagPredicate(f ItemFilters) (p SmartTagPredicate, err error) {
+	if len(f.Filters) == 0 {
+		return p, errors.New("at least one filter is required")
+	}
+
+	var predicates []SmartTagPredicate
+
+	for _, filter := range f.Filters {
+		var fp SmartTagPredicate
+
+		fp, err = filterPredicate(filter)
+		if err != nil {
+			return
+		}
+
+		predicates = append(predicates, fp)
+	}
+
+	if len(predicates) == 1 {
+		return predicates[0], err
+	}
+
+	p.Operator = "and"
+	if f.MatchAny {
+		p.Operator = "or"
+	}
+
+	p.Value = predicates
+
+	return p, err
+}
+
+// filterPredicate returns the predicate equivalent to a note filter
+func filterPredicate(f Filter) (p SmartTagPredicate, err error) {
+	unsupported := fmt.Errorf("unsupported filter: %s %s %s %s", f.Type, f.Key, f.Comparison, f.Value)
+
+	if f.Type != "Note" || f.IncludeSubTags {
+		return p, unsupported
+	}
+
+	key := strings.ToLower(f.Key)
+
+	switch key {
+	case "title", "text":
+		p.KeyPath = key
+		p.Value = f.Value
+
+		switch f.Comparison {
+		case "==":
+			p.Operator = "="
+		case "!=":
+			p.Operator = "!="
+		case "contains":
+			p.Operator = "includes"
+		case "~":
+			p.Operator = "matches"
+		case "startswith":
+			p.Operator = "startsWith"
+		default:
+			return p, unsupported
+		}
+	case "uuid":
+		p = SmartTagPredicate{KeyPath: "uuid", Operator: "=", Value: f.Value}
+	case "tagtitle", "taguuid":
+		tp := SmartTagPredicate{KeyPath: "title", Operator: "=", Value: f.Value}
+
+		switch {
+		case key == "tagtitle" && f.Comparison == "==":
+		case key == "tagtitle" && f.Comparison == "~":
+			tp.Operator = "matches"
+		case key == "taguuid" && f.Comparison == "==":
+			tp.KeyPath = "uuid"
+		default:
+			return p, unsupported
+		}
+
+		p = SmartTagPredicate{KeyPath: "tags", Operator: "includes", Value: tp}
+	case "trashed", "pinned", "archived", "locked":
+		var value bool
+
+		value, err = strconv.ParseBool(f.Value)
+		if err != nil {
+			return p, unsupported
+		}
+
+		p = SmartTagPredicate{KeyPath: key, Operator: "=", Value: value}
+	default:
+		return p, unsupported
+	}
+
+	return p, err
+}
+
+// SmartTagContent is the content of a smart tag, a saved search showing the notes matching its predicate
+type SmartTagContent struct {
+	Title          string            `json:"title"`
+	Predicate      SmartTagPredicate `json:"predicate"`
+	ItemReferences ItemReferences    `json:"references"`
+	AppData        AppDataContent    `json:"appData"`
+
+	// attributes not modelled, such as those added by newer clients, written back as is
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON returns the modelled attributes along with any others retained when unmarshalled
+func (stc SmartTagContent) MarshalJSON() ([]byte, error) {
+	type content SmartTagContent
+
+	return marshalWithOther(content(stc), stc.Other)
+}
+
+// UnmarshalJSON populates the modelled attributes and retains any others
+func (stc *SmartTagContent) UnmarshalJSON(b []byte) (err error) {
+	type content SmartTagContent
+
+	var c content
+
+	c.Other, err = unmarshalWithOther(b, &c)
+	if err != nil {
+		return
+	}
+
+	*stc = SmartTagContent(c)
+
+	return
+}
+
+// NewSmartTagContent returns an empty Smart Tag content instance
+func NewSmartTagContent() *SmartTagContent {
+	c := &SmartTagContent{
+		ItemReferences: ItemReferences{},
+	}
+	c.SetUpdateTime(time.Now().UTC())
+
+	return c
+}
+
+// NewSmartTag returns an Item of type Smart Tag showing the notes matched by the filters
+func NewSmartTag(title string, f ItemFilters) (item *Item, err error) {
+	content := NewSmartTagContent()
+	content.Title = title
+
+	content.Predicate, err = NewSmartTagPredicate(f)
+	if err != nil {
+		return
+	}
+
+	item = newItem()
+	item.ContentType = smartTagContentType
+	item.Content = content
+
+	return item, err
+}
+
+// ItemFilters returns the filters that match the notes the smart tag shows
+func (stc *SmartTagContent) ItemFilters() (ItemFilters, error) {
+	return stc.Predicate.ItemFilters()
+}
+
+func (stc *SmartTagContent) GetTitle() string {
+	return stc.Title
+}
+
+func (stc *SmartTagContent) SetTitle(title string) {
+	stc.Title = title
+}
+
+func (stc *SmartTagContent) GetText() string {
+	// Smart Tags only have titles, so empty string
+	return ""
+}
+
+func (stc *SmartTagContent) SetText(text string) {
+	// not implemented
+}
+
+func (stc *SmartTagContent) References() ItemReferences {
+	var output ItemReferences
+	return append(output, stc.ItemReferences...)
+}
+
+func (stc *SmartTagContent) SetReferences(newRefs ItemReferences) {
+	stc.ItemReferences = newRefs
+}
+
+func (stc *SmartTagContent) UpsertReferences(newRefs ItemReferences) {
+	for _, newRef := range newRefs {
+		var found bool
+
+		for _, existingRef := range stc.ItemReferences {
+			if existingRef.UUID == newRef.UUID {
+				found = true
+			}
+		}
+
+		if !found {
+			stc.ItemReferences = append(stc.ItemReferences, newRef)
+		}
+	}
+}
+
+func (stc *SmartTagContent) GetUpdateTime() (time.Time, error) {
+	if stc.AppData.OrgStandardNotesSN.ClientUpdatedAt == "" {
+		return time.Time{}, fmt.Errorf("notset")
+	}
+
+	return time.Parse(timeLayout, stc.AppData.OrgStandardNotesSN.ClientUpdatedAt)
+}
+
+func (stc *SmartTagContent) SetUpdateTime(uTime time.Time) {
+	stc.AppData.OrgStandardNotesSN.ClientUpdatedAt = uTime.Format(timeLayout)
+}
+
+func (stc *SmartTagContent) GetAppData() AppDataContent {
+	return stc.AppData
+}
+
+func (stc *SmartTagContent) SetAppData(data AppDataContent) {
+	stc.AppData = data
+}
+
+func (stc *SmartTagContent) IsPinned() bool {
+	return stc.AppData.OrgStandardNotesSN.Pinned
+}
+
+func (stc *SmartTagContent) SetPinned(pinned bool) {
+	stc.AppData.OrgStandardNotesSN.Pinned = pinned
+}
+
+func (stc *SmartTagContent) IsArchived() bool {
+	return stc.AppData.OrgStandardNotesSN.Archived
+}
+
+func (stc *SmartTagContent) SetArchived(archived bool) {
+	stc.AppData.OrgStandardNotesSN.Archived = archived
+}
+
+func (stc *SmartTagContent) IsLocked() bool {
+	return stc.AppData.OrgStandardNotesSN.Locked
+}
+
+func (stc *SmartTagContent) SetLocked(locked bool) {
+	stc.AppData.OrgStandardNotesSN.Locked = locked
+}
+
+func (stc *SmartTagContent) IsTrashed() bool {
+	return stc.AppData.OrgStandardNotesSN.Trashed
+}
+
+func (stc *SmartTagContent) SetTrashed(trashed bool) {
+	stc.AppData.OrgStandardNotesSN.Trashed = trashed
+}
+
+func (stc *SmartTagContent) PrefersPlainEditor() bool {
+	return stc.AppData.OrgStandardNotesSN.PrefersPlainEditor
+}
+
+func (stc *SmartTagContent) SetPrefersPlainEditor(prefers bool) {
+	stc.AppData.OrgStandardNotesSN.PrefersPlainEditor = prefers
+}
+
+func (stc *SmartTagContent) GetName() string {
+	return "not implemented"
+}
+
+func (stc *SmartTagContent) GetActive() bool {
+	// not implemented
+	return false
+}
+
+func (stc *SmartTagContent) GetItemAssociations() []string {
+	panic("not implemented")
+}
+
+func (stc *SmartTagContent) GetItemDisassociations() []string {
+	panic("not implemented")
+}
+
+func (stc *SmartTagContent) AssociateItems(newItems []string) {
+
+}
+
+func (stc *SmartTagContent) DisassociateItems(newItems []string) {
+
+}
+
+// SmartTagNotes returns the notes the smart tag shows from those in items
+// As in the official apps, trashed notes are only included if the smart tag's predicate refers to the trash
+func SmartTagNotes(smartTag Item, items Items) (notes Items, err error) {
+	stc, ok := smartTag.Content.(*SmartTagContent)
+	if !ok {
+		return nil, fmt.Errorf("item %s is not a smart tag", smartTag.UUID)
+	}
+
+	var f ItemFilters
+
+	f, err = stc.ItemFilters()
+	if err != nil {
+		return
+	}
+
+	var refersToTrash bool
+
+	for _, filter := range f.Filters {
+		if strings.ToLower(filter.Key) == "trashed" {
+			refersToTrash = true
+		}
+	}
+
+	// tags are retained so notes can be filtered by their tags
+	var candidates Items
+
+	for _, item := range items {
+		if item.Deleted || item.Content == nil {
+			continue
+		}
+
+		if item.ContentType == "Tag" || (item.ContentType == "Note" && (refersToTrash || !isTrashed(item.Content))) {
+			candidates = append(candidates, item)
+		}
+	}
+
+	candidates.Filter(f)
+
+	for _, item := range candidates {
+		if item.ContentType == "Note" {
+			notes = append(notes, item)
+		}
+	}
+
+	return notes, err
+}
+
+// CreateSmartTag creates a smart tag showing the notes matched by the filters and puts it
+func CreateSmartTag(session Session, title string, f ItemFilters, debug bool) (Item, error) {
+	return defaultClient.CreateSmartTagWithContext(context.Background(), session, title, f, debug)
+}
+
+// CreateSmartTagWithContext is CreateSmartTag with a context that can cancel the request made
+func CreateSmartTagWithContext(ctx context.Context, session Session, title string, f ItemFilters, debug bool) (Item, error) {
+	return defaultClient.CreateSmartTagWithContext(ctx, session, title, f, debug)
+}
+
+// CreateSmartTag creates a smart tag showing the notes matched by the filters and puts it
+func (c *Client) CreateSmartTag(session Session, title string, f ItemFilters, debug bool) (Item, error) {
+	return c.CreateSmartTagWithContext(context.Background(), session, title, f, debug)
+}
+
+// CreateSmartTagWithContext is CreateSmartTag with a context that can cancel the request made
+func (c *Client) CreateSmartTagWithContext(ctx context.Context, session Session, title string, f ItemFilters,
+	debug bool) (smartTag Item, err error) {
+	var item *Item
+
+	item, err = NewSmartTag(title, f)
+	if err != nil {
+		return
+	}
+
+	if err = c.putDecryptedItems(ctx, session, Items{*item}, debug); err != nil {
+		return
+	}
+
+	return *item, err
+}
+
+// GetSmartTagNotes retrieves the session's items and returns the notes the specified smart tag shows
+func GetSmartTagNotes(session Session, smartTagUUID string, debug bool) (Items, error) {
+	return defaultClient.GetSmartTagNotesWithContext(context.Background(), session, smartTagUUID, debug)
+}
+
+// GetSmartTagNotesWithContext is GetSmartTagNotes with a context that can cancel the requests made
+func GetSmartTagNotesWithContext(ctx context.Context, session Session, smartTagUUID string, debug bool) (Items, error) {
+	return defaultClient.GetSmartTagNotesWithContext(ctx, session, smartTagUUID, debug)
+}
+
+// GetSmartTagNotes retrieves the session's items and returns the notes the specified smart tag shows
+func (c *Client) GetSmartTagNotes(session Session, smartTagUUID string, debug bool) (Items, error) {
+	return c.GetSmartTagNotesWithContext(context.Background(), session, smartTagUUID, debug)
+}
+
+// GetSmartTagNotesWithContext is GetSmartTagNotes with a context that can cancel the requests made
+func (c *Client) GetSmartTagNotesWithContext(ctx context.Context, session Session, smartTagUUID string,
+	debug bool) (notes Items, err error) {
+	var items Items
+
+	items, err = c.getParsedItems(ctx, &session, debug)
+	if err != nil {
+		return
+	}
+
+	for _, item := range items {
+		if item.UUID == smartTagUUID && item.ContentType == smartTagContentType {
+			return SmartTagNotes(item, items)
+		}
+	}
+
+	return nil, fmt.Errorf("smart tag %s not found", smartTagUUID)
+}
@@ -0,0 +1,165 @@
+package gosn
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSmartTag(t *testing.T) {
+	content := `{"title":"work or plans","predicate":{"keypath":"","operator":"or","value":[` +
+		`{"keypath":"tags","operator":"includes","value":{"keypath":"title","operator":"=","value":"work"}},` +
+		`{"keypath":"title","operator":"startsWith","value":"plan."},` +
+		`{"keypath":"pinned","operator":"=","value":true}]},"references":[],"appData":{}}`
+
+	parsed, err := processContentModel(smartTagContentType, content)
+	assert.NoError(t, err)
+
+	stc, ok := parsed.(*SmartTagContent)
+	assert.True(t, ok)
+	assert.Equal(t, "work or plans", stc.GetTitle())
+
+	f, err := stc.ItemFilters()
+	assert.NoError(t, err)
+	assert.Equal(t, ItemFilters{
+		MatchAny: true,
+		Filters: []Filter{
+			{Type: "Note", Key: "tagtitle", Comparison: "==", Value: "work"},
+			{Type: "Note", Key: "title", Comparison: "startswith", Value: "plan."},
+			{Type: "Note", Key: "pinned", Value: "true"},
+		},
+	}, f)
+
+	legacy, err := processContentModel(smartTagContentType, `{"title":"legacy","predicate":["content.text","includes","todo"]}`)
+	assert.NoError(t, err)
+
+	f, err = legacy.(*SmartTagContent).ItemFilters()
+	assert.NoError(t, err)
+	assert.Equal(t, ItemFilters{Filters: []Filter{{Type: "Note", Key: "text", Comparison: "contains", Value: "todo"}}}, f)
+}
+
+func TestSmartTagPredicateRoundTrip(t *testing.T) {
+	f := ItemFilters{
+		Filters: []Filter{
+			{Type: "Note", Key: "title", Comparison: "==", Value: "title"},
+			{Type: "Note", Key: "text", Comparison: "~", Value: "^a.*b$"},
+			{Type: "Note", Key: "title", Comparison: "startswith", Value: "plan (draft)"},
+			{Type: "Note", Key: "tagtitle", Comparison: "~", Value: "wo"},
+			{Type: "Note", Key: "taguuid", Comparison: "==", Value: "tag-uuid"},
+			{Type: "Note", Key: "uuid", Value: "note-uuid"},
+			{Type: "Note", Key: "trashed", Value: "false"},
+		},
+	}
+
+	p, err := NewSmartTagPredicate(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "and", p.Operator)
+
+	// round trip through JSON as the predicate would be when synced
+	b, err := json.Marshal(p)
+	assert.NoError(t, err)
+
+	var decoded SmartTagPredicate
+
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+
+	rf, err := decoded.ItemFilters()
+	assert.NoError(t, err)
+	assert.Equal(t, f, rf)
+
+	single, err := NewSmartTagPredicate(ItemFilters{Filters: []Filter{{Type: "Note", Key: "Archived", Value: "true"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, SmartTagPredicate{KeyPath: "archived", Operator: "=", Value: true}, single)
+}
+
+func TestSmartTagPredicateUnsupported(t *testing.T) {
+	_, err := NewSmartTagPredicate(ItemFilters{})
+	assert.Error(t, err)
+
+	_, err = NewSmartTagPredicate(ItemFilters{Filters: []Filter{{Type: "Tag", Key: "title", Comparison: "==", Value: "x"}}})
+	assert.Error(t, err)
+
+	_, err = NewSmartTagPredicate(ItemFilters{Filters: []Filter{{Type: "Note", Key: "deleted", Value: "true"}}})
+	assert.Error(t, err)
+
+	_, err = SmartTagPredicate{KeyPath: "userModifiedDate", Operator: ">", Value: "7.days.ago"}.ItemFilters()
+	assert.Error(t, err)
+
+	nested := SmartTagPredicate{Operator: "and", Value: []SmartTagPredicate{
+		{Operator: "or", Value: []SmartTagPredicate{{KeyPath: "title", Operator: "=", Value: "x"}}},
+	}}
+	_, err = nested.ItemFilters()
+	assert.Error(t, err)
+}
+
+func TestSmartTagNotes(t *testing.T) {
+	work := createNote("meeting", "", "")
+	plan := createNote("plan for today", "", "")
+	other := createNote("other", "", "")
+	trashedPlan := createNote("plan to bin", "", "")
+	trashedPlan.Content.(*NoteContent).SetTrashed(true)
+
+	tag := createTag("work", "")
+	tag = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*tag}, ToRef: Items{*work}}).Items[0]
+
+	smartTag, err := NewSmartTag("work or plans", ItemFilters{
+		MatchAny: true,
+		Filters: []Filter{
+			{Type: "Note", Key: "tagtitle", Comparison: "==", Value: "work"},
+			{Type: "Note", Key: "title", Comparison: "contains", Value: "plan"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, smartTagContentType, smartTag.ContentType)
+
+	items := Items{*work, *plan, *other, *trashedPlan, *tag, *smartTag}
+
+	notes, err := SmartTagNotes(*smartTag, items)
+	assert.NoError(t, err)
+	assert.Equal(t, Items{*work, *plan}, notes)
+
+	trash, err := NewSmartTag("trash", ItemFilters{Filters: []Filter{{Type: "Note", Key: "trashed", Value: "true"}}})
+	assert.NoError(t, err)
+
+	notes, err = SmartTagNotes(*trash, items)
+	assert.NoError(t, err)
+	assert.Equal(t, Items{*trashedPlan}, notes)
+
+	plans, err := NewSmartTag("plans", ItemFilters{Filters: []Filter{{Type: "Note", Key: "title", Comparison: "startswith", Value: "plan"}}})
+	assert.NoError(t, err)
+
+	notes, err = SmartTagNotes(*plans, items)
+	assert.NoError(t, err)
+	assert.Equal(t, Items{*plan}, notes)
+
+	_, err = SmartTagNotes(*tag, items)
+	assert.Error(t, err)
+}
+
+func TestCreateSmartTagAndGetNotes(t *testing.T) {
+	_, session := signInNewTestUser(t, "secret")
+
+	match := createNote("match", "", "")
+	miss := createNote("miss", "", "")
+	notes := Items{*match, *miss}
+
+	eNotes, err := notes.EncryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eNotes})
+	assert.NoError(t, err)
+
+	smartTag, err := CreateSmartTag(session, "matches", ItemFilters{
+		Filters: []Filter{{Type: "Note", Key: "title", Comparison: "==", Value: "match"}},
+	}, false)
+	assert.NoError(t, err)
+
+	found, err := GetSmartTagNotes(session, smartTag.UUID, false)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, match.UUID, found[0].UUID)
+
+	_, err = GetSmartTagNotes(session, match.UUID, false)
+	assert.Error(t, err)
+}
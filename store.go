@@ -0,0 +1,174 @@
+package gosn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ItemStore persists encrypted items along with the sync token of the last completed sync
+type ItemStore interface {
+	// Load returns the stored items and sync token
+	Load() (items EncryptedItems, syncToken string, err error)
+	// Apply merges the items into the store, removing any deleted, and records the sync token
+	Apply(items EncryptedItems, syncToken string) error
+}
+
+// FileItemStore is an ItemStore persisted as JSON in a single file
+type FileItemStore struct {
+	Path string
+}
+
+type itemStoreContent struct {
+	SyncToken string         `json:"sync_token"`
+	Items     EncryptedItems `json:"items"`
+}
+
+// NewFileItemStore returns an ItemStore persisted to the specified path
+func NewFileItemStore(path string) *FileItemStore {
+	return &FileItemStore{
+		Path: path,
+	}
+}
+
+// Load returns the stored items and sync token
+// If the file does not exist, then the store is empty
+func (fs *FileItemStore) Load() (items EncryptedItems, syncToken string, err error) {
+	var b []byte
+
+	b, err = ioutil.ReadFile(fs.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	var content itemStoreContent
+
+	err = json.Unmarshal(b, &content)
+	if err != nil {
+		err = fmt.Errorf("failed to read item store %s: %+v", fs.Path, err)
+		return
+	}
+
+	return content.Items, content.SyncToken, err
+}
+
+// Apply merges the items into the store, removing any deleted, and records the sync token
+func (fs *FileItemStore) Apply(items EncryptedItems, syncToken string) (err error) {
+	var existing EncryptedItems
+
+	existing, _, err = fs.Load()
+	if err != nil {
+		return
+	}
+
+	var b []byte
+
+	b, err = json.Marshal(itemStoreContent{
+		SyncToken: syncToken,
+		Items:     mergeEncryptedItems(existing, items),
+	})
+	if err != nil {
+		return
+	}
+
+	return writeFileAtomic(fs.Path, b)
+}
+
+// mergeEncryptedItems returns the existing items updated with the changes
+// Changed items replace existing items with the same UUID and deleted items are removed
+func mergeEncryptedItems(existing, changes EncryptedItems) (merged EncryptedItems) {
+	latest := make(map[string]EncryptedItem, len(changes))
+
+	for _, c := range changes {
+		latest[c.UUID] = c
+	}
+
+	for _, e := range existing {
+		if c, ok := latest[e.UUID]; ok {
+			e = c
+
+			delete(latest, c.UUID)
+		}
+
+		if !e.Deleted {
+			merged = append(merged, e)
+		}
+	}
+
+	// append new items in the order received
+	for _, c := range changes {
+		if l, ok := latest[c.UUID]; ok {
+			if !l.Deleted {
+				merged = append(merged, l)
+			}
+
+			delete(latest, c.UUID)
+		}
+	}
+
+	return merged
+}
+
+// writeFileAtomic writes the data to a temporary file, readable only by the owner, before moving it into place
+func writeFileAtomic(path string, data []byte) (err error) {
+	var f *os.File
+
+	f, err = ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return
+	}
+
+	tmpPath := f.Name()
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if err = f.Chmod(0600); err != nil {
+		_ = f.Close()
+		return
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return
+	}
+
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return
+	}
+
+	if err = f.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// LoadStoredItems returns the decrypted and parsed items held in the store
+func LoadStoredItems(store ItemStore, session Session, debug bool) (items Items, err error) {
+	var ei EncryptedItems
+
+	ei, _, err = store.Load()
+	if err != nil {
+		return
+	}
+
+	var di DecryptedItems
+
+	di, err = ei.DecryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, debug)
+	if err != nil {
+		return
+	}
+
+	return di.Parse()
+}
@@ -0,0 +1,220 @@
+package gosn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingStore records the changes applied to the store it wraps
+type recordingStore struct {
+	ItemStore
+	applied []EncryptedItems
+}
+
+func (rs *recordingStore) Apply(items EncryptedItems, syncToken string) error {
+	rs.applied = append(rs.applied, items)
+
+	return rs.ItemStore.Apply(items, syncToken)
+}
+
+func TestMergeEncryptedItems(t *testing.T) {
+	existing := EncryptedItems{{UUID: "a", Content: "a1"}, {UUID: "b", Content: "b1"}, {UUID: "c", Content: "c1"}}
+	changes := EncryptedItems{{UUID: "d", Content: "d1"}, {UUID: "b", Deleted: true}, {UUID: "a", Content: "a2"},
+		{UUID: "e", Deleted: true}}
+
+	merged := mergeEncryptedItems(existing, changes)
+	assert.Equal(t, EncryptedItems{{UUID: "a", Content: "a2"}, {UUID: "c", Content: "c1"},
+		{UUID: "d", Content: "d1"}}, merged)
+}
+
+func TestFileItemStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosn-store")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	store := NewFileItemStore(filepath.Join(dir, "items.json"))
+
+	// missing file is an empty store
+	items, syncToken, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+	assert.Empty(t, syncToken)
+
+	one := createEncryptedTestNote(t, "one", "one", "")
+	two := createEncryptedTestNote(t, "two", "two", "")
+	assert.NoError(t, store.Apply(EncryptedItems{one, two}, "token-1"))
+
+	info, err := os.Stat(store.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	two.Deleted = true
+	assert.NoError(t, store.Apply(EncryptedItems{two}, "token-2"))
+
+	items, syncToken, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptedItems{one}, items)
+	assert.Equal(t, "token-2", syncToken)
+
+	notes, err := LoadStoredItems(store, Session{Mk: testSyncMk, Ak: testSyncAk}, false)
+	assert.NoError(t, err)
+	assert.Len(t, notes, 1)
+	assert.Equal(t, "one", notes[0].Content.GetTitle())
+}
+
+func TestFileItemStoreInvalidContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosn-store")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	store := NewFileItemStore(filepath.Join(dir, "items.json"))
+	assert.NoError(t, ioutil.WriteFile(store.Path, []byte("not json"), 0600))
+
+	_, _, err = store.Load()
+	assert.Error(t, err)
+}
+
+func TestSyncerUpdatesStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosn-store")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	store := NewFileItemStore(filepath.Join(dir, "items.json"))
+	existing := createEncryptedTestNote(t, "existing", "existing", "")
+	assert.NoError(t, store.Apply(EncryptedItems{existing}, "token-1"))
+
+	remote := createEncryptedTestNote(t, "remote", "remote", "")
+	local := createEncryptedTestNote(t, "local", "local", "")
+	deleted := existing
+	deleted.Deleted = true
+	deleted.Content = ""
+	deleted.EncItemKey = ""
+
+	var requests []syncRequest
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var req syncRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+
+		requests = append(requests, req)
+
+		var resp syncResponse
+
+		switch len(requests) {
+		case 1:
+			// saved items are returned without content
+			for _, item := range req.Items {
+				resp.SavedItems = append(resp.SavedItems, EncryptedItem{UUID: item.UUID,
+					ContentType: item.ContentType, UpdatedAt: "2020-01-02T03:04:05.000Z"})
+			}
+
+			resp.Items = EncryptedItems{remote}
+			resp.SyncToken = "token-2"
+			resp.CursorToken = "cursor-1"
+		default:
+			resp.Items = EncryptedItems{deleted}
+			resp.SyncToken = "token-3"
+		}
+
+		b, _ := json.Marshal(resp)
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	recorder := &recordingStore{ItemStore: store}
+
+	s := NewSyncer(Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003", Token: "token", Server: ts.URL})
+	s.Store = recorder
+	s.MarkDirty(local)
+
+	_, err = s.Sync()
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	// the store is written once, with the changes from both requests
+	assert.Len(t, recorder.applied, 1)
+	assert.Equal(t, "token-1", requests[0].SyncToken)
+	assert.Equal(t, "cursor-1", requests[1].CursorToken)
+
+	items, syncToken, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-3", syncToken)
+	assert.Len(t, items, 2)
+
+	notes, err := LoadStoredItems(store, s.Session, false)
+	assert.NoError(t, err)
+	assert.Len(t, notes, 2)
+	assert.Equal(t, "remote", notes[0].Content.GetTitle())
+	assert.Equal(t, "local", notes[1].Content.GetTitle())
+	assert.Equal(t, "2020-01-02T03:04:05.000Z", notes[1].UpdatedAt)
+}
+
+func TestGetItemsWithStore(t *testing.T) {
+	_, session := signInNewTestUser(t, "secret")
+
+	dir, err := ioutil.TempDir("", "gosn-store")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	store := &recordingStore{ItemStore: NewFileItemStore(filepath.Join(dir, "items.json"))}
+
+	notes := Items{*createNote("one", "one", ""), *createNote("two", "two", "")}
+	eNotes, err := notes.Encrypt(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eNotes})
+	assert.NoError(t, err)
+
+	// the notes and the default items key are retrieved and stored
+	out, err := GetItems(GetItemsInput{Session: session, Store: store})
+	assert.NoError(t, err)
+	assert.Len(t, out.Items, 3)
+	assert.Len(t, store.applied, 1)
+	assert.Len(t, store.applied[0], 3)
+
+	_, syncToken, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, out.SyncToken, syncToken)
+
+	deleted := eNotes[0]
+	deleted.Deleted = true
+	deleted.Content = ""
+	deleted.EncItemKey = ""
+
+	three := Items{*createNote("three", "three", "")}
+	eThree, err := three.Encrypt(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: append(eThree, deleted)})
+	assert.NoError(t, err)
+
+	// only the changes are retrieved, and the stored items, updated with them, are returned
+	out, err = GetItems(GetItemsInput{Session: session, Store: store})
+	assert.NoError(t, err)
+	assert.Len(t, store.applied, 2)
+	assert.Len(t, store.applied[1], 2)
+	assert.Len(t, out.Items, 3)
+
+	items, err := out.Items.DecryptAndParse(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+
+	var titles []string
+
+	for _, item := range items {
+		titles = append(titles, item.Content.GetTitle())
+	}
+
+	assert.ElementsMatch(t, []string{"two", "three"}, titles)
+}
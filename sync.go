@@ -0,0 +1,443 @@
+package gosn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	syncConflict = "sync_conflict" // item has been modified on the server since it was last retrieved
+	uuidConflict = "uuid_conflict" // item's UUID is in use by another account
+
+	maxStalledSyncRounds = 3 // maximum number of consecutive requests without progress made by a single sync
+)
+
+// Conflict describes an item the server refused to save
+type Conflict struct {
+	Type        string         `json:"type"`
+	ServerItem  *EncryptedItem `json:"server_item"`
+	UnsavedItem *EncryptedItem `json:"unsaved_item"`
+}
+
+// ConflictResolution describes how a conflict is to be resolved
+type ConflictResolution struct {
+	Apply EncryptedItems // items to apply locally, returned with the retrieved items
+	Dirty EncryptedItems // items to send to the server in the next request
+}
+
+// ConflictStrategy resolves a conflict returned by the server
+type ConflictStrategy func(c Conflict, session Session) (ConflictResolution, error)
+
+// ServerWins discards the local changes and applies the server's version
+// Items with UUID conflicts are duplicated, as they cannot be saved
+func ServerWins(c Conflict, session Session) (res ConflictResolution, err error) {
+	if c.Type == uuidConflict || c.ServerItem == nil {
+		return DuplicateConflicts(c, session)
+	}
+
+	res.Apply = EncryptedItems{*c.ServerItem}
+
+	return
+}
+
+// ClientWins overwrites the server's version with the local changes
+// Items with UUID conflicts are duplicated, as they cannot be saved
+func ClientWins(c Conflict, session Session) (res ConflictResolution, err error) {
+	if c.Type == uuidConflict || c.ServerItem == nil || c.UnsavedItem == nil {
+		return DuplicateConflicts(c, session)
+	}
+
+	item := *c.UnsavedItem
+	// the server accepts changes to the version it holds
+	item.UpdatedAt = c.ServerItem.UpdatedAt
+	res.Dirty = EncryptedItems{item}
+
+	return
+}
+
+// DuplicateConflicts applies the server's version and saves the local changes as a new
+// item that references the original with "conflict_of", as done by the official apps
+func DuplicateConflicts(c Conflict, session Session) (res ConflictResolution, err error) {
+	if c.ServerItem != nil {
+		res.Apply = EncryptedItems{*c.ServerItem}
+	}
+
+	if c.UnsavedItem == nil || c.UnsavedItem.Deleted {
+		return
+	}
+
+	var dupe EncryptedItem
+
+	dupe, err = duplicateItem(*c.UnsavedItem, session)
+	if err != nil {
+		return
+	}
+
+	res.Dirty = EncryptedItems{dupe}
+
+	return
+}
+
+// duplicateItem returns a copy of the item with a new UUID and its content referencing the original
+func duplicateItem(eItem EncryptedItem, session Session) (dupe EncryptedItem, err error) {
+	var di DecryptedItems
+
+	di, err = EncryptedItems{eItem}.DecryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, false)
+	if err != nil {
+		return
+	}
+
+	var content map[string]interface{}
+
+	err = json.Unmarshal([]byte(di[0].Content), &content)
+	if err != nil {
+		return
+	}
+
+	content["conflict_of"] = eItem.UUID
+
+	var mContent []byte
+
+	mContent, err = json.Marshal(content)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC().Format(timeLayout)
+
+	dupe.UUID = GenUUID()
+	dupe.ContentType = eItem.ContentType
+	dupe.CreatedAt = now
+	dupe.UpdatedAt = now
+
+	var key, authKey, keyVersion string
+
+	key, authKey, keyVersion, dupe.ItemsKeyID, err = session.ItemsKeys.keysForItem(
+		Item{UUID: dupe.UUID, ItemsKeyID: eItem.ItemsKeyID}, session.Mk, session.Ak, session.Version)
+	if err != nil {
+		return
+	}
+
+	dupe.Content, dupe.EncItemKey, err = encryptContent(string(mContent), keyVersion, key, authKey, dupe.UUID)
+
+	return dupe, err
+}
+
+// Syncer performs two-way syncs, sending dirty items and retrieving remote changes in the same requests
+// The sync and cursor tokens are retained between syncs so that only changes are retrieved
+type Syncer struct {
+	Session     Session
+	SyncToken   string
+	CursorToken string
+	Strategy    ConflictStrategy // defaults to DuplicateConflicts
+	PageSize    int              // override default number of items to send and retrieve with each request
+	Store       ItemStore        // optional store updated with the changes retrieved once each sync ends
+	Client      *Client          // client used to make requests, defaults to the package's client
+	Debug       bool
+	dirty       EncryptedItems
+}
+
+// SyncOutput defines the output from a sync
+type SyncOutput struct {
+	Items      EncryptedItems // items new or modified on the server, plus any applied to resolve conflicts
+	SavedItems EncryptedItems // dirty items saved by the server
+	Unsaved    EncryptedItems // dirty items the server refused to save, left dirty to be sent by the next sync
+	Conflicts  []Conflict     // conflicts returned by the server and resolved using the strategy
+	SyncToken  string
+}
+
+type syncRequest struct {
+	Items       EncryptedItems `json:"items"`
+	SyncToken   string         `json:"sync_token,omitempty"`
+	CursorToken string         `json:"cursor_token,omitempty"`
+	Limit       int            `json:"limit"`
+	API         string         `json:"api"`
+}
+
+// NewSyncer returns a Syncer for the session
+func NewSyncer(session Session) *Syncer {
+	return defaultClient.NewSyncer(session)
+}
+
+// NewSyncer returns a Syncer for the session that makes requests using the client
+func (c *Client) NewSyncer(session Session) *Syncer {
+	return &Syncer{
+		Session:  session,
+		Strategy: DuplicateConflicts,
+		Client:   c,
+	}
+}
+
+// MarkDirty queues items to be sent with the next sync, replacing any queued with the same UUID
+func (s *Syncer) MarkDirty(items ...EncryptedItem) {
+	for _, item := range items {
+		var queued EncryptedItems
+
+		for _, d := range s.dirty {
+			if d.UUID != item.UUID {
+				queued = append(queued, d)
+			}
+		}
+
+		s.dirty = append(queued, item)
+	}
+}
+
+// Dirty returns the items waiting to be sent
+func (s *Syncer) Dirty() EncryptedItems {
+	return append(EncryptedItems{}, s.dirty...)
+}
+
+// Sync sends dirty items and retrieves changes until there is nothing left to send or retrieve
+func (s *Syncer) Sync() (output SyncOutput, err error) {
+	return s.SyncWithContext(context.Background())
+}
+
+// SyncWithContext is Sync with a context that can cancel the requests made
+// If the context is cancelled, then the progress made is returned and retained by the Syncer,
+// with unsent items left dirty, so that a subsequent sync resumes where it stopped
+func (s *Syncer) SyncWithContext(ctx context.Context) (output SyncOutput, err error) {
+	if !s.Session.Valid() {
+		err = ErrSessionInvalid
+		return
+	}
+
+	strategy := s.Strategy
+	if strategy == nil {
+		strategy = DuplicateConflicts
+	}
+
+	limit := PageSize
+	if s.PageSize > 0 {
+		limit = s.PageSize
+	}
+
+	batchSize := limit
+
+	// the stored token is only updated once all pages have been retrieved
+	var storedToken string
+
+	// changes retrieved by each request, to be applied to the store
+	var stored EncryptedItems
+
+	if s.Store != nil {
+		_, storedToken, err = s.Store.Load()
+		if err != nil {
+			return
+		}
+
+		if s.SyncToken == "" && s.CursorToken == "" {
+			s.SyncToken = storedToken
+		}
+
+		// the changes from each request are collected and applied to the store once the sync ends,
+		// including any made before it failed or was cancelled
+		loadedToken := storedToken
+
+		defer func() {
+			if len(stored) == 0 && storedToken == loadedToken {
+				return
+			}
+
+			if sErr := s.Store.Apply(stored, storedToken); sErr != nil && err == nil {
+				err = fmt.Errorf("failed to update item store: %+v", sErr)
+			}
+		}()
+	}
+
+	// items the server refuses to save are queued again once the sync ends, rather than resent by it
+	var unsaved EncryptedItems
+
+	defer func() {
+		s.requeue(unsaved)
+	}()
+
+	for round, stalled := 1, 0; ; round++ {
+		if err = ctx.Err(); err != nil {
+			output.SyncToken = s.SyncToken
+			return
+		}
+
+		if batchSize > len(s.dirty) {
+			batchSize = len(s.dirty)
+		}
+
+		batch := append(EncryptedItems{}, s.dirty[:batchSize]...)
+
+		if err = batch.checkNotEncryptedWith001Keys(s.Session); err != nil {
+			return
+		}
+
+		s.client().debugPrint(s.Debug, fmt.Sprintf("Sync | round %d sending %d of %d dirty items", round, len(batch), len(s.dirty)))
+
+		var resp syncResponse
+
+		resp, err = s.syncRequest(ctx, batch, limit)
+		if err != nil {
+			if ctx.Err() != nil {
+				output.SyncToken = s.SyncToken
+				err = ctx.Err()
+
+				return
+			}
+
+			if errors.Is(err, ErrPayloadTooLarge) && batchSize > 1 {
+				s.client().debugPrint(s.Debug, fmt.Sprintf("Sync | %s so reducing batch from %d items", err.Error(), batchSize))
+				batchSize /= 2
+				err = nil
+
+				continue
+			}
+
+			return
+		}
+
+		// a round makes progress if it saves or retrieves items, or moves to the next page
+		stalled++
+		if len(resp.SavedItems) > 0 || len(resp.Items) > 0 || resp.CursorToken != s.CursorToken {
+			stalled = 0
+		}
+
+		if stalled >= maxStalledSyncRounds {
+			err = fmt.Errorf("sync incomplete after %d requests without progress", stalled)
+			return
+		}
+
+		changes := append(EncryptedItems{}, resp.Items...)
+		changes = append(changes, savedItemsWithContent(batch, resp.SavedItems)...)
+
+		var applied, dirty EncryptedItems
+
+		for _, c := range resp.Conflicts {
+			s.client().debugPrint(s.Debug, fmt.Sprintf("Sync | resolving %s", c.Type))
+
+			var res ConflictResolution
+
+			res, err = strategy(c, s.Session)
+			if err != nil {
+				return
+			}
+
+			applied = append(applied, res.Apply...)
+			dirty = append(dirty, res.Dirty...)
+		}
+
+		changes = append(changes, applied...)
+
+		var retrievedItemsKeys ItemsKeys
+
+		retrievedItemsKeys, err = resp.Items.DecryptItemsKeys(s.Session.Mk, s.Session.Ak)
+		if err != nil {
+			return
+		}
+
+		if s.Store != nil {
+			stored = append(stored, changes...)
+
+			if resp.CursorToken == "" {
+				storedToken = resp.SyncToken
+			}
+		}
+
+		// the round has succeeded, so the batch is no longer dirty
+		s.dirty = s.dirty[len(batch):]
+		s.MarkDirty(dirty...)
+		batchSize = limit
+
+		if len(resp.Unsaved) > 0 {
+			s.client().debugPrint(s.Debug, fmt.Sprintf("Sync | %d items not saved", len(resp.Unsaved)))
+			unsaved = append(unsaved, resp.Unsaved...)
+		}
+
+		output.Items = append(output.Items, resp.Items...)
+		output.Items = append(output.Items, applied...)
+		output.SavedItems = append(output.SavedItems, resp.SavedItems...)
+		output.Unsaved = append(output.Unsaved, resp.Unsaved...)
+		output.Conflicts = append(output.Conflicts, resp.Conflicts...)
+
+		s.Session.ItemsKeys = mergeItemsKeys(s.Session.ItemsKeys, retrievedItemsKeys)
+		s.SyncToken = resp.SyncToken
+		s.CursorToken = resp.CursorToken
+
+		if len(s.dirty) == 0 && s.CursorToken == "" {
+			break
+		}
+	}
+
+	output.SyncToken = s.SyncToken
+
+	return output, err
+}
+
+// requeue marks the items dirty, unless a newer version of an item is already waiting to be sent
+func (s *Syncer) requeue(items EncryptedItems) {
+	for _, item := range items {
+		queued := false
+
+		for _, d := range s.dirty {
+			if d.UUID == item.UUID {
+				queued = true
+				break
+			}
+		}
+
+		if !queued {
+			s.dirty = append(s.dirty, item)
+		}
+	}
+}
+
+// savedItemsWithContent returns the saved items with any content omitted by the server taken from the items sent
+func savedItemsWithContent(sent, saved EncryptedItems) (items EncryptedItems) {
+	for _, si := range saved {
+		if si.Content == "" && !si.Deleted {
+			for _, item := range sent {
+				if item.UUID == si.UUID {
+					item.UpdatedAt = si.UpdatedAt
+					si = item
+
+					break
+				}
+			}
+		}
+
+		items = append(items, si)
+	}
+
+	return items
+}
+
+func (s *Syncer) client() *Client {
+	if s.Client == nil {
+		return defaultClient
+	}
+
+	return s.Client
+}
+
+func (s *Syncer) syncRequest(ctx context.Context, items EncryptedItems, limit int) (resp syncResponse, err error) {
+	var reqBody []byte
+
+	reqBody, err = json.Marshal(syncRequest{
+		Items:       items,
+		SyncToken:   s.SyncToken,
+		CursorToken: s.CursorToken,
+		Limit:       limit,
+		API:         syncAPIVersion,
+	})
+	if err != nil {
+		return
+	}
+
+	var respBody []byte
+
+	respBody, err = s.client().makeSyncRequest(ctx, s.Session, reqBody, s.Debug)
+	if err != nil {
+		return
+	}
+
+	return getBodyContent(respBody)
+}
@@ -0,0 +1,333 @@
+package gosn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testSyncMk = "8b82accf2bae6b1f1183d5398dc46bbb8bc71f019c43e105fef21846ffe7b6be"
+	testSyncAk = "aca431d6fc360e46e853e19d70afec26e4825e2609c2e6df9f4431cbd344e1bc"
+)
+
+func createEncryptedTestNote(t *testing.T, title, text, uuid string) EncryptedItem {
+	note := createNote(title, text, uuid)
+	notes := Items{*note}
+	eNotes, err := notes.Encrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+
+	return eNotes[0]
+}
+
+func TestServerWins(t *testing.T) {
+	server := createEncryptedTestNote(t, "server", "server", "")
+	local := createEncryptedTestNote(t, "local", "local", server.UUID)
+
+	res, err := ServerWins(Conflict{Type: syncConflict, ServerItem: &server, UnsavedItem: &local},
+		Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003"})
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptedItems{server}, res.Apply)
+	assert.Empty(t, res.Dirty)
+}
+
+func TestClientWins(t *testing.T) {
+	server := createEncryptedTestNote(t, "server", "server", "")
+	server.UpdatedAt = "2020-01-02T03:04:05.000Z"
+	local := createEncryptedTestNote(t, "local", "local", server.UUID)
+
+	res, err := ClientWins(Conflict{Type: syncConflict, ServerItem: &server, UnsavedItem: &local},
+		Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003"})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Apply)
+	assert.Len(t, res.Dirty, 1)
+	assert.Equal(t, local.Content, res.Dirty[0].Content)
+	assert.Equal(t, server.UpdatedAt, res.Dirty[0].UpdatedAt)
+}
+
+func TestDuplicateConflicts(t *testing.T) {
+	server := createEncryptedTestNote(t, "server", "server", "")
+	local := createEncryptedTestNote(t, "local", "local", server.UUID)
+
+	res, err := DuplicateConflicts(Conflict{Type: syncConflict, ServerItem: &server, UnsavedItem: &local},
+		Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003"})
+	assert.NoError(t, err)
+	assert.Equal(t, EncryptedItems{server}, res.Apply)
+	assert.Len(t, res.Dirty, 1)
+	assert.NotEqual(t, local.UUID, res.Dirty[0].UUID)
+
+	di, err := res.Dirty.Decrypt(testSyncMk, testSyncAk, false)
+	assert.NoError(t, err)
+
+	var content map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(di[0].Content), &content))
+	assert.Equal(t, local.UUID, content["conflict_of"])
+	assert.Equal(t, "local", content["title"])
+}
+
+func TestSyncerMarkDirty(t *testing.T) {
+	s := NewSyncer(Session{})
+	one := createEncryptedTestNote(t, "one", "one", "")
+	two := createEncryptedTestNote(t, "two", "two", "")
+	s.MarkDirty(one, two)
+	one.Deleted = true
+	s.MarkDirty(one)
+	assert.Len(t, s.Dirty(), 2)
+	assert.True(t, s.Dirty()[1].Deleted)
+}
+
+func TestSyncerSyncResolvesConflicts(t *testing.T) {
+	serverItem := createEncryptedTestNote(t, "server", "server", "")
+	local := createEncryptedTestNote(t, "local", "local", serverItem.UUID)
+
+	var requests []syncRequest
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var req syncRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+
+		requests = append(requests, req)
+
+		var resp syncResponse
+
+		switch len(requests) {
+		case 1:
+			// reject the local change
+			resp.Conflicts = []Conflict{{Type: syncConflict, ServerItem: &serverItem, UnsavedItem: &req.Items[0]}}
+			resp.SyncToken = "token-1"
+		default:
+			resp.SavedItems = req.Items
+			resp.SyncToken = "token-2"
+		}
+
+		b, _ := json.Marshal(resp)
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	s := NewSyncer(Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003", Token: "token", Server: ts.URL})
+	s.MarkDirty(local)
+
+	out, err := s.Sync()
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, syncAPIVersion, requests[0].API)
+	assert.Equal(t, "token-1", requests[1].SyncToken)
+	assert.Len(t, out.Conflicts, 1)
+	assert.Equal(t, EncryptedItems{serverItem}, out.Items)
+	assert.Len(t, out.SavedItems, 1)
+	assert.NotEqual(t, local.UUID, out.SavedItems[0].UUID)
+	assert.Equal(t, "token-2", out.SyncToken)
+	assert.Equal(t, "token-2", s.SyncToken)
+	assert.Empty(t, s.Dirty())
+}
+
+func TestSyncerSyncRequeuesUnsavedItems(t *testing.T) {
+	local := createEncryptedTestNote(t, "local", "local", "")
+
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+
+		requests++
+
+		// the legacy sync API returns each unsaved item with the error preventing it being saved
+		item, _ := json.Marshal(local)
+		_, _ = fmt.Fprintf(w, `{"unsaved":[{"item":%s,"error":{"tag":"sync_conflict"}}],"sync_token":"token-1"}`, item)
+	}))
+	defer ts.Close()
+
+	s := NewSyncer(Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003", Token: "token", Server: ts.URL})
+	s.MarkDirty(local)
+
+	out, err := s.Sync()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, EncryptedItems{local}, out.Unsaved)
+	assert.Equal(t, EncryptedItems{local}, s.Dirty())
+}
+
+func TestSyncerSyncKeepsBatchDirtyOnFailure(t *testing.T) {
+	serverItem := createEncryptedTestNote(t, "server", "server", "")
+	local := createEncryptedTestNote(t, "local", "local", serverItem.UUID)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var req syncRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+
+		b, _ := json.Marshal(syncResponse{
+			Conflicts: []Conflict{{Type: syncConflict, ServerItem: &serverItem, UnsavedItem: &req.Items[0]}},
+			SyncToken: "token-1",
+		})
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	s := NewSyncer(Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003", Token: "token", Server: ts.URL})
+	s.Strategy = func(c Conflict, session Session) (ConflictResolution, error) {
+		return ConflictResolution{}, errors.New("unresolved")
+	}
+	s.MarkDirty(local)
+
+	_, err := s.Sync()
+	assert.EqualError(t, err, "unresolved")
+	assert.Equal(t, EncryptedItems{local}, s.Dirty())
+	assert.Empty(t, s.SyncToken)
+}
+
+func TestSyncerSyncPages(t *testing.T) {
+	const pages = 60
+
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+
+		requests++
+
+		resp := syncResponse{
+			Items:     EncryptedItems{createEncryptedTestNote(t, "page", "page", "")},
+			SyncToken: "token",
+		}
+
+		if requests < pages {
+			resp.CursorToken = fmt.Sprintf("cursor-%d", requests)
+		}
+
+		b, _ := json.Marshal(resp)
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	s := NewSyncer(Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003", Token: "token", Server: ts.URL})
+
+	out, err := s.Sync()
+	assert.NoError(t, err)
+	assert.Equal(t, pages, requests)
+	assert.Len(t, out.Items, pages)
+}
+
+func TestSyncerSyncStalled(t *testing.T) {
+	requests := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+
+		requests++
+
+		// the same cursor is returned without any items
+		b, _ := json.Marshal(syncResponse{SyncToken: "token", CursorToken: "cursor"})
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+
+	s := NewSyncer(Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003", Token: "token", Server: ts.URL})
+
+	_, err := s.Sync()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "without progress")
+	// the first request moves to the cursor, so is progress
+	assert.Equal(t, maxStalledSyncRounds+1, requests)
+}
+
+func TestSyncerSyncWithContextCancelled(t *testing.T) {
+	local := createEncryptedTestNote(t, "local", "local", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	s := NewSyncer(Session{Mk: testSyncMk, Ak: testSyncAk, Version: "003", Token: "token", Server: ts.URL})
+	s.SyncToken = "token-1"
+	s.MarkDirty(local)
+
+	out, err := s.SyncWithContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, "token-1", out.SyncToken)
+	// unsent items remain dirty so that the next sync resumes
+	assert.Equal(t, EncryptedItems{local}, s.Dirty())
+}
+
+func TestSyncerDuplicatesConflictsWithServer(t *testing.T) {
+	email, session := signInNewTestUser(t, "secret")
+
+	first := NewSyncer(session)
+	second := NewSyncer(session)
+
+	note := createNote("original", "original", "")
+	notes := Items{*note}
+	eNotes, err := notes.Encrypt(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+
+	first.MarkDirty(eNotes...)
+	_, err = first.Sync()
+	assert.NoError(t, err)
+
+	out, err := second.Sync()
+	assert.NoError(t, err)
+	// the note and the default items key created on sign-in
+	assert.Len(t, out.Items, 2)
+
+	// both change the same note, with the first to sync winning
+	items, err := out.Items.DecryptAndParse(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	firstChange := items[0]
+	firstChange.Content.SetTitle("first")
+	secondChange := *items[0].Copy()
+	secondChange.Content.SetTitle("second")
+
+	firstChanges := Items{firstChange}
+	eFirst, err := firstChanges.Encrypt(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+	first.MarkDirty(eFirst...)
+	_, err = first.Sync()
+	assert.NoError(t, err)
+
+	secondChanges := Items{secondChange}
+	eSecond, err := secondChanges.Encrypt(session.Mk, session.Ak, false)
+	assert.NoError(t, err)
+	second.MarkDirty(eSecond...)
+	out, err = second.Sync()
+	assert.NoError(t, err)
+	assert.Len(t, out.Conflicts, 1)
+	assert.Len(t, out.SavedItems, 1)
+	assert.NotEqual(t, note.UUID, out.SavedItems[0].UUID)
+
+	var titles []string
+
+	for _, si := range testServer.Items(email) {
+		if si.ContentType == itemsKeyContentType {
+			continue
+		}
+
+		di, err := EncryptedItems{{UUID: si.UUID, Content: si.Content, ContentType: si.ContentType,
+			EncItemKey: si.EncItemKey, CreatedAt: si.CreatedAt, UpdatedAt: si.UpdatedAt}}.DecryptAndParse(
+			session.Mk, session.Ak, false)
+		assert.NoError(t, err)
+
+		titles = append(titles, di[0].Content.GetTitle())
+	}
+
+	assert.ElementsMatch(t, []string{"first", "second"}, titles)
+}
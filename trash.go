@@ -0,0 +1,326 @@
+package gosn
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TrashInput defines the input for moving notes to and from the trash and permanently deleting them
+type TrashInput struct {
+	Session Session
+	Notes   Items
+	Debug   bool
+}
+
+// TrashOutput defines the output from moving notes to and from the trash and permanently deleting them
+type TrashOutput struct {
+	Notes Items // notes as put
+	Tags  Items // tags put with references to the deleted notes removed
+}
+
+// TrashNotes moves the notes to the trash by setting their trashed flag and putting them
+func TrashNotes(input TrashInput) (output TrashOutput, err error) {
+	return defaultClient.TrashNotesWithContext(context.Background(), input)
+}
+
+// TrashNotesWithContext is TrashNotes with a context that can cancel the request made
+func TrashNotesWithContext(ctx context.Context, input TrashInput) (output TrashOutput, err error) {
+	return defaultClient.TrashNotesWithContext(ctx, input)
+}
+
+// TrashNotes moves the notes to the trash by setting their trashed flag and putting them
+func (c *Client) TrashNotes(input TrashInput) (output TrashOutput, err error) {
+	return c.TrashNotesWithContext(context.Background(), input)
+}
+
+// TrashNotesWithContext is TrashNotes with a context that can cancel the request made
+func (c *Client) TrashNotesWithContext(ctx context.Context, input TrashInput) (output TrashOutput, err error) {
+	output.Notes, err = setNotesTrashed(input.Notes, true)
+	if err != nil {
+		return
+	}
+
+	c.debugPrint(input.Debug, fmt.Sprintf("TrashNotes | trashing %d notes", len(output.Notes)))
+
+	err = c.putDecryptedItems(ctx, input.Session, output.Notes, input.Debug)
+
+	return
+}
+
+// RestoreNotes restores the notes from the trash by clearing their trashed flag and putting them
+func RestoreNotes(input TrashInput) (output TrashOutput, err error) {
+	return defaultClient.RestoreNotesWithContext(context.Background(), input)
+}
+
+// RestoreNotesWithContext is RestoreNotes with a context that can cancel the request made
+func RestoreNotesWithContext(ctx context.Context, input TrashInput) (output TrashOutput, err error) {
+	return defaultClient.RestoreNotesWithContext(ctx, input)
+}
+
+// RestoreNotes restores the notes from the trash by clearing their trashed flag and putting them
+func (c *Client) RestoreNotes(input TrashInput) (output TrashOutput, err error) {
+	return c.RestoreNotesWithContext(context.Background(), input)
+}
+
+// RestoreNotesWithContext is RestoreNotes with a context that can cancel the request made
+func (c *Client) RestoreNotesWithContext(ctx context.Context, input TrashInput) (output TrashOutput, err error) {
+	output.Notes, err = setNotesTrashed(input.Notes, false)
+	if err != nil {
+		return
+	}
+
+	c.debugPrint(input.Debug, fmt.Sprintf("RestoreNotes | restoring %d notes", len(output.Notes)))
+
+	err = c.putDecryptedItems(ctx, input.Session, output.Notes, input.Debug)
+
+	return
+}
+
+// DeleteNotes permanently deletes the notes, whether trashed or not, by putting them with their content
+// cleared and the deleted flag set, and removes the references tags hold to them
+func DeleteNotes(input TrashInput) (output TrashOutput, err error) {
+	return defaultClient.DeleteNotesWithContext(context.Background(), input)
+}
+
+// DeleteNotesWithContext is DeleteNotes with a context that can cancel the request made
+func DeleteNotesWithContext(ctx context.Context, input TrashInput) (output TrashOutput, err error) {
+	return defaultClient.DeleteNotesWithContext(ctx, input)
+}
+
+// DeleteNotes permanently deletes the notes, whether trashed or not, by putting them with their content
+// cleared and the deleted flag set, and removes the references tags hold to them
+func (c *Client) DeleteNotes(input TrashInput) (output TrashOutput, err error) {
+	return c.DeleteNotesWithContext(context.Background(), input)
+}
+
+// DeleteNotesWithContext is DeleteNotes with a context that can cancel the requests made
+func (c *Client) DeleteNotesWithContext(ctx context.Context, input TrashInput) (output TrashOutput, err error) {
+	for _, note := range input.Notes {
+		if note.ContentType != "Note" {
+			return output, fmt.Errorf("item %s is not a note", note.UUID)
+		}
+	}
+
+	var items Items
+
+	items, err = c.getParsedItems(ctx, &input.Session, input.Debug)
+	if err != nil {
+		return
+	}
+
+	return c.deleteNotes(ctx, input, items)
+}
+
+// deleteNotes permanently deletes the notes, which must be notes, and removes the references the tags held in items hold to them
+func (c *Client) deleteNotes(ctx context.Context, input TrashInput, items Items) (output TrashOutput, err error) {
+	deleted := make(map[string]bool, len(input.Notes))
+
+	for _, note := range input.Notes {
+		note.Content = NewNoteContent()
+		note.RawContent = nil
+		note.ContentSize = 0
+		note.Deleted = true
+
+		output.Notes = append(output.Notes, note)
+		deleted[note.UUID] = true
+	}
+
+	c.debugPrint(input.Debug, fmt.Sprintf("DeleteNotes | deleting %d notes", len(output.Notes)))
+
+	err = c.putDecryptedItems(ctx, input.Session, output.Notes, input.Debug)
+	if err != nil {
+		return
+	}
+
+	for _, tag := range items {
+		if tag.ContentType != "Tag" || tag.Content == nil {
+			continue
+		}
+
+		var refs ItemReferences
+
+		for _, ref := range tag.Content.References() {
+			if !deleted[ref.UUID] {
+				refs = append(refs, ref)
+			}
+		}
+
+		if len(refs) == len(tag.Content.References()) {
+			continue
+		}
+
+		if refs == nil {
+			refs = ItemReferences{}
+		}
+
+		tag.Content.SetReferences(refs)
+		tag.Content.SetUpdateTime(time.Now().UTC())
+
+		output.Tags = append(output.Tags, tag)
+	}
+
+	c.debugPrint(input.Debug, fmt.Sprintf("DeleteNotes | removing references from %d tags", len(output.Tags)))
+
+	err = c.putDecryptedItems(ctx, input.Session, output.Tags, input.Debug)
+
+	return
+}
+
+// GetTrashedNotes retrieves the session's items and returns the notes in the trash
+func GetTrashedNotes(session Session, debug bool) (Items, error) {
+	return defaultClient.GetTrashedNotesWithContext(context.Background(), session, debug)
+}
+
+// GetTrashedNotesWithContext is GetTrashedNotes with a context that can cancel the requests made
+func GetTrashedNotesWithContext(ctx context.Context, session Session, debug bool) (Items, error) {
+	return defaultClient.GetTrashedNotesWithContext(ctx, session, debug)
+}
+
+// GetTrashedNotes retrieves the session's items and returns the notes in the trash
+func (c *Client) GetTrashedNotes(session Session, debug bool) (Items, error) {
+	return c.GetTrashedNotesWithContext(context.Background(), session, debug)
+}
+
+// GetTrashedNotesWithContext is GetTrashedNotes with a context that can cancel the requests made
+func (c *Client) GetTrashedNotesWithContext(ctx context.Context, session Session, debug bool) (trashed Items, err error) {
+	var items Items
+
+	items, err = c.getParsedItems(ctx, &session, debug)
+	if err != nil {
+		return
+	}
+
+	return TrashedNotes(items), err
+}
+
+// EmptyTrash permanently deletes every note in the trash and removes the references tags hold to them
+func EmptyTrash(session Session, debug bool) (output TrashOutput, err error) {
+	return defaultClient.EmptyTrashWithContext(context.Background(), session, debug)
+}
+
+// EmptyTrashWithContext is EmptyTrash with a context that can cancel the requests made
+func EmptyTrashWithContext(ctx context.Context, session Session, debug bool) (output TrashOutput, err error) {
+	return defaultClient.EmptyTrashWithContext(ctx, session, debug)
+}
+
+// EmptyTrash permanently deletes every note in the trash and removes the references tags hold to them
+func (c *Client) EmptyTrash(session Session, debug bool) (output TrashOutput, err error) {
+	return c.EmptyTrashWithContext(context.Background(), session, debug)
+}
+
+// EmptyTrashWithContext is EmptyTrash with a context that can cancel the requests made
+func (c *Client) EmptyTrashWithContext(ctx context.Context, session Session, debug bool) (output TrashOutput, err error) {
+	var items Items
+
+	items, err = c.getParsedItems(ctx, &session, debug)
+	if err != nil {
+		return
+	}
+
+	trashed := TrashedNotes(items)
+	if len(trashed) == 0 {
+		return
+	}
+
+	return c.deleteNotes(ctx, TrashInput{
+		Session: session,
+		Notes:   trashed,
+		Debug:   debug,
+	}, items)
+}
+
+// TrashedNotes returns the notes in the trash
+func TrashedNotes(items Items) (trashed Items) {
+	for _, item := range items {
+		if item.ContentType == "Note" && !item.Deleted && isTrashed(item.Content) {
+			trashed = append(trashed, item)
+		}
+	}
+
+	return
+}
+
+// setNotesTrashed returns copies of the notes with their trashed flag and update time set
+func setNotesTrashed(notes Items, trashed bool) (updated Items, err error) {
+	for _, note := range notes {
+		// copy the content so the caller's notes are unchanged
+		nc, ok := note.Content.(*NoteContent)
+		if !ok || note.ContentType != "Note" {
+			return nil, fmt.Errorf("item %s is not a note with content", note.UUID)
+		}
+
+		c := *nc
+		c.SetTrashed(trashed)
+		c.SetUpdateTime(time.Now().UTC())
+		note.Content = &c
+
+		updated = append(updated, note)
+	}
+
+	return
+}
+
+// getParsedItems retrieves, decrypts and parses the session's items, excluding any deleted
+// The items keys retrieved are added to the session, so that items put with it are encrypted with them
+func (c *Client) getParsedItems(ctx context.Context, session *Session, debug bool) (items Items, err error) {
+	var output GetItemsOutput
+
+	output, err = c.GetItemsWithContext(ctx, GetItemsInput{
+		Session: *session,
+		Debug:   debug,
+	})
+	if err != nil {
+		return
+	}
+
+	session.ItemsKeys = output.ItemsKeys
+
+	output.Items.RemoveDeleted()
+
+	var di DecryptedItems
+
+	di, err = output.Items.DecryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, debug)
+	if err != nil {
+		return
+	}
+
+	return di.Parse()
+}
+
+// putDecryptedItems encrypts the items with the session's keys and puts them
+// If the session holds no items keys, such as one loaded from a store, then they are retrieved first
+func (c *Client) putDecryptedItems(ctx context.Context, session Session, items Items, debug bool) (err error) {
+	if len(items) == 0 {
+		return
+	}
+
+	if len(session.ItemsKeys) == 0 && !isLegacyVersion(session.Version) {
+		var output GetItemsOutput
+
+		output, err = c.GetItemsWithContext(ctx, GetItemsInput{
+			Session: session,
+			Debug:   debug,
+		})
+		if err != nil {
+			return
+		}
+
+		session.ItemsKeys = output.ItemsKeys
+	}
+
+	var eItems EncryptedItems
+
+	eItems, err = items.EncryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, debug)
+	if err != nil {
+		return
+	}
+
+	_, err = c.PutItemsWithContext(ctx, PutItemsInput{
+		Session: session,
+		Items:   eItems,
+		Debug:   debug,
+	})
+
+	return err
+}
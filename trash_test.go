@@ -0,0 +1,169 @@
+package gosn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashRestoreAndEmptyTrash(t *testing.T) {
+	_, session := signInNewTestUser(t, "secret")
+
+	kept := createNote("kept", "kept", "")
+	binned := createNote("binned", "binned", "")
+	tag := createTag("tag", "")
+	tag = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*tag}, ToRef: Items{*kept, *binned}}).Items[0]
+
+	items := Items{*kept, *binned, *tag}
+	eItems, err := items.EncryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eItems})
+	assert.NoError(t, err)
+
+	out, err := TrashNotes(TrashInput{Session: session, Notes: Items{*binned}})
+	assert.NoError(t, err)
+	assert.Len(t, out.Notes, 1)
+	assert.True(t, out.Notes[0].Content.(*NoteContent).IsTrashed())
+	assert.False(t, binned.Content.(*NoteContent).IsTrashed())
+
+	trashed, err := GetTrashedNotes(session, false)
+	assert.NoError(t, err)
+	assert.Len(t, trashed, 1)
+	assert.Equal(t, binned.UUID, trashed[0].UUID)
+
+	_, err = RestoreNotes(TrashInput{Session: session, Notes: trashed})
+	assert.NoError(t, err)
+
+	trashed, err = GetTrashedNotes(session, false)
+	assert.NoError(t, err)
+	assert.Empty(t, trashed)
+
+	_, err = TrashNotes(TrashInput{Session: session, Notes: Items{*binned}})
+	assert.NoError(t, err)
+
+	out, err = EmptyTrash(session, false)
+	assert.NoError(t, err)
+	assert.Len(t, out.Notes, 1)
+	assert.True(t, out.Notes[0].Deleted)
+	assert.Empty(t, out.Notes[0].Content.GetTitle())
+	assert.Len(t, out.Tags, 1)
+
+	remaining, err := defaultClient.getParsedItems(context.Background(), &session, false)
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 2)
+
+	for _, item := range remaining {
+		assert.NotEqual(t, binned.UUID, item.UUID)
+
+		if item.ContentType == "Tag" {
+			assert.Equal(t, ItemReferences{{UUID: kept.UUID, ContentType: "Note"}}, item.Content.References())
+		}
+	}
+
+	out, err = EmptyTrash(session, false)
+	assert.NoError(t, err)
+	assert.Empty(t, out.Notes)
+}
+
+func TestDeleteNotesRemovesTagReferences(t *testing.T) {
+	_, session := signInNewTestUser(t, "secret")
+
+	kept := createNote("kept", "kept", "")
+	deleted := createNote("deleted", "deleted", "")
+	tag := createTag("tag", "")
+	tag = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*tag}, ToRef: Items{*kept, *deleted}}).Items[0]
+	other := createTag("other", "")
+
+	items := Items{*kept, *deleted, *tag, *other}
+	eItems, err := items.EncryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eItems})
+	assert.NoError(t, err)
+
+	out, err := DeleteNotes(TrashInput{Session: session, Notes: Items{*deleted}})
+	assert.NoError(t, err)
+	assert.Len(t, out.Notes, 1)
+	assert.True(t, out.Notes[0].Deleted)
+	assert.Len(t, out.Tags, 1)
+	assert.Equal(t, tag.UUID, out.Tags[0].UUID)
+
+	remaining, err := defaultClient.getParsedItems(context.Background(), &session, false)
+	assert.NoError(t, err)
+
+	for _, item := range remaining {
+		assert.NotEqual(t, deleted.UUID, item.UUID)
+
+		if item.UUID == tag.UUID {
+			assert.Equal(t, ItemReferences{{UUID: kept.UUID, ContentType: "Note"}}, item.Content.References())
+		}
+	}
+}
+
+func TestTrashNotesRequiresNotes(t *testing.T) {
+	_, err := TrashNotes(TrashInput{Notes: Items{*createTag("tag", "")}})
+	assert.Error(t, err)
+
+	_, err = DeleteNotes(TrashInput{Notes: Items{*createTag("tag", "")}})
+	assert.Error(t, err)
+}
+
+func TestTrashedNotesAndFilter(t *testing.T) {
+	trashedNote := createNote("trashed", "", "")
+	trashedNote.Content.(*NoteContent).SetTrashed(true)
+
+	deletedNote := createNote("deleted", "", "")
+	deletedNote.Content.(*NoteContent).SetTrashed(true)
+	deletedNote.Deleted = true
+
+	items := Items{*createNote("note", "", ""), *trashedNote, *deletedNote, *createTag("tag", "")}
+	assert.Equal(t, Items{*trashedNote}, TrashedNotes(items))
+
+	items.Filter(ItemFilters{Filters: []Filter{{Type: "Note", Key: "Trashed", Value: "true"}}})
+	assert.Len(t, items, 2)
+	assert.Equal(t, trashedNote.UUID, items[0].UUID)
+}
+
+func TestTrashWithStoredSessionUsesItemsKeys(t *testing.T) {
+	_, session := signInNewTestUser(t, "secret")
+
+	ik, ok := session.ItemsKeys.Default()
+	assert.True(t, ok)
+
+	kept := createNote("kept", "kept", "")
+	binned := createNote("binned", "binned", "")
+	tag := createTag("tag", "")
+	tag = &UpdateItemRefs(UpdateItemRefsInput{Items: Items{*tag}, ToRef: Items{*kept, *binned}}).Items[0]
+
+	items := Items{*kept, *binned, *tag}
+	eItems, err := items.EncryptWithItemsKeys(session.Mk, session.Ak, session.ItemsKeys, false)
+	assert.NoError(t, err)
+
+	_, err = PutItems(PutItemsInput{Session: session, Items: eItems})
+	assert.NoError(t, err)
+
+	// a session loaded from a store written before items keys were held has none
+	stored := session
+	stored.ItemsKeys = nil
+
+	_, err = TrashNotes(TrashInput{Session: stored, Notes: Items{*kept}})
+	assert.NoError(t, err)
+
+	smartTag, err := CreateSmartTag(stored, "trash", ItemFilters{Filters: []Filter{{Type: "Note", Key: "trashed", Value: "true"}}}, false)
+	assert.NoError(t, err)
+
+	_, err = DeleteNotes(TrashInput{Session: stored, Notes: Items{*binned}})
+	assert.NoError(t, err)
+
+	out, err := GetItems(GetItemsInput{Session: session})
+	assert.NoError(t, err)
+
+	for _, eItem := range out.Items {
+		switch eItem.UUID {
+		case kept.UUID, tag.UUID, smartTag.UUID:
+			assert.Equal(t, ik.UUID, eItem.ItemsKeyID, eItem.ContentType)
+		}
+	}
+}